@@ -43,4 +43,12 @@ const (
 	// *** Sentry Environment Variables ***.
 	SentryDsnEnv              = "SENTRY_DSN"
 	SentryFlushTimeoutInMsEnv = "SENTRY_FLUSH_TIMEOUT_IN_MS"
+
+	// *** Kafka Environment Variables ***.
+	KafkaBrokersEnv      = "KAFKA_BROKERS"
+	KafkaTopicsEnv       = "KAFKA_TOPICS"
+	KafkaGroupIDEnv      = "KAFKA_GROUP_ID"
+	KafkaSASLUsernameEnv = "KAFKA_SASL_USERNAME"
+	KafkaSecretNameEnv   = "KAFKA_SECRET_NAME"
+	KafkaTLSEnv          = "KAFKA_TLS"
 )
@@ -0,0 +1,68 @@
+package env
+
+import (
+	senv "github.com/caarlos0/env/v11"
+)
+
+// KafkaSettings implements Kafka settings.
+// This is an interface so that clients can mock out this behaviour in tests.
+type KafkaSettings interface {
+	KafkaBrokers() []string
+	KafkaTopics() []string
+	KafkaGroupID() string
+	KafkaSASLUsername() string
+	KafkaSecretName() string
+	IsKafkaTLSEnabled() bool
+}
+
+// kafkaSettings that drive behavior.
+type kafkaSettings struct {
+	// These have to be public so that "github.com/caarlos0/env/v10" can populate them
+	KafkaBrokersEnv      []string `env:"KAFKA_BROKERS"`
+	KafkaTopicsEnv       []string `env:"KAFKA_TOPICS"`
+	KafkaGroupIDEnv      string   `env:"KAFKA_GROUP_ID"`
+	KafkaSASLUsernameEnv string   `env:"KAFKA_SASL_USERNAME"`
+	KafkaSecretNameEnv   string   `env:"KAFKA_SECRET_NAME"`
+	KafkaTLSEnv          bool     `env:"KAFKA_TLS"           envDefault:"true"`
+}
+
+func newKafkaSettings() *kafkaSettings {
+	settings := kafkaSettings{}
+	if err := senv.Parse(&settings); err != nil {
+		panic(err)
+	}
+
+	return &settings
+}
+
+// KafkaBrokers returns the "KAFKA_BROKERS" environment variable, which is a comma separated list.
+func (s *kafkaSettings) KafkaBrokers() []string {
+	return s.KafkaBrokersEnv
+}
+
+// KafkaTopics returns the "KAFKA_TOPICS" environment variable, which is a comma separated list.
+func (s *kafkaSettings) KafkaTopics() []string {
+	return s.KafkaTopicsEnv
+}
+
+// KafkaGroupID returns the "KAFKA_GROUP_ID" environment variable.
+func (s *kafkaSettings) KafkaGroupID() string {
+	return s.KafkaGroupIDEnv
+}
+
+// KafkaSASLUsername returns the "KAFKA_SASL_USERNAME" environment variable.
+func (s *kafkaSettings) KafkaSASLUsername() string {
+	return s.KafkaSASLUsernameEnv
+}
+
+// KafkaSecretName returns the "KAFKA_SECRET_NAME" environment variable, which is
+// the name of the secret holding the SASL password.
+func (s *kafkaSettings) KafkaSecretName() string {
+	return s.KafkaSecretNameEnv
+}
+
+// IsKafkaTLSEnabled returns "true" if the "KAFKA_TLS" environment variable is turned on.
+// Default: true.
+func (s *kafkaSettings) IsKafkaTLSEnabled() bool {
+	return s.KafkaTLSEnv
+}
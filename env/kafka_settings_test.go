@@ -0,0 +1,29 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKafkaSettings(t *testing.T) {
+	settings := newKafkaSettings()
+	assert.NotNil(t, settings)
+}
+
+func TestKafkaSettings(t *testing.T) {
+	t.Setenv(KafkaBrokersEnv, "broker-1:9096,broker-2:9096")
+	t.Setenv(KafkaTopicsEnv, "some-topic,other-topic")
+	t.Setenv(KafkaGroupIDEnv, "some-group")
+	t.Setenv(KafkaSASLUsernameEnv, "some-user")
+	t.Setenv(KafkaSecretNameEnv, "some-secret")
+	t.Setenv(KafkaTLSEnv, "false")
+
+	settings := newKafkaSettings()
+	assert.Equal(t, []string{"broker-1:9096", "broker-2:9096"}, settings.KafkaBrokersEnv)
+	assert.Equal(t, []string{"some-topic", "other-topic"}, settings.KafkaTopicsEnv)
+	assert.Equal(t, "some-group", settings.KafkaGroupIDEnv)
+	assert.Equal(t, "some-user", settings.KafkaSASLUsernameEnv)
+	assert.Equal(t, "some-secret", settings.KafkaSecretNameEnv)
+	assert.Equal(t, false, settings.KafkaTLSEnv)
+}
@@ -171,3 +171,42 @@ func SentryDSN() string {
 func SentryFlushTimeoutInMs() int {
 	return DefaultSentrySettings.SentryFlushTimeoutInMs()
 }
+
+// DefaultKafkaSettings is the package level instance of KafkaSettings.
+var DefaultKafkaSettings KafkaSettings = getKafkaInstance()
+
+func getKafkaInstance() *kafkaSettings {
+	return newKafkaSettings()
+}
+
+// KafkaBrokers returns the "KAFKA_BROKERS" environment variable, which is a comma separated list.
+func KafkaBrokers() []string {
+	return DefaultKafkaSettings.KafkaBrokers()
+}
+
+// KafkaTopics returns the "KAFKA_TOPICS" environment variable, which is a comma separated list.
+func KafkaTopics() []string {
+	return DefaultKafkaSettings.KafkaTopics()
+}
+
+// KafkaGroupID returns the "KAFKA_GROUP_ID" environment variable.
+func KafkaGroupID() string {
+	return DefaultKafkaSettings.KafkaGroupID()
+}
+
+// KafkaSASLUsername returns the "KAFKA_SASL_USERNAME" environment variable.
+func KafkaSASLUsername() string {
+	return DefaultKafkaSettings.KafkaSASLUsername()
+}
+
+// KafkaSecretName returns the "KAFKA_SECRET_NAME" environment variable, which is
+// the name of the secret holding the SASL password.
+func KafkaSecretName() string {
+	return DefaultKafkaSettings.KafkaSecretName()
+}
+
+// IsKafkaTLSEnabled returns "true" if the "KAFKA_TLS" environment variable is turned on.
+// Default: true.
+func IsKafkaTLSEnabled() bool {
+	return DefaultKafkaSettings.IsKafkaTLSEnabled()
+}
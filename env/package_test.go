@@ -74,6 +74,24 @@ func TestDefaultSettings(t *testing.T) {
 
 	sentryFlushTimeout := env.SentryFlushTimeoutInMs()
 	assert.Equal(t, 100, sentryFlushTimeout)
+
+	kafkaBrokers := env.KafkaBrokers()
+	assert.Empty(t, kafkaBrokers)
+
+	kafkaTopics := env.KafkaTopics()
+	assert.Empty(t, kafkaTopics)
+
+	kafkaGroupID := env.KafkaGroupID()
+	assert.Equal(t, "", kafkaGroupID)
+
+	kafkaSASLUsername := env.KafkaSASLUsername()
+	assert.Equal(t, "", kafkaSASLUsername)
+
+	kafkaSecretName := env.KafkaSecretName()
+	assert.Equal(t, "", kafkaSecretName)
+
+	kafkaTLS := env.IsKafkaTLSEnabled()
+	assert.Equal(t, true, kafkaTLS)
 }
 
 func TestIsHelpers(t *testing.T) {
@@ -1,6 +1,9 @@
 package jwt
 
 import (
+	"encoding/json"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,6 +13,24 @@ const (
 	defaultExpiresAt = 10 * time.Minute
 )
 
+// registeredClaims are the claims surfaced as StandardClaims fields, so aren't
+// included in StandardClaims.Extra.
+var registeredClaims = map[string]bool{
+	accountIDClaim:       true,
+	realUserIDClaim:      true,
+	effectiveUserIDClaim: true,
+	impersonatingClaim:   true,
+	localeClaim:          true,
+	userTypeClaim:        true,
+	scopeClaim:           true,
+	"iss":                true,
+	"sub":                true,
+	"aud":                true,
+	"exp":                true,
+	"nbf":                true,
+	"iat":                true,
+}
+
 // StandardClaims represent the standard Culture Amp JWT claims.
 type StandardClaims struct {
 	AccountID       string // uuid
@@ -30,13 +51,114 @@ type StandardClaims struct {
 	NotBefore time.Time // default on Encode is "now"
 	// the `iat` (Issued At) claim. See https://datatracker.ietf.org/doc/html/rfc7519#section-4.1.6
 	IssuedAt time.Time // default on Encode is "now"
+
+	// the `impersonating` claim, true when the RealUserID is acting as the EffectiveUserID
+	Impersonating bool
+	// the `locale` claim, eg. "en-AU"
+	Locale string
+	// the `userType` claim, eg. "employee"
+	UserType string
+	// the `scope` claim, encoded as a space separated list. See https://datatracker.ietf.org/doc/html/rfc8693#section-4.2
+	Scopes []string
+
+	// Extra holds any other claims in the token by name. Numbers decode as float64,
+	// so use the Extra getters rather than type asserting the values yourself.
+	Extra map[string]any
+}
+
+// HasScope returns whether the scope is in the `scope` claim.
+func (sc *StandardClaims) HasScope(scope string) bool {
+	for _, s := range sc.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExtraString returns the extra claim as a string, and whether it was found.
+func (sc *StandardClaims) ExtraString(key string) (string, bool) {
+	val, ok := sc.Extra[key].(string)
+	return val, ok
+}
+
+// ExtraBool returns the extra claim as a bool, and whether it was found.
+func (sc *StandardClaims) ExtraBool(key string) (bool, bool) {
+	val, ok := sc.Extra[key].(bool)
+	return val, ok
+}
+
+// ExtraInt returns the extra claim as an int64, and whether it was found. It is
+// not found if the claim is a number with a fractional part.
+func (sc *StandardClaims) ExtraInt(key string) (int64, bool) {
+	switch val := sc.Extra[key].(type) {
+	case int:
+		return int64(val), true
+	case int64:
+		return val, true
+	case float64:
+		if val != math.Trunc(val) {
+			return 0, false
+		}
+		return int64(val), true
+	case json.Number:
+		i, err := val.Int64()
+		return i, err == nil
+	}
+
+	return 0, false
+}
+
+// ExtraFloat returns the extra claim as a float64, and whether it was found.
+func (sc *StandardClaims) ExtraFloat(key string) (float64, bool) {
+	switch val := sc.Extra[key].(type) {
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	case json.Number:
+		f, err := val.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// ExtraStrings returns the extra claim as a list of strings, and whether it was
+// found. It is not found if any item in the list isn't a string.
+func (sc *StandardClaims) ExtraStrings(key string) ([]string, bool) {
+	switch val := sc.Extra[key].(type) {
+	case []string:
+		return val, true
+	case []any:
+		list := make([]string, 0, len(val))
+		for _, v := range val {
+			s, ok := v.(string)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, s)
+		}
+		return list, true
+	}
+
+	return nil, false
 }
 
 type encoderStandardClaims struct {
 	AccountID       string `json:"accountId"`
 	EffectiveUserID string `json:"effectiveUserId"`
 	RealUserID      string `json:"realUserId"`
+	Impersonating   bool   `json:"impersonating,omitempty"`
+	Locale          string `json:"locale,omitempty"`
+	UserType        string `json:"userType,omitempty"`
+	Scope           string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
+
+	extra map[string]any
 }
 
 func newStandardClaims(claims jwt.MapClaims) *StandardClaims {
@@ -53,6 +175,21 @@ func newStandardClaims(claims jwt.MapClaims) *StandardClaims {
 	std.NotBefore = std.getTime(claims.GetNotBefore)
 	std.IssuedAt = std.getTime(claims.GetIssuedAt)
 
+	std.Impersonating = std.getCustomBool(claims, impersonatingClaim)
+	std.Locale = std.getCustomString(claims, localeClaim)
+	std.UserType = std.getCustomString(claims, userTypeClaim)
+	std.Scopes = std.getScopes(claims)
+
+	for key, val := range claims {
+		if registeredClaims[key] {
+			continue
+		}
+		if std.Extra == nil {
+			std.Extra = make(map[string]any)
+		}
+		std.Extra[key] = val
+	}
+
 	return std
 }
 
@@ -93,11 +230,43 @@ func (sc *StandardClaims) getCustomString(claims jwt.MapClaims, key string) stri
 	return val
 }
 
+func (sc *StandardClaims) getCustomBool(claims jwt.MapClaims, key string) bool {
+	val, ok := claims[key].(bool)
+	if !ok {
+		return false
+	}
+
+	return val
+}
+
+// getScopes supports the `scope` claim as a space separated string, or as a list.
+func (sc *StandardClaims) getScopes(claims jwt.MapClaims) []string {
+	switch val := claims[scopeClaim].(type) {
+	case string:
+		return strings.Fields(val)
+	case []any:
+		var scopes []string
+		for _, v := range val {
+			if s, ok := v.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	}
+
+	return nil
+}
+
 func newEncoderClaims(sc *StandardClaims) *encoderStandardClaims {
 	claims := &encoderStandardClaims{
 		AccountID:       sc.AccountID,
 		EffectiveUserID: sc.EffectiveUserID,
 		RealUserID:      sc.RealUserID,
+		Impersonating:   sc.Impersonating,
+		Locale:          sc.Locale,
+		UserType:        sc.UserType,
+		Scope:           strings.Join(sc.Scopes, " "),
+		extra:           sc.Extra,
 	}
 
 	claims.Issuer = sc.Issuer
@@ -118,3 +287,31 @@ func (esc *encoderStandardClaims) correctTime(t time.Time, def time.Time) *jwt.N
 
 	return jwt.NewNumericDate(t)
 }
+
+// MarshalJSON adds the extra claims to the token, without letting them replace
+// any of the standard claims.
+func (esc *encoderStandardClaims) MarshalJSON() ([]byte, error) {
+	type standardClaims encoderStandardClaims // without this MarshalJSON method
+
+	b, err := json.Marshal((*standardClaims)(esc))
+	if err != nil || len(esc.extra) == 0 {
+		return b, err
+	}
+
+	var std map[string]json.RawMessage
+	if err := json.Unmarshal(b, &std); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]any, len(esc.extra)+len(std))
+	for key, val := range esc.extra {
+		if !registeredClaims[key] {
+			claims[key] = val
+		}
+	}
+	for key, val := range std {
+		claims[key] = val
+	}
+
+	return json.Marshal(claims)
+}
@@ -0,0 +1,64 @@
+package jwt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandardClaimsExtra(t *testing.T) {
+	claims := &StandardClaims{
+		Extra: map[string]any{
+			"name":    "some-name",
+			"beta":    true,
+			"level":   float64(3),
+			"ratio":   0.5,
+			"count":   json.Number("42"),
+			"teamIds": []any{"team-1", "team-2"},
+			"mixed":   []any{"team-1", 2},
+		},
+	}
+
+	s, ok := claims.ExtraString("name")
+	assert.True(t, ok)
+	assert.Equal(t, "some-name", s)
+	_, ok = claims.ExtraString("beta")
+	assert.False(t, ok)
+
+	b, ok := claims.ExtraBool("beta")
+	assert.True(t, ok)
+	assert.True(t, b)
+
+	i, ok := claims.ExtraInt("level")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), i)
+	i, ok = claims.ExtraInt("count")
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), i)
+	_, ok = claims.ExtraInt("ratio")
+	assert.False(t, ok)
+
+	f, ok := claims.ExtraFloat("ratio")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, f)
+
+	list, ok := claims.ExtraStrings("teamIds")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"team-1", "team-2"}, list)
+	_, ok = claims.ExtraStrings("mixed")
+	assert.False(t, ok)
+
+	_, ok = claims.ExtraString("missing")
+	assert.False(t, ok)
+}
+
+func TestNewStandardClaimsScopes(t *testing.T) {
+	claims := newStandardClaims(jwt.MapClaims{"scope": "a b  c"})
+	assert.Equal(t, []string{"a", "b", "c"}, claims.Scopes)
+	assert.Nil(t, claims.Extra)
+
+	claims = newStandardClaims(jwt.MapClaims{"scope": []any{"a", "b"}})
+	assert.Equal(t, []string{"a", "b"}, claims.Scopes)
+}
@@ -2,7 +2,9 @@ package jwt
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"slices"
 	"time"
 
 	"github.com/go-errors/errors"
@@ -17,12 +19,25 @@ const (
 	accountIDClaim                 = "accountId"
 	realUserIDClaim                = "realUserId"
 	effectiveUserIDClaim           = "effectiveUserId"
+	impersonatingClaim             = "impersonating"
+	localeClaim                    = "locale"
+	userTypeClaim                  = "userType"
+	scopeClaim                     = "scope"
 	defaultDecoderExpiration       = 60 * time.Minute
 	defaultDecoderRotationDuration = 30 * time.Second
 	defaultDecoderLeeway           = 10 * time.Second
 )
 
-type publicKey interface{} // Only ECDSA (perferred) and RSA public keys allowed
+type publicKey interface{} // Only ECDSA (perferred), EdDSA and RSA public keys allowed
+
+// supportedAlgorithms are the "alg's" the decoder can verify, and by default allows.
+// https://auth0.com/blog/critical-vulnerabilities-in-json-web-token-libraries/
+var supportedAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
 
 // DecoderJwksRetriever defines the function signature required to retrieve JWKS json.
 type DecoderJwksRetriever func() string
@@ -30,18 +45,21 @@ type DecoderJwksRetriever func() string
 // StandardDecoder can decode a jwt token string.
 type StandardDecoder struct {
 	dispatcher     DecoderJwksRetriever // func provided by clients of this library to supply the current JWKS
+	refresher      DecoderJwksRetriever // func to supply the latest JWKS when a kid isn't found, defaults to the dispatcher
 	expiresWithin  time.Duration        // default is 60 minutes
 	rotationWindow time.Duration        // default is 30 seconds
+	allowedAlgs    []string             // default is all the supportedAlgorithms
 	jwks           *jwkFetcher          // manages the life cycle of a JWK Set
 }
 
-// NewDecoder creates a new JwtDecoder with the set ECDSA and RSA public keys in the JWK string.
+// NewDecoder creates a new JwtDecoder with the set ECDSA, EdDSA and RSA public keys in the JWK string.
 func NewDecoder(fetchJWKS DecoderJwksRetriever, options ...DecoderOption) (*StandardDecoder, error) {
 	decoder := &StandardDecoder{
 		dispatcher:     fetchJWKS,
 		jwks:           nil,
 		expiresWithin:  defaultDecoderExpiration,
 		rotationWindow: defaultDecoderRotationDuration,
+		allowedAlgs:    supportedAlgorithms,
 	}
 
 	// Loop through our Decoder options and apply them
@@ -49,7 +67,17 @@ func NewDecoder(fetchJWKS DecoderJwksRetriever, options ...DecoderOption) (*Stan
 		option(decoder)
 	}
 
+	if len(decoder.allowedAlgs) == 0 {
+		return nil, errors.Errorf("failed to create decoder: no allowed algorithms")
+	}
+	for _, alg := range decoder.allowedAlgs {
+		if !slices.Contains(supportedAlgorithms, alg) {
+			return nil, errors.Errorf("failed to create decoder: unsupported algorithm: %s", alg)
+		}
+	}
+
 	decoder.jwks = newJWKSet(fetchJWKS, decoder.expiresWithin, decoder.rotationWindow)
+	decoder.jwks.refresher = decoder.refresher
 
 	// call the get to make sure its valid and we can parse the JWKS
 	_, err := decoder.jwks.Get()
@@ -95,9 +123,8 @@ func (d *StandardDecoder) enforceParsingOptions(options ...DecoderParserOption)
 	var opts []jwt.ParserOption
 
 	// https://auth0.com/blog/critical-vulnerabilities-in-json-web-token-libraries/
-	validAlgs := []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
 	opts = append(opts,
-		jwt.WithValidMethods(validAlgs),      // only keys with these "alg's" will be considered
+		jwt.WithValidMethods(d.allowedAlgs),  // only keys with these "alg's" will be considered
 		jwt.WithLeeway(defaultDecoderLeeway), // as per the JWT eng std: clock skew set to 10 seconds
 
 		// Exp
@@ -137,11 +164,11 @@ func (d *StandardDecoder) useCorrectPublicKey(token *jwt.Token) (publicKey, erro
 	}
 
 	// Eng Std: https://cultureamp.atlassian.net/wiki/spaces/TV/pages/3253240053/JWT+Authentication
-	// Perferred is ECDSA, but is RSA accepted
-	if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, errors.Errorf("unexpected signing method - only ecdsa or rsa supported: %v", token.Header[algorithmHeaderKey])
-		}
+	// Perferred is ECDSA, but EdDSA, RSA and RSA-PSS are accepted
+	switch token.Method.(type) {
+	case *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519, *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+	default:
+		return nil, errors.Errorf("unexpected signing method - only ecdsa, eddsa or rsa supported: %v", token.Header[algorithmHeaderKey])
 	}
 
 	kidHeader, found := token.Header[kidHeaderKey]
@@ -212,7 +239,7 @@ func (d *StandardDecoder) getPublicKey(key jwk.Key) (publicKey, error) {
 	}
 
 	// If the JWKS contains the full key (Private AND Public) then only return the public one
-	// ECDSA & RSA keys only.
+	// ECDSA, EdDSA & RSA keys only.
 	// NOTE: this should never happen in production - but does in the unit tests
 	if ecdsa, ok := rawkey.(*ecdsa.PrivateKey); ok {
 		return &ecdsa.PublicKey, nil
@@ -220,6 +247,9 @@ func (d *StandardDecoder) getPublicKey(key jwk.Key) (publicKey, error) {
 	if rsa, ok := rawkey.(*rsa.PrivateKey); ok {
 		return &rsa.PublicKey, nil
 	}
+	if ed, ok := rawkey.(ed25519.PrivateKey); ok {
+		return ed.Public(), nil
+	}
 
 	return rawkey, err
 }
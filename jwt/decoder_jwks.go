@@ -11,6 +11,7 @@ import (
 // jwkFetcher manages the life-cycle of a jwk.Set().
 type jwkFetcher struct {
 	dispatcher     DecoderJwksRetriever // func provided by clients of this library to supply a refreshed JWKS
+	refresher      DecoderJwksRetriever // func used instead of the dispatcher when a kid isn't found (optional)
 	expiresWithin  time.Duration
 	rotationWindow time.Duration
 
@@ -35,7 +36,7 @@ func (f *jwkFetcher) Get() (jwk.Set, error) {
 		return f.jwks, nil
 	}
 
-	jwks, err := f.fetch()
+	jwks, err := f.fetch(f.dispatcher)
 	if err != nil {
 		return f.jwks, err
 	}
@@ -51,7 +52,12 @@ func (f *jwkFetcher) Refresh() (jwk.Set, error) {
 		return f.jwks, errors.Errorf("failed to refresh jwks as just recently updated")
 	}
 
-	jwks, err := f.fetch()
+	refresher := f.dispatcher
+	if f.refresher != nil {
+		refresher = f.refresher
+	}
+
+	jwks, err := f.fetch(refresher)
 	if err != nil {
 		return f.jwks, err
 	}
@@ -86,13 +92,13 @@ func (f *jwkFetcher) canRefresh() bool {
 	return freshness > f.rotationWindow
 }
 
-func (f *jwkFetcher) fetch() (jwk.Set, error) {
+func (f *jwkFetcher) fetch(dispatcher DecoderJwksRetriever) (jwk.Set, error) {
 	// Only allow one thread to update the jwks
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	// Call client retriever func
-	jwkKeys := f.dispatcher()
+	jwkKeys := dispatcher()
 
 	// Parse all new JWKs JSON keys and make sure its valid
 	jwkSet, err := f.parse(jwkKeys)
@@ -0,0 +1,242 @@
+package jwt
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+const (
+	defaultHTTPJwksTimeout         = 10 * time.Second
+	defaultHTTPJwksRefreshInterval = defaultDecoderExpiration / 2
+	defaultHTTPJwksMinRefresh      = defaultDecoderRotationDuration
+	maxHTTPJwksSize                = 1 << 20 // 1 MB
+)
+
+// HTTPJwksRetriever retrieves a JWKS from a URL, such as a "/.well-known/jwks.json"
+// endpoint, so that keys can be rotated without a redeploy.
+//
+// The JWKS is cached for the "max-age" of the response Cache-Control header, up to
+// the refresh interval, and is then revalidated using its ETag. If the endpoint
+// fails, the last JWKS retrieved (if any) is served until it succeeds again, and
+// it is not requested again until the minimum refresh of 30 seconds has passed.
+//
+// Use Retrieve as the DecoderJwksRetriever, and Refresh with the
+// WithDecoderJwksRefresher option so that a token with an unknown "kid" fetches
+// the latest keys. Run refreshes the JWKS in the background before it expires, so
+// that decoding never waits on the endpoint:
+//
+//	retriever := jwt.NewHTTPJwksRetriever("https://example.com/.well-known/jwks.json")
+//	go retriever.Run(ctx)
+//	decoder, err := jwt.NewDecoder(retriever.Retrieve, jwt.WithDecoderJwksRefresher(retriever.Refresh))
+type HTTPJwksRetriever struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration // the longest the JWKS is cached for
+	minRefresh      time.Duration // the shortest time between fetches after a failure or "no-cache"
+
+	fetchMu   sync.Mutex   // only allow one fetch at a time
+	mu        sync.RWMutex // protects the fields below
+	jwks      string
+	etag      string
+	expiresAt time.Time
+	err       error
+}
+
+// HTTPJwksRetrieverOption function signature for adding HTTPJwksRetriever options.
+type HTTPJwksRetrieverOption func(*HTTPJwksRetriever)
+
+// WithHTTPJwksClient sets the HTTP client used to fetch the JWKS. Requests time
+// out with the client's Timeout, so set one as a fetch blocks other fetches.
+// Default: a client with a 10 second timeout.
+func WithHTTPJwksClient(client *http.Client) HTTPJwksRetrieverOption {
+	return func(r *HTTPJwksRetriever) {
+		r.client = client
+	}
+}
+
+// WithHTTPJwksRefreshInterval sets the longest time the JWKS is cached for before
+// being revalidated, regardless of the response Cache-Control header. It should be
+// less than the decoder JWKS expiry (see WithDecoderJwksExpiry).
+// Default: 30 minutes.
+func WithHTTPJwksRefreshInterval(interval time.Duration) HTTPJwksRetrieverOption {
+	return func(r *HTTPJwksRetriever) {
+		r.refreshInterval = interval
+	}
+}
+
+// NewHTTPJwksRetriever creates a new HTTPJwksRetriever for the JWKS URL. Nothing is
+// fetched until the JWKS is first retrieved or Run is called.
+func NewHTTPJwksRetriever(url string, options ...HTTPJwksRetrieverOption) *HTTPJwksRetriever {
+	r := &HTTPJwksRetriever{
+		url:             url,
+		client:          &http.Client{Timeout: defaultHTTPJwksTimeout},
+		refreshInterval: defaultHTTPJwksRefreshInterval,
+		minRefresh:      defaultHTTPJwksMinRefresh,
+	}
+
+	// Loop through our options and apply them
+	for _, option := range options {
+		option(r)
+	}
+
+	return r
+}
+
+// Retrieve returns the cached JWKS, fetching it first if it has expired. It
+// implements DecoderJwksRetriever.
+func (r *HTTPJwksRetriever) Retrieve() string {
+	if jwks, fresh := r.cached(); fresh {
+		return jwks
+	}
+
+	r.fetchMu.Lock()
+	defer r.fetchMu.Unlock()
+
+	// another caller may have fetched it while we were waiting
+	if jwks, fresh := r.cached(); fresh {
+		return jwks
+	}
+	return r.fetch()
+}
+
+// Refresh fetches the JWKS even if it has not expired, which is cheap if it has
+// not changed as it is revalidated using its ETag. It is used with the
+// WithDecoderJwksRefresher option.
+func (r *HTTPJwksRetriever) Refresh() string {
+	r.fetchMu.Lock()
+	defer r.fetchMu.Unlock()
+
+	return r.fetch()
+}
+
+// Run refreshes the JWKS in the background each time it expires, until the
+// context is canceled.
+func (r *HTTPJwksRetriever) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		r.Refresh()
+
+		r.mu.RLock()
+		next := time.Until(r.expiresAt)
+		r.mu.RUnlock()
+		timer.Reset(max(next, r.minRefresh))
+	}
+}
+
+// Err returns the error from the last fetch, or nil if it succeeded.
+func (r *HTTPJwksRetriever) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+// cached returns the cached JWKS, and whether it can be served without fetching
+// it. After a failed fetch that is until the minimum refresh, even if there is no
+// JWKS to serve.
+func (r *HTTPJwksRetriever) cached() (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.jwks, time.Now().Before(r.expiresAt)
+}
+
+// fetch fetches the JWKS and returns it, or returns the stale JWKS if the fetch
+// fails. The fetchMu must be held.
+func (r *HTTPJwksRetriever) fetch() string {
+	jwks, etag, maxAge, err := r.get()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.err = err
+	if err != nil {
+		// serve the stale keys, if any, but don't retry on every call
+		r.expiresAt = now.Add(r.minRefresh)
+		return r.jwks
+	}
+
+	if jwks != "" { // empty when not modified
+		r.jwks = jwks
+		r.etag = etag
+	}
+	r.expiresAt = now.Add(min(max(maxAge, r.minRefresh), r.refreshInterval))
+	return r.jwks
+}
+
+// get requests the JWKS, returning an empty JWKS if it has not been modified, and
+// the time it can be cached for. The request times out with the client.
+func (r *HTTPJwksRetriever) get() (string, string, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return "", "", 0, errors.Errorf("failed to create jwks request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	r.mu.RLock()
+	if r.jwks != "" && r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	r.mu.RUnlock()
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", "", 0, errors.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	maxAge := cacheMaxAge(resp.Header.Get("Cache-Control"), r.refreshInterval)
+
+	if resp.StatusCode == http.StatusNotModified {
+		return "", "", maxAge, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", "", 0, errors.Errorf("failed to fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPJwksSize))
+	if err != nil {
+		return "", "", 0, errors.Errorf("failed to read jwks: %w", err)
+	}
+
+	// make sure its valid before replacing the current keys
+	jwks := string(b)
+	if _, err := jwk.ParseString(jwks); err != nil {
+		return "", "", 0, errors.Errorf("failed to parse jwks: %w", err)
+	}
+
+	return jwks, resp.Header.Get("ETag"), maxAge, nil
+}
+
+// cacheMaxAge returns the time a response can be cached for from its
+// Cache-Control header, or the fallback if it doesn't say.
+func cacheMaxAge(cacheControl string, fallback time.Duration) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return fallback
+}
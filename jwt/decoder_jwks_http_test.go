@@ -0,0 +1,246 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer serves a JWKS with an ETag and Cache-Control header.
+type jwksServer struct {
+	mu           sync.Mutex
+	jwks         string
+	etag         string
+	cacheControl string
+	status       int
+
+	requests    atomic.Int32
+	notModified atomic.Int32
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests.Add(1)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+
+	w.Header().Set("Cache-Control", s.cacheControl)
+	w.Header().Set("ETag", s.etag)
+	if r.Header.Get("If-None-Match") == s.etag {
+		s.notModified.Add(1)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	_, _ = w.Write([]byte(s.jwks))
+}
+
+func (s *jwksServer) set(jwks, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jwks = jwks
+	s.etag = etag
+}
+
+func (s *jwksServer) fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func TestHTTPJwksRetriever_cacheControl(t *testing.T) {
+	jwks := readTestJwks(t)
+
+	testCases := []struct {
+		desc             string
+		cacheControl     string
+		expectedRequests int32
+	}{
+		{
+			desc:             "Success 1: cached for max-age",
+			cacheControl:     "public, max-age=3600",
+			expectedRequests: 1,
+		},
+		{
+			desc:             "Success 2: revalidated when no-cache",
+			cacheControl:     "no-cache",
+			expectedRequests: 3,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			server := &jwksServer{jwks: jwks, etag: `"v1"`, cacheControl: tC.cacheControl}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			retriever := NewHTTPJwksRetriever(ts.URL, WithHTTPJwksClient(ts.Client()))
+			retriever.minRefresh = 0
+
+			for i := 0; i < 3; i++ {
+				assert.Equal(t, jwks, retriever.Retrieve())
+			}
+			assert.Equal(t, tC.expectedRequests, server.requests.Load())
+			assert.Equal(t, tC.expectedRequests-1, server.notModified.Load(), "revalidated using the etag")
+			assert.Nil(t, retriever.Err())
+		})
+	}
+}
+
+func TestHTTPJwksRetriever_stale(t *testing.T) {
+	jwks := readTestJwks(t)
+	server := &jwksServer{jwks: jwks, etag: `"v1"`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retriever := NewHTTPJwksRetriever(ts.URL, WithHTTPJwksClient(ts.Client()))
+	assert.Equal(t, jwks, retriever.Refresh())
+
+	// serves the stale keys while the endpoint is down
+	server.fail(http.StatusServiceUnavailable)
+	assert.Equal(t, jwks, retriever.Refresh())
+	assert.ErrorContains(t, retriever.Err(), "unexpected status 503")
+
+	// and doesn't refetch them on every retrieve
+	assert.Equal(t, jwks, retriever.Retrieve())
+	assert.Equal(t, int32(2), server.requests.Load())
+
+	// nothing to serve if the first fetch fails
+	retriever = NewHTTPJwksRetriever(ts.URL, WithHTTPJwksClient(ts.Client()))
+	assert.Equal(t, "", retriever.Retrieve())
+	assert.NotNil(t, retriever.Err())
+
+	// but it still isn't refetched on every retrieve
+	assert.Equal(t, "", retriever.Retrieve())
+	assert.Equal(t, int32(3), server.requests.Load())
+}
+
+func TestHTTPJwksRetriever_clientTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer ts.Close()
+	defer close(unblock)
+
+	client := ts.Client()
+	client.Timeout = 10 * time.Millisecond
+	retriever := NewHTTPJwksRetriever(ts.URL, WithHTTPJwksClient(client))
+
+	start := time.Now()
+	assert.Equal(t, "", retriever.Retrieve())
+	assert.Less(t, time.Since(start), time.Second, "the client timeout should be used")
+	assert.ErrorContains(t, retriever.Err(), "Client.Timeout exceeded")
+}
+
+func TestHTTPJwksRetriever_invalid(t *testing.T) {
+	jwks := readTestJwks(t)
+	server := &jwksServer{jwks: jwks, etag: `"v1"`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retriever := NewHTTPJwksRetriever(ts.URL, WithHTTPJwksClient(ts.Client()))
+	assert.Equal(t, jwks, retriever.Refresh())
+
+	// invalid keys don't replace the current ones
+	server.set("invalid JSON", `"v2"`)
+	assert.Equal(t, jwks, retriever.Refresh())
+	assert.ErrorContains(t, retriever.Err(), "failed to parse jwks")
+}
+
+func TestHTTPJwksRetriever_Run(t *testing.T) {
+	jwks := readTestJwks(t)
+	server := &jwksServer{jwks: jwks, etag: `"v1"`, cacheControl: "max-age=0"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retriever := NewHTTPJwksRetriever(ts.URL, WithHTTPJwksClient(ts.Client()))
+	retriever.minRefresh = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		retriever.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return server.notModified.Load() >= 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, jwks, retriever.Retrieve())
+	assert.Nil(t, retriever.Err())
+}
+
+func TestHTTPJwksRetriever_decoderRefresh(t *testing.T) {
+	jwks := readTestJwks(t)
+	server := &jwksServer{jwks: withoutKid(t, jwks, "rsa-256"), etag: `"v1"`, cacheControl: "max-age=3600"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	retriever := NewHTTPJwksRetriever(ts.URL, WithHTTPJwksClient(ts.Client()))
+	decoder, err := NewDecoder(retriever.Retrieve,
+		WithDecoderJwksRefresher(retriever.Refresh),
+		WithDecoderRotateWindow(0),
+	)
+	require.Nil(t, err)
+
+	b, err := os.ReadFile(filepath.Clean(testRSA256PrivateKey))
+	require.Nil(t, err)
+	encoder, err := NewEncoder(func() (string, string) { return string(b), "rsa-256" })
+	require.Nil(t, err)
+	token, err := encoder.Encode(&StandardClaims{AccountID: "abc123", ExpiresAt: time.Now().Add(time.Hour)})
+	require.Nil(t, err)
+
+	// the new key is rotated in, and found by refreshing despite the max-age
+	server.set(jwks, `"v2"`)
+	claims, err := decoder.Decode(token)
+	require.Nil(t, err)
+	assert.Equal(t, "abc123", claims.AccountID)
+	assert.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	assert.Equal(t, time.Minute, cacheMaxAge("", time.Minute))
+	assert.Equal(t, 5*time.Second, cacheMaxAge("public, max-age=5", time.Minute))
+	assert.Equal(t, time.Duration(0), cacheMaxAge("no-store", time.Minute))
+	assert.Equal(t, time.Minute, cacheMaxAge("max-age=abc", time.Minute))
+}
+
+func readTestJwks(t *testing.T) string {
+	b, err := os.ReadFile(filepath.Clean(testAuthJwks))
+	require.Nil(t, err)
+	return string(b)
+}
+
+// withoutKid returns the JWKS without the key with the kid.
+func withoutKid(t *testing.T, jwks string, kid string) string {
+	var set struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(jwks), &set))
+
+	keys := set.Keys[:0]
+	for _, key := range set.Keys {
+		if key["kid"] != kid {
+			keys = append(keys, key)
+		}
+	}
+	set.Keys = keys
+
+	b, err := json.Marshal(set)
+	require.Nil(t, err)
+	return string(b)
+}
@@ -22,6 +22,25 @@ func WithDecoderRotateWindow(rotate time.Duration) DecoderOption {
 	}
 }
 
+// WithDecoderAllowedAlgorithms sets the "alg's" tokens can be signed with, from
+// RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512 and EdDSA.
+// Tokens signed with any other "alg" are rejected.
+// Default: all of them.
+func WithDecoderAllowedAlgorithms(algs ...string) DecoderOption {
+	return func(decoder *StandardDecoder) {
+		decoder.allowedAlgs = algs
+	}
+}
+
+// WithDecoderJwksRefresher sets the func called to get the latest JWKS when a token
+// has a "kid" that isn't in the current JWKS, instead of the DecoderJwksRetriever.
+// This is useful when the retriever caches the JWKS, such as HTTPJwksRetriever.Refresh.
+func WithDecoderJwksRefresher(refresher DecoderJwksRetriever) DecoderOption {
+	return func(decoder *StandardDecoder) {
+		decoder.refresher = refresher
+	}
+}
+
 // DecoderParserOption function signature for adding JWT Decoder Parsing options.
 type DecoderParserOption func(*decoderParser)
 
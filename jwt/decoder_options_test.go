@@ -86,3 +86,17 @@ func TestDecoderParsingOptions(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, claim)
 }
+
+func TestDecoderAllowedAlgorithmsOption(t *testing.T) {
+	b, err := os.ReadFile(filepath.Clean(testAuthJwks))
+	assert.Nil(t, err)
+	jwks := string(b)
+
+	decoder, err := NewDecoder(func() string { return jwks }, WithDecoderAllowedAlgorithms("HS256"))
+	assert.ErrorContains(t, err, "unsupported algorithm: HS256")
+	assert.Nil(t, decoder)
+
+	decoder, err = NewDecoder(func() string { return jwks }, WithDecoderAllowedAlgorithms())
+	assert.ErrorContains(t, err, "no allowed algorithms")
+	assert.Nil(t, decoder)
+}
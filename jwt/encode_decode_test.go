@@ -6,7 +6,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -17,6 +19,7 @@ const (
 	testECDSA521PrivateKey string = "./testKeys/jwt-ecdsa521-test.key"
 	testECDSA384PrivateKey string = "./testKeys/jwt-ecdsa384-test.key"
 	testECDSA256PrivateKey string = "./testKeys/jwt-ecdsa256-test.key"
+	testEd25519PrivateKey  string = "./testKeys/jwt-ed25519-test.key"
 )
 
 // useful to create RS256 test tokens https://jwt.io/
@@ -110,3 +113,142 @@ func TestEncodeDecode(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeDecodeCultureAmpClaims(t *testing.T) {
+	claims := &StandardClaims{
+		AccountID:       "abc123",
+		RealUserID:      "xyz234",
+		EffectiveUserID: "xyz345",
+		Impersonating:   true,
+		Locale:          "en-AU",
+		UserType:        "employee",
+		Scopes:          []string{"surveys:read", "surveys:write"},
+		Extra: map[string]any{
+			"jti":       "some-id",
+			"teamIds":   []string{"team-1", "team-2"},
+			"level":     3,
+			"beta":      true,
+			"accountId": "not-this-one", // the standard claims take precedence
+		},
+		ExpiresAt: time.Unix(2211797532, 0), //  2/2/2040
+	}
+
+	decoder, err := NewDecoder(func() string { return readTestJwks(t) })
+	assert.Nil(t, err)
+
+	token := encodeTestToken(t, claims)
+	actual, err := decoder.Decode(token)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "abc123", actual.AccountID)
+	assert.True(t, actual.Impersonating)
+	assert.Equal(t, "en-AU", actual.Locale)
+	assert.Equal(t, "employee", actual.UserType)
+	assert.Equal(t, []string{"surveys:read", "surveys:write"}, actual.Scopes)
+	assert.True(t, actual.HasScope("surveys:write"))
+	assert.False(t, actual.HasScope("surveys:delete"))
+	assert.Equal(t, map[string]any{
+		"jti":     "some-id",
+		"teamIds": []any{"team-1", "team-2"},
+		"level":   float64(3),
+		"beta":    true,
+	}, actual.Extra)
+
+	// and encodes again to the same claims
+	again, err := decoder.Decode(encodeTestToken(t, actual))
+	assert.Nil(t, err)
+	assert.Equal(t, actual.Extra, again.Extra)
+	assert.Equal(t, actual.Scopes, again.Scopes)
+}
+
+func TestEncodeDecodeAlgorithms(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		privkey        string
+		options        []EncoderOption
+		allowedAlgs    []string
+		expectedAlg    string
+		expectedErrMsg string
+	}{
+		{
+			desc:        "Success 1: EdDSA Key",
+			privkey:     testEd25519PrivateKey,
+			expectedAlg: "EdDSA",
+		},
+		{
+			desc:        "Success 2: RSA PS256",
+			privkey:     testRSA256PrivateKey,
+			options:     []EncoderOption{WithEncoderRSAAlgorithm("PS256")},
+			expectedAlg: "PS256",
+		},
+		{
+			desc:        "Success 3: RSA PS384",
+			privkey:     testRSA384PrivateKey,
+			options:     []EncoderOption{WithEncoderRSAAlgorithm("PS384")},
+			expectedAlg: "PS384",
+		},
+		{
+			desc:        "Success 4: RSA PS512",
+			privkey:     testRSA512PrivateKey,
+			options:     []EncoderOption{WithEncoderRSAAlgorithm("PS512")},
+			expectedAlg: "PS512",
+		},
+		{
+			desc:        "Success 5: RSA RS256",
+			privkey:     testRSA256PrivateKey,
+			options:     []EncoderOption{WithEncoderRSAAlgorithm("RS256")},
+			allowedAlgs: []string{"RS256"},
+			expectedAlg: "RS256",
+		},
+		{
+			desc:           "Error 1: EdDSA not allowed",
+			privkey:        testEd25519PrivateKey,
+			allowedAlgs:    []string{"ES256", "PS256"},
+			expectedAlg:    "EdDSA",
+			expectedErrMsg: "signing method EdDSA is invalid",
+		},
+		{
+			desc:           "Error 2: RS512 not allowed",
+			privkey:        testRSA512PrivateKey,
+			allowedAlgs:    []string{"PS512"},
+			expectedAlg:    "RS512",
+			expectedErrMsg: "signing method RS512 is invalid",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Clean(tC.privkey))
+			require.Nil(t, err)
+			privKey := string(b)
+
+			encoder, err := NewEncoder(func() (string, string) { return privKey, "some-kid" }, tC.options...)
+			require.Nil(t, err)
+
+			// the public jwks for the decoder has the same alg the encoder signs with
+			jwks, err := encoder.JWKS()
+			require.Nil(t, err)
+			assert.Contains(t, jwks, `"alg":"`+tC.expectedAlg+`"`)
+
+			var decoderOptions []DecoderOption
+			if tC.allowedAlgs != nil {
+				decoderOptions = append(decoderOptions, WithDecoderAllowedAlgorithms(tC.allowedAlgs...))
+			}
+			decoder, err := NewDecoder(func() string { return jwks }, decoderOptions...)
+			require.Nil(t, err)
+
+			token, err := encoder.Encode(&StandardClaims{AccountID: "abc123"})
+			require.Nil(t, err)
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.Nil(t, err)
+			assert.Equal(t, tC.expectedAlg, parsed.Method.Alg())
+
+			claims, err := decoder.Decode(token)
+			if tC.expectedErrMsg != "" {
+				assert.ErrorContains(t, err, tC.expectedErrMsg)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, "abc123", claims.AccountID)
+		})
+	}
+}
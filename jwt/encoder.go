@@ -7,6 +7,8 @@ import (
 
 	"github.com/go-errors/errors"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/patrickmn/go-cache"
 )
 
@@ -14,41 +16,77 @@ const (
 	privCacheKey                  = "encoder_priv_key"
 	defaultEncoderExpiration      = 60 * time.Minute
 	defaultEncoderCleanupInterval = 1 * time.Minute
-
-	invalidKey = iota
-	rsaKey
-	ecdsaKey512
-	ecdsaKey384
-	ecdsaKey256
+	defaultEncoderRSAAlgorithm    = "RS512"
 )
 
-// Only ECDSA (perferred) and RSA public keys allowed.
+// Only ECDSA (perferred), EdDSA and RSA private keys allowed.
 type privateKey interface{}
 
 // EncoderKeyRetriever defines the function signature required to retrieve private PEM key.
 type EncoderKeyRetriever func() (string, string)
 
+// EncoderKey is a private PEM key and its "kid" (key_id).
+type EncoderKey struct {
+	PrivateKey string
+	KeyID      string
+}
+
+// EncoderKeyRing holds the key used to sign tokens, and the next key to rotate to.
+//
+// To rotate keys, set the Next key and publish the JWKS so decoders have its
+// public key before NextActivatesAt, when the encoder starts signing with it. Once
+// tokens signed with the old key have expired, make the Next key the Active key.
+type EncoderKeyRing struct {
+	Active          EncoderKey
+	Next            *EncoderKey // optional
+	NextActivatesAt time.Time   // when the Next key replaces the Active key, required with Next
+}
+
+// EncoderKeyRingRetriever defines the function signature required to retrieve the
+// private PEM keys in the key ring.
+type EncoderKeyRingRetriever func() EncoderKeyRing
+
 type encoderPrivateKey struct {
 	privateSigningKey privateKey
-	keyType           int
+	signingMethod     jwt.SigningMethod
 	kid               string
 }
 
+type encoderKeyRing struct {
+	active          *encoderPrivateKey
+	next            *encoderPrivateKey
+	nextActivatesAt time.Time
+}
+
 // StandardEncoder can encode a claim to a jwt token string.
 type StandardEncoder struct {
-	fetchPrivateKey   EncoderKeyRetriever // func provided by clients of this library to supply a refreshed private key and kid
-	mu                sync.Mutex          // mutex to protect cache.Get/Set race condition
-	cache             *cache.Cache        // memory cache holding the encoderPrivateKey struct
-	defaultExpiration time.Duration       // default is 60 minutes
-	cleanupInterval   time.Duration       // default is every 1 minute
+	fetchKeyRing      EncoderKeyRingRetriever // func provided by clients of this library to supply refreshed private keys and kids
+	mu                sync.Mutex              // mutex to protect cache.Get/Set race condition
+	cache             *cache.Cache            // memory cache holding the encoderKeyRing struct
+	defaultExpiration time.Duration           // default is 60 minutes
+	cleanupInterval   time.Duration           // default is every 1 minute
+	rsaAlgorithm      string                  // default is RS512
+	rsaSigningMethod  jwt.SigningMethod
+	now               func() time.Time
 }
 
 // NewEncoder creates a new JwtEncoder.
 func NewEncoder(fetchPrivateKey EncoderKeyRetriever, options ...EncoderOption) (*StandardEncoder, error) {
+	return NewKeyRingEncoder(func() EncoderKeyRing {
+		privKey, kid := fetchPrivateKey()
+		return EncoderKeyRing{Active: EncoderKey{PrivateKey: privKey, KeyID: kid}}
+	}, options...)
+}
+
+// NewKeyRingEncoder creates a new JwtEncoder that signs with the Active key in the
+// key ring, until the Next key activates.
+func NewKeyRingEncoder(fetchKeyRing EncoderKeyRingRetriever, options ...EncoderOption) (*StandardEncoder, error) {
 	encoder := &StandardEncoder{
-		fetchPrivateKey:   fetchPrivateKey,
+		fetchKeyRing:      fetchKeyRing,
 		defaultExpiration: defaultEncoderExpiration,
 		cleanupInterval:   defaultEncoderCleanupInterval,
+		rsaAlgorithm:      defaultEncoderRSAAlgorithm,
+		now:               time.Now,
 	}
 
 	// Loop through our Encoder options and apply them
@@ -56,10 +94,17 @@ func NewEncoder(fetchPrivateKey EncoderKeyRetriever, options ...EncoderOption) (
 		option(encoder)
 	}
 
+	switch method := jwt.GetSigningMethod(encoder.rsaAlgorithm).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		encoder.rsaSigningMethod = method
+	default:
+		return nil, errors.Errorf("invalid rsa algorithm: %s", encoder.rsaAlgorithm)
+	}
+
 	encoder.cache = cache.New(encoder.defaultExpiration, encoder.cleanupInterval)
 
-	// call the fetchPrivateKey func to make sure the private key is valid
-	_, err := encoder.loadPrivateKey()
+	// call the fetchKeyRing func to make sure the private keys are valid
+	_, err := encoder.loadKeyRing()
 	if err != nil {
 		return nil, errors.Errorf("failed to load private key: %w", err)
 	}
@@ -76,26 +121,13 @@ func (e *StandardEncoder) Encode(claims *StandardClaims) (string, error) {
 
 // EncodeWithCustomClaims encodes the Custom Claims in a jwt token string.
 func (e *StandardEncoder) EncodeWithCustomClaims(customClaims jwt.Claims) (string, error) {
-	var token *jwt.Token
-
 	// Will check cache and re-fetch if expired
 	encodingKey, err := e.loadPrivateKey()
 	if err != nil {
 		return "", errors.Errorf("failed to load private key: %w", err)
 	}
 
-	switch encodingKey.keyType {
-	case ecdsaKey512:
-		token = jwt.NewWithClaims(jwt.SigningMethodES512, customClaims)
-	case ecdsaKey384:
-		token = jwt.NewWithClaims(jwt.SigningMethodES384, customClaims)
-	case ecdsaKey256:
-		token = jwt.NewWithClaims(jwt.SigningMethodES256, customClaims)
-	case rsaKey:
-		token = jwt.NewWithClaims(jwt.SigningMethodRS512, customClaims)
-	default:
-		return "", errors.Errorf("Only ECDSA and RSA private keys are supported")
-	}
+	token := jwt.NewWithClaims(encodingKey.signingMethod, customClaims)
 
 	if encodingKey.kid != "" {
 		token.Header[kidHeaderKey] = encodingKey.kid
@@ -104,10 +136,47 @@ func (e *StandardEncoder) EncodeWithCustomClaims(customClaims jwt.Claims) (strin
 	return token.SignedString(encodingKey.privateSigningKey)
 }
 
+// JWKS returns the JSON JWKS with the public keys in the key ring, for the
+// decoders to use.
+func (e *StandardEncoder) JWKS() (string, error) {
+	ring, err := e.loadKeyRing()
+	if err != nil {
+		return "", errors.Errorf("failed to load private key: %w", err)
+	}
+
+	var keys []jwk.Key
+	for _, key := range []*encoderPrivateKey{ring.active, ring.next} {
+		if key == nil {
+			continue
+		}
+
+		pubKey, err := newPublicJWK(key.privateSigningKey, key.kid, key.algorithm())
+		if err != nil {
+			return "", err
+		}
+		keys = append(keys, pubKey)
+	}
+
+	return marshalJWKS(keys)
+}
+
 func (e *StandardEncoder) loadPrivateKey() (*encoderPrivateKey, error) {
+	ring, err := e.loadKeyRing()
+	if err != nil {
+		return nil, err
+	}
+
+	// switch to the next key once it has activated
+	if ring.next != nil && !e.now().Before(ring.nextActivatesAt) {
+		return ring.next, nil
+	}
+	return ring.active, nil
+}
+
+func (e *StandardEncoder) loadKeyRing() (*encoderKeyRing, error) {
 	// First chech cache, if its there then great, use it!
-	if key, ok := e.getCachedPrivateKey(); ok {
-		return key, nil
+	if ring, ok := e.getCachedKeyRing(); ok {
+		return ring, nil
 	}
 
 	// Only allow one thread to refetch, parse and update the cache
@@ -115,33 +184,49 @@ func (e *StandardEncoder) loadPrivateKey() (*encoderPrivateKey, error) {
 	defer e.mu.Unlock()
 
 	// check the cache again in case another go routine just updated it
-	if key, ok := e.getCachedPrivateKey(); ok {
-		return key, nil
+	if ring, ok := e.getCachedKeyRing(); ok {
+		return ring, nil
 	}
 
 	// Call client retriever func
-	privateKey, kid := e.fetchPrivateKey()
+	keyRing := e.fetchKeyRing()
 
-	// check its valid by parsing the PEM key
-	encodingKey, err := e.parsePrivateKey(privateKey, kid)
+	// check its valid by parsing the PEM keys
+	ring := &encoderKeyRing{nextActivatesAt: keyRing.NextActivatesAt}
+	active, err := e.parsePrivateKey(keyRing.Active.PrivateKey, keyRing.Active.KeyID)
 	if err != nil {
 		return nil, err
 	}
+	ring.active = active
+
+	if keyRing.Next != nil {
+		next, err := e.parsePrivateKey(keyRing.Next.PrivateKey, keyRing.Next.KeyID)
+		if err != nil {
+			return nil, errors.Errorf("invalid next key: %w", err)
+		}
+		if next.kid == "" || next.kid == active.kid {
+			return nil, errors.Errorf("invalid next key: the key_id (kid) must be set and differ from the active key")
+		}
+		if keyRing.NextActivatesAt.IsZero() {
+			return nil, errors.Errorf("invalid next key: NextActivatesAt must be set")
+		}
+		ring.next = next
+	}
 
 	// Add back into the cache
-	err = e.cache.Add(privCacheKey, encodingKey, cache.DefaultExpiration)
-	return encodingKey, err
+	err = e.cache.Add(privCacheKey, ring, cache.DefaultExpiration)
+	return ring, err
 }
 
-func (e *StandardEncoder) getCachedPrivateKey() (*encoderPrivateKey, bool) {
+func (e *StandardEncoder) getCachedKeyRing() (*encoderKeyRing, bool) {
 	// First chech cache, if its there then great, use it!
 	obj, found := e.cache.Get(privCacheKey)
 	if !found {
 		return nil, false
 	}
 
-	key, ok := obj.(*encoderPrivateKey)
-	return key, ok
+	ring, ok := obj.(*encoderKeyRing)
+	return ring, ok
 }
 
 func (e *StandardEncoder) parsePrivateKey(privKey string, kid string) (*encoderPrivateKey, error) {
@@ -155,11 +240,11 @@ func (e *StandardEncoder) parsePrivateKey(privKey string, kid string) (*encoderP
 		}
 		switch ecdaPrivateKey.Curve {
 		case elliptic.P256():
-			edcdaKey.keyType = ecdsaKey256
+			edcdaKey.signingMethod = jwt.SigningMethodES256
 		case elliptic.P384():
-			edcdaKey.keyType = ecdsaKey384
+			edcdaKey.signingMethod = jwt.SigningMethodES384
 		default:
-			edcdaKey.keyType = ecdsaKey512
+			edcdaKey.signingMethod = jwt.SigningMethodES512
 		}
 
 		return edcdaKey, nil
@@ -169,11 +254,25 @@ func (e *StandardEncoder) parsePrivateKey(privKey string, kid string) (*encoderP
 	if err == nil {
 		return &encoderPrivateKey{
 			privateSigningKey: rsaPrivateKey,
-			keyType:           rsaKey,
+			signingMethod:     e.rsaSigningMethod,
+			kid:               kid,
+		}, nil
+	}
+
+	edPrivateKey, err := jwt.ParseEdPrivateKeyFromPEM(privatePEMKey)
+	if err == nil {
+		return &encoderPrivateKey{
+			privateSigningKey: edPrivateKey,
+			signingMethod:     jwt.SigningMethodEdDSA,
 			kid:               kid,
 		}, nil
 	}
 	// add other key types in the future
 
-	return nil, errors.Errorf("invalid private key: only ECDSA and RSA private keys are supported")
+	return nil, errors.Errorf("invalid private key: only ECDSA, EdDSA (Ed25519) and RSA private keys are supported")
+}
+
+// algorithm returns the "alg" the key signs with.
+func (k *encoderPrivateKey) algorithm() jwa.SignatureAlgorithm {
+	return jwa.SignatureAlgorithm(k.signingMethod.Alg())
 }
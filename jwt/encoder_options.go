@@ -18,3 +18,12 @@ func WithEncoderCacheExpiry(defaultExpiration, cleanupInterval time.Duration) En
 		encoder.cleanupInterval = cleanupInterval
 	}
 }
+
+// WithEncoderRSAAlgorithm sets the algorithm RSA private keys sign with, one of
+// RS256, RS384, RS512, PS256, PS384 or PS512. It doesn't affect ECDSA or EdDSA keys.
+// Default: RS512.
+func WithEncoderRSAAlgorithm(alg string) EncoderOption {
+	return func(encoder *StandardEncoder) {
+		encoder.rsaAlgorithm = alg
+	}
+}
@@ -46,3 +46,15 @@ func TestEncoderOptions(t *testing.T) {
 
 	assert.Greater(t, i, 1)
 }
+
+func TestEncoderRSAAlgorithmOption(t *testing.T) {
+	b, err := os.ReadFile(filepath.Clean(testRSA256PrivateKey))
+	assert.Nil(t, err)
+	privKey := string(b)
+
+	for _, alg := range []string{"ES256", "EdDSA", "HS256", "unknown"} {
+		encoder, err := NewEncoder(func() (string, string) { return privKey, "rsa-256" }, WithEncoderRSAAlgorithm(alg))
+		assert.ErrorContains(t, err, "invalid rsa algorithm: "+alg)
+		assert.Nil(t, encoder)
+	}
+}
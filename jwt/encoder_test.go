@@ -7,7 +7,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // useful to create RS256 test tokens https://jwt.io/
@@ -204,3 +206,109 @@ func TestEncoderECDSA(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyRingEncoder(t *testing.T) {
+	rsaKey, err := os.ReadFile(filepath.Clean(testRSA256PrivateKey))
+	require.Nil(t, err)
+	ecdsaKey, err := os.ReadFile(filepath.Clean(testECDSA256PrivateKey))
+	require.Nil(t, err)
+
+	activatesAt := time.Now().Add(time.Hour)
+	encoder, err := NewKeyRingEncoder(func() EncoderKeyRing {
+		return EncoderKeyRing{
+			Active:          EncoderKey{PrivateKey: string(rsaKey), KeyID: "active-key"},
+			Next:            &EncoderKey{PrivateKey: string(ecdsaKey), KeyID: "next-key"},
+			NextActivatesAt: activatesAt,
+		}
+	})
+	require.Nil(t, err)
+
+	// the decoder only needs the published JWKS
+	jwks, err := encoder.JWKS()
+	require.Nil(t, err)
+	assert.Contains(t, jwks, `"kid":"active-key"`)
+	assert.Contains(t, jwks, `"kid":"next-key"`)
+	assert.Contains(t, jwks, `"alg":"RS512"`)
+	assert.Contains(t, jwks, `"alg":"ES256"`)
+	assert.NotContains(t, jwks, `"d":`, "only the public keys are published")
+	decoder, err := NewDecoder(func() string { return jwks })
+	require.Nil(t, err)
+
+	testCases := []struct {
+		desc        string
+		now         time.Time
+		expectedKid string
+	}{
+		{
+			desc:        "Success 1: signs with the active key",
+			now:         activatesAt.Add(-time.Second),
+			expectedKid: "active-key",
+		},
+		{
+			desc:        "Success 2: signs with the next key once activated",
+			now:         activatesAt,
+			expectedKid: "next-key",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			encoder.now = func() time.Time { return tC.now }
+
+			token, err := encoder.Encode(&StandardClaims{AccountID: "abc123"})
+			require.Nil(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.Nil(t, err)
+			assert.Equal(t, tC.expectedKid, parsed.Header[kidHeaderKey])
+
+			claims, err := decoder.Decode(token)
+			require.Nil(t, err)
+			assert.Equal(t, "abc123", claims.AccountID)
+		})
+	}
+}
+
+func TestNewKeyRingEncoder_invalidNextKey(t *testing.T) {
+	rsaKey, err := os.ReadFile(filepath.Clean(testRSA256PrivateKey))
+	require.Nil(t, err)
+
+	activatesAt := time.Now().Add(time.Hour)
+
+	testCases := []struct {
+		desc           string
+		next           EncoderKey
+		activatesAt    time.Time
+		expectedErrMsg string
+	}{
+		{
+			desc:           "Error 1: bad key",
+			next:           EncoderKey{PrivateKey: "bad key", KeyID: "next-key"},
+			activatesAt:    activatesAt,
+			expectedErrMsg: "invalid next key",
+		},
+		{
+			desc:           "Error 2: same kid as the active key",
+			next:           EncoderKey{PrivateKey: string(rsaKey), KeyID: "active-key"},
+			activatesAt:    activatesAt,
+			expectedErrMsg: "must be set and differ from the active key",
+		},
+		{
+			desc:           "Error 3: no activation time",
+			next:           EncoderKey{PrivateKey: string(rsaKey), KeyID: "next-key"},
+			expectedErrMsg: "NextActivatesAt must be set",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			encoder, err := NewKeyRingEncoder(func() EncoderKeyRing {
+				return EncoderKeyRing{
+					Active:          EncoderKey{PrivateKey: string(rsaKey), KeyID: "active-key"},
+					Next:            &tC.next,
+					NextActivatesAt: tC.activatesAt,
+				}
+			})
+			assert.ErrorContains(t, err, tC.expectedErrMsg)
+			assert.Nil(t, encoder)
+		})
+	}
+}
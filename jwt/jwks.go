@@ -0,0 +1,229 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+const (
+	// JWKSPath is the well known path the JWKS is served on.
+	JWKSPath = "/.well-known/jwks.json"
+
+	defaultJWKSHandlerMaxAge = 15 * time.Minute
+)
+
+// JWKSKey is a PEM key to publish in a JWKS.
+type JWKSKey struct {
+	// PEM is the ECDSA, EdDSA (Ed25519) or RSA private or public PEM key. Only the
+	// public key is published.
+	PEM string
+	// KeyID is the "kid" (key_id) the key is published with.
+	KeyID string
+	// Algorithm is the "alg" the key signs with, which defaults to the one the
+	// StandardEncoder uses for the key by default: ES256, ES384 or ES512 for ECDSA
+	// keys by curve, EdDSA for Ed25519 keys, and RS512 for RSA keys.
+	Algorithm string // optional
+}
+
+// NewJWKS returns the JSON JWKS with the public keys for the PEM keys, with their
+// "kid", "alg" and "use" set, for the decoders to use.
+func NewJWKS(keys ...JWKSKey) (string, error) {
+	jwks := make([]jwk.Key, 0, len(keys))
+	for _, key := range keys {
+		if key.KeyID == "" {
+			return "", errors.Errorf("failed to create jwks: missing key_id (kid)")
+		}
+
+		rawKey, err := parsePEMKey(key.PEM)
+		if err != nil {
+			return "", errors.Errorf("failed to create jwks for kid %s: %w", key.KeyID, err)
+		}
+
+		alg := jwa.SignatureAlgorithm(key.Algorithm)
+		if alg == "" {
+			alg = defaultAlgorithm(rawKey)
+		}
+
+		pubKey, err := newPublicJWK(rawKey, key.KeyID, alg)
+		if err != nil {
+			return "", errors.Errorf("failed to create jwks for kid %s: %w", key.KeyID, err)
+		}
+		jwks = append(jwks, pubKey)
+	}
+
+	return marshalJWKS(jwks)
+}
+
+// NewJWKSHandler returns an http.Handler that serves the JWKS returned by the
+// func, such as StandardEncoder.JWKS, so the service can act as an issuer. Register
+// it on JWKSPath. Responses have Cache-Control and ETag headers so decoders, such
+// as the HTTPJwksRetriever, can cache them.
+//
+//	mux.Handle(jwt.JWKSPath, jwt.NewJWKSHandler(encoder.JWKS))
+func NewJWKSHandler(fetchJWKS func() (string, error), options ...JWKSHandlerOption) http.Handler {
+	h := &jwksHandler{
+		fetchJWKS: fetchJWKS,
+		maxAge:    defaultJWKSHandlerMaxAge,
+	}
+
+	// Loop through our options and apply them
+	for _, option := range options {
+		option(h)
+	}
+
+	return h
+}
+
+type jwksHandler struct {
+	fetchJWKS func() (string, error)
+	maxAge    time.Duration
+}
+
+// JWKSHandlerOption function signature for adding JWKS handler options.
+type JWKSHandlerOption func(*jwksHandler)
+
+// WithJWKSHandlerMaxAge sets the "max-age" decoders can cache the JWKS for. It
+// should be less than the time a new key is published before it is used.
+// Default: 15 minutes.
+func WithJWKSHandlerMaxAge(maxAge time.Duration) JWKSHandlerOption {
+	return func(h *jwksHandler) {
+		h.maxAge = maxAge
+	}
+}
+
+func (h *jwksHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = w.Write([]byte(`{"errors":[{"status":"405","title":"Method Not Allowed"}]}`))
+		return
+	}
+
+	jwks, err := h.fetchJWKS()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"errors":[{"status":"500","title":"Internal Server Error"}]}`))
+		return
+	}
+
+	sum := sha256.Sum256([]byte(jwks))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if req.Method == http.MethodGet {
+		_, _ = w.Write([]byte(jwks))
+	}
+}
+
+// parsePEMKey parses an ECDSA, EdDSA or RSA private or public PEM key.
+func parsePEMKey(pemKey string) (interface{}, error) {
+	b := []byte(pemKey)
+
+	if key, err := jwt.ParseECPrivateKeyFromPEM(b); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM(b); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(b); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(b); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseEdPrivateKeyFromPEM(b); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(b); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.Errorf("invalid key: only ECDSA, EdDSA (Ed25519) and RSA private or public keys are supported")
+}
+
+// defaultAlgorithm returns the "alg" the StandardEncoder signs with for the key.
+func defaultAlgorithm(rawKey interface{}) jwa.SignatureAlgorithm {
+	var curve elliptic.Curve
+	switch key := rawKey.(type) {
+	case *ecdsa.PrivateKey:
+		curve = key.Curve
+	case *ecdsa.PublicKey:
+		curve = key.Curve
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return jwa.RS512
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return jwa.EdDSA
+	}
+
+	switch curve {
+	case elliptic.P256():
+		return jwa.ES256
+	case elliptic.P384():
+		return jwa.ES384
+	default:
+		return jwa.ES512
+	}
+}
+
+// newPublicJWK returns the public key as a JWK with the "kid", "alg" and "use" set.
+func newPublicJWK(rawKey interface{}, kid string, alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	key, err := jwk.FromRaw(rawKey)
+	if err != nil {
+		return nil, errors.Errorf("failed to create jwk: %w", err)
+	}
+	pubKey, err := key.PublicKey()
+	if err != nil {
+		return nil, errors.Errorf("failed to create public jwk: %w", err)
+	}
+
+	if kid != "" {
+		if err := pubKey.Set(jwk.KeyIDKey, kid); err != nil {
+			return nil, errors.Errorf("failed to set jwk kid: %w", err)
+		}
+	}
+	if err := pubKey.Set(jwk.AlgorithmKey, alg); err != nil {
+		return nil, errors.Errorf("failed to set jwk alg: %w", err)
+	}
+	if err := pubKey.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, errors.Errorf("failed to set jwk use: %w", err)
+	}
+
+	return pubKey, nil
+}
+
+func marshalJWKS(keys []jwk.Key) (string, error) {
+	set := jwk.NewSet()
+	for _, key := range keys {
+		if err := set.AddKey(key); err != nil {
+			return "", errors.Errorf("failed to add public key to jwks: %w", err)
+		}
+	}
+
+	b, err := json.Marshal(set)
+	if err != nil {
+		return "", errors.Errorf("failed to marshal jwks: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-errors/errors"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewJWKS(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		key            string
+		algorithm      string
+		expectedAlg    string
+		expectedErrMsg string
+	}{
+		{
+			desc:        "Success 1: RSA private key",
+			key:         testRSA256PrivateKey,
+			expectedAlg: "RS512",
+		},
+		{
+			desc:        "Success 2: RSA public key with algorithm",
+			key:         testRSA256PrivateKey + ".pub",
+			algorithm:   "RS256",
+			expectedAlg: "RS256",
+		},
+		{
+			desc:        "Success 3: ECDSA 256 private key",
+			key:         testECDSA256PrivateKey,
+			expectedAlg: "ES256",
+		},
+		{
+			desc:        "Success 4: ECDSA 384 public key",
+			key:         testECDSA384PrivateKey + ".pub",
+			expectedAlg: "ES384",
+		},
+		{
+			desc:        "Success 5: ECDSA 521 private key",
+			key:         testECDSA521PrivateKey,
+			expectedAlg: "ES512",
+		},
+		{
+			desc:        "Success 6: Ed25519 public key",
+			key:         testEd25519PrivateKey + ".pub",
+			expectedAlg: "EdDSA",
+		},
+		{
+			desc:           "Error 1: bad key",
+			expectedErrMsg: "invalid key",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var pem []byte
+			if tC.key != "" {
+				var err error
+				pem, err = os.ReadFile(filepath.Clean(tC.key))
+				require.Nil(t, err)
+			}
+
+			jwks, err := NewJWKS(JWKSKey{PEM: string(pem), KeyID: "some-kid", Algorithm: tC.algorithm})
+			if tC.expectedErrMsg != "" {
+				assert.ErrorContains(t, err, tC.expectedErrMsg)
+				return
+			}
+			require.Nil(t, err)
+
+			set, err := jwk.ParseString(jwks)
+			require.Nil(t, err)
+			key, ok := set.LookupKeyID("some-kid")
+			require.True(t, ok)
+			assert.Equal(t, tC.expectedAlg, key.Algorithm().String())
+			assert.Equal(t, "sig", key.KeyUsage())
+			assert.NotContains(t, jwks, `"d":`, "only the public key is published")
+		})
+	}
+}
+
+func TestNewJWKS_decode(t *testing.T) {
+	pem, err := os.ReadFile(filepath.Clean(testRSA256PrivateKey + ".pub"))
+	require.Nil(t, err)
+	jwks, err := NewJWKS(JWKSKey{PEM: string(pem), KeyID: "rsa-256"})
+	require.Nil(t, err)
+
+	decoder, err := NewDecoder(func() string { return jwks })
+	require.Nil(t, err)
+	claims, err := decoder.Decode(encodeTestToken(t, &StandardClaims{AccountID: "abc123"}))
+	require.Nil(t, err)
+	assert.Equal(t, "abc123", claims.AccountID)
+
+	_, err = NewJWKS(JWKSKey{PEM: string(pem)})
+	assert.ErrorContains(t, err, "missing key_id")
+}
+
+func TestNewJWKSHandler(t *testing.T) {
+	encoder, _ := newTestEncoderDecoder(t)
+	jwks, err := encoder.JWKS()
+	require.Nil(t, err)
+
+	server := httptest.NewServer(NewJWKSHandler(encoder.JWKS))
+	defer server.Close()
+
+	// decoders can use it with the HTTPJwksRetriever
+	retriever := NewHTTPJwksRetriever(server.URL+JWKSPath, WithHTTPJwksClient(server.Client()))
+	assert.Equal(t, jwks, retriever.Retrieve())
+	assert.Equal(t, jwks, retriever.Refresh(), "revalidated using the etag")
+	assert.Nil(t, retriever.Err())
+
+	resp, err := http.Get(server.URL + JWKSPath)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "public, max-age=900", resp.Header.Get("Cache-Control"))
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+
+	resp, err = http.Post(server.URL+JWKSPath, "application/json", nil)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestNewJWKSHandler_error(t *testing.T) {
+	handler := NewJWKSHandler(func() (string, error) { return "", errors.Errorf("no keys") }, WithJWKSHandlerMaxAge(0))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, JWKSPath, nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.JSONEq(t, `{"errors":[{"status":"500","title":"Internal Server Error"}]}`, rec.Body.String())
+	assert.Empty(t, rec.Header().Get("Cache-Control"), "errors are not cached")
+}
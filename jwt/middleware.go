@@ -0,0 +1,235 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-errors/errors"
+	goa "goa.design/goa/v3/pkg"
+	"goa.design/goa/v3/security"
+
+	"github.com/cultureamp/ca-go/log"
+	"github.com/cultureamp/ca-go/request"
+)
+
+const (
+	authorizationHeader               = "Authorization"
+	serviceGatewayAuthorizationHeader = "X-CA-SGW-Authorization"
+	bearerScheme                      = "bearer "
+)
+
+// ErrMissingToken is returned when the request doesn't have a token in any of the
+// authorization headers.
+var ErrMissingToken = errors.Errorf("missing authorization token")
+
+type claimsContextKey struct{}
+
+// OnUnauthorizedHandler is a function that can be supplied to the HTTP middleware
+// to write the response when a request isn't authenticated.
+type OnUnauthorizedHandler func(context.Context, http.ResponseWriter, error)
+
+// defaultUnauthorizedHandler writes a JSON:API style error response with a
+// 401 status code.
+func defaultUnauthorizedHandler(_ context.Context, w http.ResponseWriter, _ error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	_, _ = w.Write([]byte(`{"errors":[{"status":"401","title":"Unauthorized"}]}`))
+}
+
+type httpMiddleware struct {
+	decoder        Decoder
+	headers        []string
+	parserOptions  []DecoderParserOption
+	optional       bool
+	onUnauthorized OnUnauthorizedHandler
+}
+
+// HTTPMiddlewareOption function signature for adding HTTP middleware options.
+type HTTPMiddlewareOption func(*httpMiddleware)
+
+// WithHTTPMiddlewareHeaders sets the request headers the token is read from, in
+// order of preference. A "Bearer " prefix is removed from the header value.
+// Default: "X-CA-SGW-Authorization" then "Authorization".
+func WithHTTPMiddlewareHeaders(headers ...string) HTTPMiddlewareOption {
+	return func(m *httpMiddleware) {
+		m.headers = headers
+	}
+}
+
+// WithHTTPMiddlewareParserOptions sets the options used to decode the token, such
+// as MustMatchAudience and MustMatchIssuer.
+func WithHTTPMiddlewareParserOptions(options ...DecoderParserOption) HTTPMiddlewareOption {
+	return func(m *httpMiddleware) {
+		m.parserOptions = append(m.parserOptions, options...)
+	}
+}
+
+// WithHTTPMiddlewareOptional lets requests without a token through without an
+// authenticated user in their context. Requests with an invalid token are still
+// rejected.
+func WithHTTPMiddlewareOptional() HTTPMiddlewareOption {
+	return func(m *httpMiddleware) {
+		m.optional = true
+	}
+}
+
+// WithHTTPMiddlewareOnUnauthorized sets the handler called to write the response
+// when a request isn't authenticated. Default: a JSON:API structured body with
+// status 401.
+func WithHTTPMiddlewareOnUnauthorized(handler OnUnauthorizedHandler) HTTPMiddlewareOption {
+	return func(m *httpMiddleware) {
+		m.onUnauthorized = handler
+	}
+}
+
+// NewHTTPMiddleware returns an http.Handler that decodes the token in the request
+// authorization header, and adds the claims to the request context, along with
+// the request.AuthenticatedUser and a logger with the log.AuthPayload (see
+// ContextWithClaims). If the decoder is nil the package level Decode is used.
+//
+// Requests without a valid token are rejected with the OnUnauthorizedHandler.
+func NewHTTPMiddleware(decoder Decoder, options ...HTTPMiddlewareOption) func(http.Handler) http.Handler {
+	m := &httpMiddleware{
+		decoder:        decoder,
+		headers:        []string{serviceGatewayAuthorizationHeader, authorizationHeader},
+		onUnauthorized: defaultUnauthorizedHandler,
+	}
+
+	// Loop through our options and apply them
+	for _, option := range options {
+		option(m)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+
+			token := m.token(req)
+			if token == "" {
+				if m.optional {
+					next.ServeHTTP(w, req)
+					return
+				}
+				m.onUnauthorized(ctx, w, ErrMissingToken)
+				return
+			}
+
+			claims, err := m.decode(token)
+			if err != nil {
+				m.onUnauthorized(ctx, w, err)
+				return
+			}
+
+			next.ServeHTTP(w, req.WithContext(ContextWithClaims(ctx, claims)))
+		})
+	}
+}
+
+// NewGoaJWTAuth returns the JWTAuth function of a Goa service using JWT security,
+// which decodes the token and adds the claims to the context like
+// NewHTTPMiddleware. The token's `scope` claim must include the scopes required
+// by the endpoint. If the decoder is nil the package level Decode is used.
+//
+// Invalid tokens are rejected with an "unauthorized" goa.ServiceError, and
+// tokens without the required scopes with a "forbidden" one.
+func NewGoaJWTAuth(decoder Decoder, options ...DecoderParserOption) security.AuthJWTFunc {
+	m := &httpMiddleware{
+		decoder:       decoder,
+		parserOptions: options,
+	}
+
+	return func(ctx context.Context, token string, schema *security.JWTScheme) (context.Context, error) {
+		token = trimBearer(token)
+		if token == "" {
+			return ctx, goa.NewServiceError(ErrMissingToken, "unauthorized", false, false, false)
+		}
+
+		claims, err := m.decode(token)
+		if err != nil {
+			return ctx, goa.NewServiceError(err, "unauthorized", false, false, false)
+		}
+
+		if schema != nil {
+			if err := schema.Validate(claims.Scopes); err != nil {
+				return ctx, goa.NewServiceError(err, "forbidden", false, false, false)
+			}
+		}
+
+		return ContextWithClaims(ctx, claims), nil
+	}
+}
+
+// NewGoaRequireClaimsMiddleware returns Goa middleware that rejects requests
+// without claims in their context with an "unauthorized" error. It doesn't read
+// or verify the token itself: it is a guard that relies on NewHTTPMiddleware
+// running first, in optional mode, to require authentication for some services
+// only.
+func NewGoaRequireClaimsMiddleware() func(goa.Endpoint) goa.Endpoint {
+	return func(next goa.Endpoint) goa.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if _, ok := ClaimsFromContext(ctx); !ok {
+				return nil, goa.NewServiceError(ErrMissingToken, "unauthorized", false, false, false)
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// ContextWithClaims returns a new context with the claims embedded as a value,
+// along with the request.AuthenticatedUser and a logger with the log.AuthPayload.
+// The logger is a child of the logger already in the context, if any.
+func ContextWithClaims(parent context.Context, claims *StandardClaims) context.Context {
+	ctx := context.WithValue(parent, claimsContextKey{}, claims)
+	ctx = request.ContextWithAuthenticatedUser(ctx, request.AuthenticatedUser{
+		CustomerAccountID: claims.AccountID,
+		UserID:            claims.EffectiveUserID,
+		RealUserID:        claims.RealUserID,
+	})
+
+	ctx, logger, err := log.FromContext(ctx)
+	if err != nil {
+		return ctx
+	}
+	return log.ContextWithLogger(ctx, logger.Child(log.WithAuthenticatedUserTracing(&log.AuthPayload{
+		CustomerAccountID: claims.AccountID,
+		UserID:            claims.EffectiveUserID,
+		RealUserID:        claims.RealUserID,
+	})))
+}
+
+// ClaimsFromContext attempts to retrieve the claims from the given context,
+// returning the claims along with a boolean signalling whether the retrieval
+// was successful.
+func ClaimsFromContext(ctx context.Context) (*StandardClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*StandardClaims)
+	return claims, ok
+}
+
+// token returns the token from the first authorization header that is set.
+func (m *httpMiddleware) token(req *http.Request) string {
+	for _, header := range m.headers {
+		if value := trimBearer(req.Header.Get(header)); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// trimBearer removes any "Bearer " prefix from the header value.
+func trimBearer(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > len(bearerScheme) && strings.EqualFold(value[:len(bearerScheme)], bearerScheme) {
+		value = strings.TrimSpace(value[len(bearerScheme):])
+	}
+	return value
+}
+
+func (m *httpMiddleware) decode(token string) (*StandardClaims, error) {
+	if m.decoder == nil {
+		return Decode(token, m.parserOptions...)
+	}
+	return m.decoder.Decode(token, m.parserOptions...)
+}
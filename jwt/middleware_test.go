@@ -0,0 +1,294 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	goa "goa.design/goa/v3/pkg"
+	"goa.design/goa/v3/security"
+
+	"github.com/cultureamp/ca-go/log"
+	"github.com/cultureamp/ca-go/request"
+)
+
+func TestNewHTTPMiddleware(t *testing.T) {
+	decoder, err := NewDecoder(func() string { return readTestJwks(t) })
+	require.Nil(t, err)
+
+	token := encodeTestToken(t, &StandardClaims{
+		AccountID:       "abc123",
+		RealUserID:      "xyz234",
+		EffectiveUserID: "xyz345",
+		Issuer:          "encoder-name",
+		Audience:        []string{"decoder-name"},
+	})
+
+	testCases := []struct {
+		desc           string
+		headers        map[string]string
+		options        []HTTPMiddlewareOption
+		expectedStatus int
+		expectedUser   bool
+	}{
+		{
+			desc:           "Success 1: bearer token in the authorization header",
+			headers:        map[string]string{"Authorization": "Bearer " + token},
+			expectedStatus: http.StatusOK,
+			expectedUser:   true,
+		},
+		{
+			desc:           "Success 2: token in the service gateway header",
+			headers:        map[string]string{"X-CA-SGW-Authorization": token, "Authorization": "Bearer bad-token"},
+			expectedStatus: http.StatusOK,
+			expectedUser:   true,
+		},
+		{
+			desc:           "Success 3: matching audience and issuer",
+			headers:        map[string]string{"Authorization": "Bearer " + token},
+			options:        []HTTPMiddlewareOption{WithHTTPMiddlewareParserOptions(MustMatchAudience("decoder-name"), MustMatchIssuer("encoder-name"))},
+			expectedStatus: http.StatusOK,
+			expectedUser:   true,
+		},
+		{
+			desc:           "Success 4: custom header",
+			headers:        map[string]string{"X-Token": token},
+			options:        []HTTPMiddlewareOption{WithHTTPMiddlewareHeaders("X-Token")},
+			expectedStatus: http.StatusOK,
+			expectedUser:   true,
+		},
+		{
+			desc:           "Success 5: optional without a token",
+			options:        []HTTPMiddlewareOption{WithHTTPMiddlewareOptional()},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			desc:           "Fail 1: missing token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:           "Fail 2: invalid token",
+			headers:        map[string]string{"Authorization": "Bearer bad-token"},
+			options:        []HTTPMiddlewareOption{WithHTTPMiddlewareOptional()},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			desc:           "Fail 3: wrong audience",
+			headers:        map[string]string{"Authorization": "Bearer " + token},
+			options:        []HTTPMiddlewareOption{WithHTTPMiddlewareParserOptions(MustMatchAudience("someone-else"))},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var user request.AuthenticatedUser
+			var hasUser bool
+			handler := NewHTTPMiddleware(decoder, tC.options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, hasUser = request.AuthenticatedUserFromContext(r.Context())
+				claims, hasClaims := ClaimsFromContext(r.Context())
+				assert.Equal(t, hasUser, hasClaims)
+				if hasClaims {
+					assert.Equal(t, "abc123", claims.AccountID)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tC.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tC.expectedStatus, rec.Code)
+			assert.Equal(t, tC.expectedUser, hasUser)
+			if tC.expectedUser {
+				assert.Equal(t, request.AuthenticatedUser{
+					CustomerAccountID: "abc123",
+					UserID:            "xyz345",
+					RealUserID:        "xyz234",
+				}, user)
+			}
+			if tC.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+				assert.JSONEq(t, `{"errors":[{"status":"401","title":"Unauthorized"}]}`, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewHTTPMiddleware_onUnauthorized(t *testing.T) {
+	decoder, err := NewDecoder(func() string { return readTestJwks(t) })
+	require.Nil(t, err)
+
+	var unauthorizedErr error
+	handler := NewHTTPMiddleware(decoder, WithHTTPMiddlewareOnUnauthorized(func(ctx context.Context, w http.ResponseWriter, err error) {
+		unauthorizedErr = err
+		w.WriteHeader(http.StatusForbidden)
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.ErrorIs(t, unauthorizedErr, ErrMissingToken)
+}
+
+func TestNewGoaJWTAuth(t *testing.T) {
+	decoder, err := NewDecoder(func() string { return readTestJwks(t) })
+	require.Nil(t, err)
+
+	token := encodeTestToken(t, &StandardClaims{
+		AccountID:       "abc123",
+		RealUserID:      "xyz234",
+		EffectiveUserID: "xyz345",
+		Audience:        []string{"decoder-name"},
+		Scopes:          []string{"read", "write"},
+	})
+
+	testCases := []struct {
+		desc          string
+		token         string
+		options       []DecoderParserOption
+		scopes        []string
+		expectedError string
+	}{
+		{
+			desc:   "Success 1: valid token",
+			token:  token,
+			scopes: []string{"read"},
+		},
+		{
+			desc:    "Success 2: bearer token with matching audience",
+			token:   "Bearer " + token,
+			options: []DecoderParserOption{MustMatchAudience("decoder-name")},
+		},
+		{
+			desc:          "Fail 1: missing token",
+			expectedError: "unauthorized",
+		},
+		{
+			desc:          "Fail 2: invalid token",
+			token:         "bad-token",
+			expectedError: "unauthorized",
+		},
+		{
+			desc:          "Fail 3: wrong audience",
+			token:         token,
+			options:       []DecoderParserOption{MustMatchAudience("someone-else")},
+			expectedError: "unauthorized",
+		},
+		{
+			desc:          "Fail 4: missing scope",
+			token:         token,
+			scopes:        []string{"admin"},
+			expectedError: "forbidden",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			auth := NewGoaJWTAuth(decoder, tC.options...)
+			ctx, err := auth(context.Background(), tC.token, &security.JWTScheme{RequiredScopes: tC.scopes})
+
+			claims, ok := ClaimsFromContext(ctx)
+			if tC.expectedError != "" {
+				var serviceErr *goa.ServiceError
+				require.ErrorAs(t, err, &serviceErr)
+				assert.Equal(t, tC.expectedError, serviceErr.Name)
+				assert.False(t, ok)
+				return
+			}
+
+			require.Nil(t, err)
+			require.True(t, ok)
+			assert.Equal(t, "abc123", claims.AccountID)
+			user, ok := request.AuthenticatedUserFromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, "xyz345", user.UserID)
+		})
+	}
+}
+
+func TestNewGoaRequireClaimsMiddleware(t *testing.T) {
+	endpoint := NewGoaRequireClaimsMiddleware()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+
+	_, err := endpoint(context.Background(), nil)
+	var serviceErr *goa.ServiceError
+	require.ErrorAs(t, err, &serviceErr)
+	assert.Equal(t, "unauthorized", serviceErr.Name)
+
+	ctx := ContextWithClaims(context.Background(), &StandardClaims{AccountID: "abc123"})
+	res, err := endpoint(ctx, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", res)
+}
+
+func TestContextWithClaims_logger(t *testing.T) {
+	claims := &StandardClaims{AccountID: "abc123"}
+
+	// adds a logger when the context doesn't have one
+	ctx := ContextWithClaims(context.Background(), claims)
+	loggerCtx, _, err := log.FromContext(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, ctx, loggerCtx)
+
+	// adds a child of the logger already in the context
+	config, err := log.NewLoggerConfig()
+	require.Nil(t, err)
+	logger := log.NewLogger(config)
+	ctx = ContextWithClaims(logger.WithContext(context.Background()), claims)
+	_, got, err := log.FromContext(ctx)
+	require.Nil(t, err)
+	assert.NotEqual(t, logger, got)
+}
+
+func ExampleContextWithClaims() {
+	config, _ := log.NewLoggerConfig()
+	config.AppName = "jwt-test"
+	config.AwsRegion = "dev"
+	config.AwsAccountID = "development"
+	config.Farm = "local"
+	config.Product = "cago"
+	config.LogLevel = "INFO"
+	config.Quiet = false
+	config.ConsoleWriter = true
+	config.ConsoleColour = false
+	config.TimeNow = func() time.Time {
+		return time.Date(2020, 11, 14, 11, 30, 32, 0, time.UTC)
+	}
+	logger := log.NewLogger(config, log.WithProperties(log.Add().Str("request", "some-request")))
+
+	// eg. a request logger added by earlier middleware
+	ctx := logger.WithContext(context.Background())
+	ctx = ContextWithClaims(ctx, &StandardClaims{
+		AccountID:       "abc123",
+		RealUserID:      "xyz234",
+		EffectiveUserID: "xyz345",
+	})
+
+	_, logger2, _ := log.FromContext(ctx)
+	logger2.Info("authenticated").Send()
+
+	// Output:
+	// 2020-11-14T11:30:32Z INF app=jwt-test app_version=1.0.0 authentication={"account_id":"abc123","realuser_id":"xyz234","user_id":"xyz345"} aws_account_id=development aws_region=dev default_properties={"request":"some-request"} event=authenticated farm=local product=cago
+}
+
+func encodeTestToken(t *testing.T, claims *StandardClaims) string {
+	b, err := os.ReadFile(filepath.Clean(testRSA256PrivateKey))
+	require.Nil(t, err)
+	encoder, err := NewEncoder(func() (string, string) { return string(b), "rsa-256" })
+	require.Nil(t, err)
+
+	claims.ExpiresAt = time.Now().Add(time.Hour)
+	token, err := encoder.Encode(claims)
+	require.Nil(t, err)
+	return token
+}
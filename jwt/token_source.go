@@ -0,0 +1,166 @@
+package jwt
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	defaultTokenSourceLifetime      = defaultExpiresAt
+	defaultTokenSourceRefreshBefore = 1 * time.Minute
+)
+
+// TokenSource mints short lived service tokens for calling another service, and
+// caches each token until shortly before it expires. It is safe for concurrent use.
+type TokenSource struct {
+	encoder       Encoder        // nil uses the package level Encode
+	claims        StandardClaims // template for each token, eg. the Audience and Subject
+	lifetime      time.Duration  // default is 10 minutes
+	refreshBefore time.Duration  // default is 1 minute
+	now           func() time.Time
+
+	mu        sync.Mutex // only allow one token to be minted at a time
+	token     string
+	refreshAt time.Time
+}
+
+// TokenSourceOption function signature for adding TokenSource options.
+type TokenSourceOption func(*TokenSource)
+
+// WithTokenSourceLifetime sets how long each token is valid for.
+// Default: 10 minutes.
+func WithTokenSourceLifetime(lifetime time.Duration) TokenSourceOption {
+	return func(s *TokenSource) {
+		s.lifetime = lifetime
+	}
+}
+
+// WithTokenSourceRefreshBefore sets how long before a token expires that a new
+// one is minted, to allow for clock skew and the time taken by the request. It is
+// capped at half the token lifetime.
+// Default: 1 minute.
+func WithTokenSourceRefreshBefore(refreshBefore time.Duration) TokenSourceOption {
+	return func(s *TokenSource) {
+		s.refreshBefore = refreshBefore
+	}
+}
+
+// NewTokenSource creates a new TokenSource that mints tokens with the encoder, or
+// the package level Encode if the encoder is nil. Each token has the claims, such
+// as the target Audience and Subject, with the ExpiresAt, NotBefore and IssuedAt
+// claims set when it is minted.
+func NewTokenSource(encoder Encoder, claims StandardClaims, options ...TokenSourceOption) *TokenSource {
+	s := &TokenSource{
+		encoder:       encoder,
+		claims:        claims,
+		lifetime:      defaultTokenSourceLifetime,
+		refreshBefore: defaultTokenSourceRefreshBefore,
+		now:           time.Now,
+	}
+
+	// Loop through our options and apply them
+	for _, option := range options {
+		option(s)
+	}
+
+	s.refreshBefore = min(s.refreshBefore, s.lifetime/2)
+	return s
+}
+
+// Token returns the cached token, or mints a new one if it is about to expire.
+func (s *TokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.token != "" && now.Before(s.refreshAt) {
+		return s.token, nil
+	}
+
+	claims := s.claims
+	claims.IssuedAt = now
+	claims.NotBefore = now
+	claims.ExpiresAt = now.Add(s.lifetime)
+
+	token, err := s.encode(&claims)
+	if err != nil {
+		return "", errors.Errorf("failed to mint service token: %w", err)
+	}
+
+	s.token = token
+	s.refreshAt = claims.ExpiresAt.Add(-s.refreshBefore)
+	return token, nil
+}
+
+func (s *TokenSource) encode(claims *StandardClaims) (string, error) {
+	if s.encoder == nil {
+		return Encode(claims)
+	}
+	return s.encoder.Encode(claims)
+}
+
+// TokenTransport is an http.RoundTripper that adds a service token from a
+// TokenSource to each outgoing request.
+type TokenTransport struct {
+	source *TokenSource
+	base   http.RoundTripper // default is http.DefaultTransport
+	header string            // default is "X-CA-SGW-Authorization"
+}
+
+// TokenTransportOption function signature for adding TokenTransport options.
+type TokenTransportOption func(*TokenTransport)
+
+// WithTokenTransportBase sets the http.RoundTripper that sends the requests.
+// Default: http.DefaultTransport.
+func WithTokenTransportBase(base http.RoundTripper) TokenTransportOption {
+	return func(t *TokenTransport) {
+		t.base = base
+	}
+}
+
+// WithTokenTransportHeader sets the request header the "Bearer" token is added to.
+// Default: "X-CA-SGW-Authorization".
+func WithTokenTransportHeader(header string) TokenTransportOption {
+	return func(t *TokenTransport) {
+		t.header = header
+	}
+}
+
+// NewTokenTransport creates a new TokenTransport that adds tokens from the source.
+//
+//	client := &http.Client{Transport: jwt.NewTokenTransport(source)}
+func NewTokenTransport(source *TokenSource, options ...TokenTransportOption) *TokenTransport {
+	t := &TokenTransport{
+		source: source,
+		base:   http.DefaultTransport,
+		header: serviceGatewayAuthorizationHeader,
+	}
+
+	// Loop through our options and apply them
+	for _, option := range options {
+		option(t)
+	}
+
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token()
+	if err != nil {
+		// a RoundTripper must always close the body, even on errors
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(t.header, "Bearer "+token)
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,122 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSource(t *testing.T) {
+	encoder, decoder := newTestEncoderDecoder(t)
+
+	source := NewTokenSource(encoder, StandardClaims{
+		Issuer:   "my-service",
+		Subject:  "my-service",
+		Audience: []string{"other-service"},
+	}, WithTokenSourceLifetime(5*time.Minute))
+
+	now := time.Now()
+	source.now = func() time.Time { return now }
+
+	token, err := source.Token()
+	require.Nil(t, err)
+
+	claims, err := decoder.Decode(token, MustMatchAudience("other-service"))
+	require.Nil(t, err)
+	assert.Equal(t, "my-service", claims.Subject)
+	assert.Equal(t, now.Add(5*time.Minute).Unix(), claims.ExpiresAt.Unix())
+
+	// cached until shortly before it expires
+	now = now.Add(3 * time.Minute)
+	cached, err := source.Token()
+	require.Nil(t, err)
+	assert.Equal(t, token, cached)
+
+	now = now.Add(time.Minute)
+	refreshed, err := source.Token()
+	require.Nil(t, err)
+	assert.NotEqual(t, token, refreshed)
+}
+
+func TestTokenSource_concurrent(t *testing.T) {
+	encoder, _ := newTestEncoderDecoder(t)
+	source := NewTokenSource(encoder, StandardClaims{Audience: []string{"other-service"}})
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token()
+			assert.Nil(t, err)
+			tokens[i] = token
+		}()
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		assert.Equal(t, tokens[0], token)
+	}
+}
+
+func TestTokenTransport(t *testing.T) {
+	encoder, decoder := newTestEncoderDecoder(t)
+	source := NewTokenSource(encoder, StandardClaims{Audience: []string{"other-service"}})
+
+	testCases := []struct {
+		desc    string
+		options []TokenTransportOption
+		header  string
+	}{
+		{
+			desc:   "Success 1: service gateway header",
+			header: "X-CA-SGW-Authorization",
+		},
+		{
+			desc:    "Success 2: authorization header",
+			options: []TokenTransportOption{WithTokenTransportHeader("Authorization")},
+			header:  "Authorization",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			server := httptest.NewServer(NewHTTPMiddleware(decoder,
+				WithHTTPMiddlewareHeaders(tC.header),
+				WithHTTPMiddlewareParserOptions(MustMatchAudience("other-service")),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+			defer server.Close()
+
+			options := append([]TokenTransportOption{WithTokenTransportBase(server.Client().Transport)}, tC.options...)
+			client := &http.Client{Transport: NewTokenTransport(source, options...)}
+
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.Nil(t, err)
+			resp, err := client.Do(req)
+			require.Nil(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Empty(t, req.Header.Get(tC.header), "the request is not modified")
+		})
+	}
+}
+
+func newTestEncoderDecoder(t *testing.T) (*StandardEncoder, *StandardDecoder) {
+	b, err := os.ReadFile(filepath.Clean(testRSA256PrivateKey))
+	require.Nil(t, err)
+	encoder, err := NewEncoder(func() (string, string) { return string(b), "rsa-256" })
+	require.Nil(t, err)
+
+	decoder, err := NewDecoder(func() string { return readTestJwks(t) })
+	require.Nil(t, err)
+
+	return encoder, decoder
+}
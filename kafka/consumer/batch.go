@@ -0,0 +1,123 @@
+package consumer
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	consumerBatchSize   = 100
+	consumerBatchLinger = time.Second
+)
+
+// BatchHandler specifies how a consumer should handle a batch of received Kafka
+// messages.
+type BatchHandler func(ctx context.Context, msgs []Message) error
+
+// RunBatch consumes and handles messages from the topic in batches. A batch is
+// handled once it reaches the max batch size, or the max linger time has passed
+// since its first message was received (see WithBatching). The method call blocks
+// until the context is canceled, the consumer is stopped, or an error occurs.
+//
+// Offsets for the whole batch are committed only after the handler succeeds,
+// regardless of WithExplicitCommit. Any handler retry back off applies to the
+// whole batch, and if a dead letter topic is set every message in a failed batch
+// is published to it. Middleware set with WithMiddleware is not used, as it wraps
+// a Handler rather than a BatchHandler.
+func (c *Consumer) RunBatch(ctx context.Context, handler BatchHandler) (err error) {
+	c.conf.Logger.Printf(
+		"consumer(%s:%s): running in batches until context is cancelled, an error occurs, or the consumer is stopped",
+		c.conf.Topic,
+		c.id,
+	)
+
+	ctx, end := c.begin(ctx)
+	defer func() { end(err) }()
+
+	fetchCtx, cancel := c.fetchContext(ctx)
+	defer cancel()
+
+	// Run forever until we read from the stopCh or we have an error processing a batch
+	for {
+		select {
+		case <-c.stopCh:
+			c.conf.Logger.Printf(
+				"consumer(%s:%s): stopped signal received",
+				c.conf.Topic,
+				c.id,
+			)
+			return nil
+		default:
+		}
+
+		if err := c.retrieveNextBatch(ctx, fetchCtx, handler); err != nil {
+			return errors.Errorf("consumer error: %w", err)
+		}
+	}
+}
+
+func (c *Consumer) retrieveNextBatch(ctx, fetchCtx context.Context, handler BatchHandler) error {
+	msgs, generations, err := c.fetchBatch(ctx, fetchCtx)
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	defer c.gate.done(len(msgs))
+
+	if due, err := c.waitUntilDue(ctx, c.stopCh, msgs...); !due {
+		return err
+	}
+
+	if err = c.clientHandler.dispatchBatch(ctx, msgs, generations, handler); err != nil {
+		return errors.Errorf("unable to handle batch: %w", err)
+	}
+
+	if err = c.reader.CommitMessages(ctx, msgs...); err != nil {
+		return errors.Errorf("unable to commit batch: %w", c.commitFailed(msgs, err))
+	}
+
+	return nil
+}
+
+// fetchBatch blocks until the first message is fetched, then keeps fetching
+// until the batch is full, the linger time has passed, or the consumer is stopped.
+// It returns the messages along with the generation each was fetched in.
+func (c *Consumer) fetchBatch(ctx, fetchCtx context.Context) ([]kafka.Message, []int, error) {
+	msg, generation, err := c.gatedFetch(fetchCtx, c.reader.FetchMessage)
+	if err != nil {
+		if errors.Is(err, io.EOF) || c.stoppedFetching(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, errors.Errorf("unable to fetch message: %w", err)
+	}
+
+	msgs := make([]kafka.Message, 0, c.batchSize)
+	msgs = append(msgs, msg)
+	generations := make([]int, 0, c.batchSize)
+	generations = append(generations, generation)
+
+	lingerCtx, cancel := context.WithTimeout(fetchCtx, c.batchLinger)
+	defer cancel()
+
+	for len(msgs) < c.batchSize {
+		msg, generation, err = c.gatedFetch(lingerCtx, c.reader.FetchMessage)
+		if err != nil {
+			if errors.Is(err, io.EOF) || c.stoppedFetching(err) || (lingerCtx.Err() != nil && ctx.Err() == nil) {
+				break // handle what we have so far
+			}
+			// the messages fetched so far are dropped, so are no longer in-flight
+			c.gate.done(len(msgs))
+			return nil, nil, errors.Errorf("unable to fetch message: %w", err)
+		}
+		msgs = append(msgs, msg)
+		generations = append(generations, generation)
+	}
+
+	return msgs, generations, nil
+}
@@ -0,0 +1,171 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_RunBatch(t *testing.T) {
+	reader := newQueueReader(offsetMsgs(25)...)
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithBatching(10, 20*time.Millisecond),
+	)
+
+	var gotSizes []int
+	var gotOffsets []int64
+	err := c.RunBatch(context.Background(), func(ctx context.Context, msgs []Message) error {
+		gotSizes = append(gotSizes, len(msgs))
+		for _, msg := range msgs {
+			assert.Equal(t, 1, msg.Attempt)
+			gotOffsets = append(gotOffsets, msg.Offset)
+		}
+		if len(gotOffsets) == 25 {
+			require.NoError(t, c.Stop())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{10, 10, 5}, gotSizes)
+	assert.Equal(t, gotOffsets, reader.committedOffsets())
+}
+
+func TestConsumer_RunBatch_retry(t *testing.T) {
+	wantErr := errors.New("some batch error")
+	reader := newQueueReader(offsetMsgs(5)...)
+
+	var notified int
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithBatching(5, time.Second),
+		WithHandlerBackOffRetry(func() backoff.BackOff {
+			return &testBackoff{maxAttempts: 5}
+		}),
+		WithNotifyError(func(ctx context.Context, err error, msg Message) {
+			assert.ErrorIs(t, err, wantErr)
+			notified++
+		}),
+	)
+
+	attempts := 0
+	err := c.RunBatch(context.Background(), func(ctx context.Context, msgs []Message) error {
+		attempts++
+		require.Len(t, msgs, 5)
+		assert.Equal(t, attempts, msgs[0].Attempt)
+		if attempts < 3 {
+			assert.Empty(t, reader.committedOffsets(), "batch should not be committed until handled")
+			return wantErr
+		}
+		require.NoError(t, c.Stop())
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 10, notified, "each message in the batch should be notified for each failed attempt")
+	assert.Equal(t, []int64{0, 1, 2, 3, 4}, reader.committedOffsets())
+}
+
+func TestConsumer_RunBatch_error(t *testing.T) {
+	wantErr := errors.New("some batch error")
+	reader := newQueueReader(offsetMsgs(3)...)
+
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithBatching(3, time.Second),
+	)
+
+	err := c.RunBatch(context.Background(), func(ctx context.Context, msgs []Message) error {
+		return wantErr
+	})
+	require.ErrorIs(t, err, wantErr)
+	assert.Contains(t, err.Error(), "unable to handle batch")
+	assert.Empty(t, reader.committedOffsets())
+}
+
+func TestConsumer_fetchBatch_error(t *testing.T) {
+	wantErr := errors.New("some fetch error")
+	reader := &failingReader{queueReader: newQueueReader(offsetMsgs(2)...), err: wantErr}
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithBatching(5, time.Second),
+	)
+
+	ctx := context.Background()
+	msgs, _, err := c.fetchBatch(ctx, ctx)
+	assert.ErrorIs(t, err, wantErr)
+	assert.Empty(t, msgs)
+
+	// the dropped messages should not be left in-flight, which blocks seeking
+	idleCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	assert.NoError(t, c.gate.waitIdle(idleCtx))
+}
+
+func TestGroup_RunBatch(t *testing.T) {
+	reader := newQueueReader(offsetMsgs(20)...)
+	group := NewGroup(GroupConfig{Count: 2},
+		WithKafkaReader(func() Reader { return reader }),
+		WithBatching(5, 10*time.Millisecond),
+	)
+
+	handled := new(safeCounter)
+	doneCh := make(chan struct{})
+	var doneOnce sync.Once
+	errCh := group.RunBatch(context.Background(), func(ctx context.Context, msgs []Message) error {
+		for range msgs {
+			handled.inc()
+		}
+		if handled.val() == 20 {
+			doneOnce.Do(func() { close(doneCh) })
+		}
+		return nil
+	})
+
+	select {
+	case <-doneCh:
+		group.Stop()
+		require.NoError(t, reader.Close())
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for batches")
+	}
+
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+	assert.Len(t, reader.committedOffsets(), 20)
+}
+
+func offsetMsgs(n int) []kafka.Message {
+	msgs := make([]kafka.Message, n)
+	for i := range msgs {
+		msgs[i] = kafka.Message{Topic: "some-topic", Offset: int64(i)}
+	}
+	return msgs
+}
+
+// failingReader fetches the queued messages, then fails with err.
+type failingReader struct {
+	*queueReader
+	err error
+}
+
+func (r *failingReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.msgs:
+		return msg, nil
+	default:
+		return kafka.Message{}, r.err
+	}
+}
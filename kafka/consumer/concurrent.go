@@ -0,0 +1,276 @@
+package consumer
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"sync"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// Ordering determines which messages are handled in order when a consumer handles
+// messages concurrently using WithConcurrency.
+type Ordering int
+
+const (
+	// OrderByPartition handles messages from the same partition in order, and
+	// messages from different partitions concurrently.
+	OrderByPartition Ordering = iota
+	// OrderByKey handles messages with the same key in order, and messages with
+	// different keys concurrently. Messages without a key are handled in
+	// partition order.
+	OrderByKey
+)
+
+// concurrentRunner fans messages out to a fixed number of workers. Each message
+// is always assigned to the same worker for its ordering key, and each worker
+// handles its messages one at a time, which preserves ordering per key.
+type concurrentRunner struct {
+	consumer *Consumer
+	handler  Handler
+	workers  []chan fetchedMessage
+	offsets  *offsetTracker  // nil unless explicit commits are enabled
+	stop     <-chan struct{} // nil unless explicit commits are enabled, see waitUntilDue
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	errMu sync.Mutex
+	err   error
+}
+
+// fetchedMessage is a message with the consumer group generation it was fetched
+// in.
+type fetchedMessage struct {
+	msg        kafka.Message
+	generation int
+}
+
+func (c *Consumer) runConcurrent(ctx context.Context, handler Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &concurrentRunner{
+		consumer: c,
+		handler:  handler,
+		workers:  make([]chan fetchedMessage, c.concurrency),
+		cancel:   cancel,
+	}
+	if c.withExplicitCommit {
+		r.offsets = newOffsetTracker(c.reader)
+		r.stop = c.stopCh
+	}
+
+	queueCapacity := max(c.conf.QueueCapacity/c.concurrency, 1)
+	for i := range r.workers {
+		r.workers[i] = make(chan fetchedMessage, queueCapacity)
+		r.wg.Add(1)
+		go r.work(ctx, r.workers[i])
+	}
+
+	fetchCtx, cancelFetch := c.fetchContext(ctx)
+	defer cancelFetch()
+
+	fetchErr := r.fetch(ctx, fetchCtx)
+
+	// Let the workers finish handling the messages already fetched.
+	for _, w := range r.workers {
+		close(w)
+	}
+	r.wg.Wait()
+
+	if r.err != nil {
+		return errors.Errorf("consumer error: %w", r.err)
+	}
+	if fetchErr != nil {
+		return errors.Errorf("consumer error: %w", fetchErr)
+	}
+	return nil
+}
+
+func (r *concurrentRunner) fetch(ctx, fetchCtx context.Context) error {
+	c := r.consumer
+
+	for {
+		select {
+		case <-c.stopCh:
+			c.conf.Logger.Printf(
+				"consumer(%s:%s): stopped signal received",
+				c.conf.Topic,
+				c.id,
+			)
+			return nil
+		default:
+		}
+
+		msg, generation, err := r.next(fetchCtx)
+		if err != nil {
+			if errors.Is(err, io.EOF) || c.stoppedFetching(err) {
+				continue
+			}
+			if r.failed() {
+				return nil // the worker error is returned instead
+			}
+			return err
+		}
+
+		if r.offsets != nil {
+			r.offsets.add(msg)
+		}
+
+		// Messages already fetched are still handled if the consumer is stopped.
+		select {
+		case r.workers[r.workerFor(msg)] <- fetchedMessage{msg: msg, generation: generation}:
+		case <-ctx.Done():
+			c.gate.done(1)
+			if r.failed() {
+				return nil
+			}
+			return errors.Errorf("unable to handle message: %w", ctx.Err())
+		}
+	}
+}
+
+func (r *concurrentRunner) next(ctx context.Context) (kafka.Message, int, error) {
+	c := r.consumer
+	if c.withExplicitCommit {
+		msg, generation, err := c.gatedFetch(ctx, c.reader.FetchMessage)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return msg, 0, errors.Errorf("unable to fetch message: %w", err)
+		}
+		return msg, generation, err
+	}
+
+	msg, generation, err := c.gatedFetch(ctx, c.reader.ReadMessage)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return msg, 0, errors.Errorf("unable to read message: %w", err)
+	}
+	return msg, generation, err
+}
+
+func (r *concurrentRunner) work(ctx context.Context, msgs <-chan fetchedMessage) {
+	defer r.wg.Done()
+
+	for m := range msgs {
+		r.handle(ctx, m.msg, m.generation)
+		r.consumer.gate.done(1)
+	}
+}
+
+func (r *concurrentRunner) handle(ctx context.Context, msg kafka.Message, generation int) {
+	if r.failed() {
+		return // drain any remaining messages once another worker has failed
+	}
+
+	due, err := r.consumer.waitUntilDue(ctx, r.stop, msg)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	if !due {
+		return // left uncommitted to be redelivered, as the consumer is stopping
+	}
+
+	if err := r.consumer.clientHandler.dispatch(ctx, msg, generation, r.handler); err != nil {
+		r.fail(errors.Errorf("unable to handle message: %w", err))
+		return
+	}
+
+	if r.offsets != nil {
+		if err := r.offsets.done(ctx, msg); err != nil {
+			r.fail(errors.Errorf("unable to commit message: %w", r.consumer.commitFailed([]kafka.Message{msg}, err)))
+		}
+	}
+}
+
+func (r *concurrentRunner) workerFor(msg kafka.Message) int {
+	h := fnv.New32a()
+	if r.consumer.ordering == OrderByKey && len(msg.Key) > 0 {
+		_, _ = h.Write(msg.Key)
+	} else {
+		_, _ = h.Write([]byte(msg.Topic))
+		_, _ = h.Write([]byte{byte(msg.Partition >> 24), byte(msg.Partition >> 16), byte(msg.Partition >> 8), byte(msg.Partition)})
+	}
+
+	return int(h.Sum32() % uint32(len(r.workers))) //nolint:gosec
+}
+
+func (r *concurrentRunner) fail(err error) {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+
+	if r.err == nil {
+		r.err = err
+		r.cancel()
+	}
+}
+
+func (r *concurrentRunner) failed() bool {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.err != nil
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+type pendingOffset struct {
+	msg  kafka.Message
+	done bool
+}
+
+// offsetTracker tracks fetched messages per partition so that offsets are only
+// committed once every message before them has also been handled.
+type offsetTracker struct {
+	mu         sync.Mutex
+	reader     Reader
+	partitions map[topicPartition][]*pendingOffset
+}
+
+func newOffsetTracker(reader Reader) *offsetTracker {
+	return &offsetTracker{
+		reader:     reader,
+		partitions: make(map[topicPartition][]*pendingOffset),
+	}
+}
+
+func (t *offsetTracker) add(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	t.partitions[tp] = append(t.partitions[tp], &pendingOffset{msg: msg})
+}
+
+// done marks the message as handled and commits the highest offset in its
+// partition for which all lower offsets have been handled.
+func (t *offsetTracker) done(ctx context.Context, msg kafka.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	pending := t.partitions[tp]
+	for _, p := range pending {
+		if p.msg.Offset == msg.Offset {
+			p.done = true
+			break
+		}
+	}
+
+	var commit *kafka.Message
+	i := 0
+	for ; i < len(pending) && pending[i].done; i++ {
+		commit = &pending[i].msg
+	}
+	t.partitions[tp] = pending[i:]
+
+	if commit == nil {
+		return nil
+	}
+
+	// Commits are made while holding the lock so they are never out of order.
+	return t.reader.CommitMessages(ctx, *commit)
+}
@@ -0,0 +1,199 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_Run_concurrentOrderByKey(t *testing.T) {
+	const numKeys = 5
+	const msgsPerKey = 20
+
+	var msgs []kafka.Message
+	for i := range msgsPerKey {
+		for k := range numKeys {
+			msgs = append(msgs, kafka.Message{
+				Topic:     "some-topic",
+				Partition: 0,
+				Offset:    int64(len(msgs)),
+				Key:       []byte("key-" + strconv.Itoa(k)),
+				Value:     []byte(strconv.Itoa(i)),
+			})
+		}
+	}
+
+	reader := newQueueReader(msgs...)
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithConcurrency(numKeys, OrderByKey),
+	)
+
+	var mu sync.Mutex
+	gotValues := map[string][]string{}
+	var inFlight, maxInFlight int32
+	var handled int32
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		gotValues[string(msg.Key)] = append(gotValues[string(msg.Key)], string(msg.Value))
+		mu.Unlock()
+
+		if atomic.AddInt32(&handled, 1) == int32(len(msgs)) {
+			go func() { _ = c.Stop() }()
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, gotValues, numKeys)
+	for key, values := range gotValues {
+		require.Len(t, values, msgsPerKey, key)
+		for i, v := range values {
+			assert.Equal(t, strconv.Itoa(i), v, "messages for %s should be handled in order", key)
+		}
+	}
+	assert.Greater(t, atomic.LoadInt32(&maxInFlight), int32(1), "messages should be handled concurrently")
+}
+
+func TestConsumer_Run_concurrentExplicitCommit(t *testing.T) {
+	var msgs []kafka.Message
+	for i := range 10 {
+		msgs = append(msgs, kafka.Message{
+			Topic:     "some-topic",
+			Partition: 0,
+			Offset:    int64(i),
+			Key:       []byte("key-" + strconv.Itoa(i)),
+		})
+	}
+
+	reader := newQueueReader(msgs...)
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+		WithConcurrency(4, OrderByKey),
+	)
+
+	var handled int32
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		if msg.Offset == 0 {
+			// Give the other workers time to handle their messages, none of which
+			// can be committed until this message is handled.
+			time.Sleep(50 * time.Millisecond)
+			assert.Empty(t, reader.committedOffsets())
+		}
+
+		if atomic.AddInt32(&handled, 1) == int32(len(msgs)) {
+			go func() { _ = c.Stop() }()
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	committed := reader.committedOffsets()
+	require.NotEmpty(t, committed)
+	assert.Equal(t, int64(9), committed[len(committed)-1])
+	assert.IsIncreasing(t, committed)
+}
+
+func TestConsumer_Run_concurrentError(t *testing.T) {
+	wantErr := errors.New("some handler error")
+
+	var msgs []kafka.Message
+	for i := range 50 {
+		msgs = append(msgs, kafka.Message{Topic: "some-topic", Partition: i % 3, Offset: int64(i)})
+	}
+
+	reader := newQueueReader(msgs...)
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+		WithConcurrency(3, OrderByPartition),
+	)
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		if msg.Offset == 10 {
+			return wantErr
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, wantErr)
+	assert.NotContains(t, reader.committedOffsets(), int64(10))
+}
+
+// queueReader is a Reader returning the queued messages in order, then blocking
+// until the context is canceled or the reader is closed.
+type queueReader struct {
+	msgs   chan kafka.Message
+	closed chan struct{}
+	once   sync.Once
+
+	mu        sync.Mutex
+	committed []int64
+}
+
+func newQueueReader(msgs ...kafka.Message) *queueReader {
+	r := &queueReader{
+		msgs:   make(chan kafka.Message, len(msgs)),
+		closed: make(chan struct{}),
+	}
+	for _, msg := range msgs {
+		r.msgs <- msg
+	}
+	return r
+}
+
+func (r *queueReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	return r.FetchMessage(ctx)
+}
+
+func (r *queueReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.msgs:
+		return msg, nil
+	case <-r.closed:
+		return kafka.Message{}, io.EOF
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *queueReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, msg := range msgs {
+		r.committed = append(r.committed, msg.Offset)
+	}
+	return nil
+}
+
+func (r *queueReader) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+func (r *queueReader) committedOffsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64{}, r.committed...)
+}
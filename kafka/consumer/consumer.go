@@ -4,6 +4,9 @@ package consumer
 import (
 	"context"
 	"io"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-errors/errors"
@@ -25,6 +28,15 @@ type Metadata struct {
 	GroupID    string
 	ConsumerID string
 	Attempt    int
+	// SourceTopic is the topic the message came from. For a message read from a
+	// retry topic (see WithRetryTopics) it is the topic the message was first
+	// consumed from, so it can be routed to the same handler.
+	SourceTopic string
+	// Generation is the consumer group generation the message's partition was
+	// assigned to the consumer in, see Consumer.Generation. It is 0 for consumers
+	// not in a group. It isn't named Partition as kafka.Message already has a
+	// Partition field, which Message embeds alongside Metadata.
+	Generation int
 }
 
 type Message struct {
@@ -33,6 +45,10 @@ type Message struct {
 }
 
 // Handler specifies how a consumer should handle a received Kafka message.
+//
+// The context holds the request IDs and authenticated user from the message
+// headers (see RequestIDHeader and friends), so request.UniqueIDsFromContext and
+// request.AuthenticatedUserFromContext work as they would for an HTTP request.
 type Handler func(ctx context.Context, msg Message) error
 
 // Reader fetches and commits messages from a Kafka topic.
@@ -54,20 +70,43 @@ type Config struct {
 	MaxWait       time.Duration // Default: 250ms
 	QueueCapacity int           // Default: 100
 	groupID       string
+	groupTopics   []string
+	topicPattern  *regexp.Regexp
 }
 
 // Consumer provides a high level API for consuming and handling messages from
 // a Kafka topic.
 //
-// It is worth noting that publishing failed messages to a dead letter queue is
-// not supported and instead would need to be included in your handler implementation.
+// Failed messages can be published to a dead letter topic instead of stopping the
+// consumer by using the WithDeadLetterTopic option.
 type Consumer struct {
 	id                 string
 	conf               kafka.ReaderConfig
 	reader             Reader
 	withExplicitCommit bool
+	concurrency        int
+	ordering           Ordering
+	batchSize          int
+	batchLinger        time.Duration
+	statsInterval      time.Duration
+	middleware         []Middleware
 	stopCh             chan struct{}
+	stopOnce           sync.Once
 	clientHandler      *messageHandler
+	gate               *fetchGate
+	health             *healthTracker
+	seekMu             sync.Mutex
+	onAssigned         RebalanceFunc
+	onRevoked          RebalanceFunc
+	generation         atomic.Int64 // 0 once the partitions are revoked, see Generation
+	fetchGeneration    atomic.Int64 // the generation of the messages being fetched
+
+	runMu     sync.Mutex
+	runDone   chan struct{} // nil until Run is called, closed once it returns
+	cancelRun context.CancelFunc
+
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // NewConsumer returns a new Consumer configured with the provided dialer and config.
@@ -88,9 +127,15 @@ func NewConsumer(config Config, opts ...Option) *Consumer {
 		config.QueueCapacity = consumerQueueCapacity // 100
 	}
 
+	health := newHealthTracker()
 	c := &Consumer{
-		id:     config.ID,
-		stopCh: make(chan struct{}),
+		id:            config.ID,
+		stopCh:        make(chan struct{}),
+		gate:          newFetchGate(),
+		health:        health,
+		batchSize:     consumerBatchSize,
+		batchLinger:   consumerBatchLinger,
+		statsInterval: consumerStatsInterval,
 		conf: kafka.ReaderConfig{
 			Brokers:               config.Brokers,
 			GroupID:               config.groupID,
@@ -98,6 +143,7 @@ func NewConsumer(config Config, opts ...Option) *Consumer {
 			Dialer:                kafka.DefaultDialer,
 			WatchPartitionChanges: true,
 			MaxBytes:              config.MaxBytes,
+			QueueCapacity:         config.QueueCapacity,
 			Logger:                kafka.LoggerFunc(func(string, ...interface{}) {}), // default to noop
 			ErrorLogger:           kafka.LoggerFunc(func(string, ...interface{}) {}), // default to noop
 		},
@@ -105,34 +151,82 @@ func NewConsumer(config Config, opts ...Option) *Consumer {
 			ConsumerID:   config.ID,
 			GroupID:      config.groupID,
 			clientNotify: func(_ context.Context, _ error, _ Message) {}, // default to noop
+			metrics:      noopMetrics{},
+			health:       health,
 		},
 	}
 
+	// Topics other than Config.Topic can only be consumed by a group.
+	if len(config.groupTopics) > 0 || config.topicPattern != nil {
+		c.conf.GroupTopics = groupTopics(config)
+	}
+
 	for _, opt := range opts {
 		opt(c)
 	}
 
-	// Set the reader unless one was injected via the WithKafkaReader option.
+	// Create the dead letter and retry producers now all options affecting the
+	// dialer are set.
+	if c.clientHandler.deadLetter != nil {
+		c.clientHandler.deadLetter.newPublisher(c.conf)
+	}
+	if c.clientHandler.retryTopics != nil {
+		c.clientHandler.retryTopics.newPublisher(c.conf)
+	}
+
+	// Set the reader unless one was injected via the WithKafkaReader option. The
+	// reader logs connection errors rather than returning them, so they are
+	// recorded from the error logger for Health.
 	if c.reader == nil {
-		if c.clientHandler.DataDogTracingEnabled {
-			c.reader = kafkatrace.NewReader(c.conf)
-		} else {
-			c.reader = kafka.NewReader(c.conf)
-		}
+		c.conf.ErrorLogger = c.health.errorLogger(c.conf.ErrorLogger)
+		c.reader = newKafkaReader(c.conf, config.topicPattern, func(conf kafka.ReaderConfig) Reader {
+			// The kafka-go reader does not report re-balances, so a group uses a
+			// kafka-go consumer group directly to track its generation.
+			if conf.GroupID != "" {
+				return newGroupReader(conf, c.newPartitionReader, c.partitionsAssigned, c.partitionsRevoked)
+			}
+			if c.clientHandler.DataDogTracingEnabled {
+				return kafkatrace.NewReader(conf)
+			}
+			return kafka.NewReader(conf)
+		})
+	} else if r, ok := c.reader.(rebalanceReader); ok {
+		r.OnRebalance(c.partitionsAssigned, c.partitionsRevoked)
 	}
 
 	return c
 }
 
+// newPartitionReader returns the reader for a partition assigned to a
+// groupReader, traced like the reader of a consumer not in a group is.
+func (c *Consumer) newPartitionReader(conf kafka.ReaderConfig) partitionReader {
+	if c.clientHandler.DataDogTracingEnabled {
+		return kafkatrace.NewReader(conf)
+	}
+	return kafka.NewReader(conf)
+}
+
 // Run consumes and handles messages from the topic. The method call blocks until
-// the context is canceled, the consumer is closed, or an error occurs.
-func (c *Consumer) Run(ctx context.Context, handler Handler) error {
+// the context is canceled, the consumer is stopped, or an error occurs.
+func (c *Consumer) Run(ctx context.Context, handler Handler) (err error) {
 	c.conf.Logger.Printf(
 		"consumer(%s:%s): running until context is cancelled, an error occurs, or the consumer is stopped",
 		c.conf.Topic,
 		c.id,
 	)
 
+	ctx, end := c.begin(ctx)
+	defer func() { end(err) }()
+
+	handler = chain(handler, c.middleware)
+
+	if c.concurrency > 1 {
+		return c.runConcurrent(ctx, handler)
+	}
+
+	fetchCtx, cancel := c.fetchContext(ctx)
+	defer cancel()
+
 	// Run forever until we read from the stopCh or we have an error processing a message
 	for {
 		select {
@@ -146,73 +240,90 @@ func (c *Consumer) Run(ctx context.Context, handler Handler) error {
 		default:
 		}
 
-		if err := c.retreiveNextMessage(ctx, handler); err != nil {
+		if err := c.retreiveNextMessage(ctx, fetchCtx, handler); err != nil {
 			return errors.Errorf("consumer error: %w", err)
 		}
 	}
 }
 
-// Stop stops the consumer. It waits for the current message (if any) to
-// finish being handled before closing the reader stream, preventing the consumer
-// from reading any more messages.
+// Stop stops the consumer from reading any more messages without waiting. If the
+// consumer is running, the reader stream is closed once the current message (if
+// any) has finished being handled, otherwise it is closed straight away.
+//
+// Stop is safe to call more than once, including from within a handler. Use
+// Shutdown to wait for in-flight messages to be handled.
 func (c *Consumer) Stop() error {
-	close(c.stopCh)
-	if err := c.reader.Close(); err != nil {
-		return errors.Errorf("unable to close consumer reader: %w", err)
+	c.signalStop()
+	if c.isRunning() {
+		return nil // the reader is closed once Run returns
 	}
 
-	c.conf.Logger.Printf(
-		"consumer(%s:%s): consumer has stopped",
-		c.conf.Topic,
-		c.id,
-	)
-	return nil
+	return c.close()
 }
 
-func (c *Consumer) retreiveNextMessage(ctx context.Context, handler Handler) error {
+// groupTopics returns the topic and any group topics, without duplicates.
+func groupTopics(config Config) []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for _, topic := range append([]string{config.Topic}, config.groupTopics...) {
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func (c *Consumer) retreiveNextMessage(ctx, fetchCtx context.Context, handler Handler) error {
 	if c.withExplicitCommit {
-		return c.fetchNextMessage(ctx, handler)
+		return c.fetchNextMessage(ctx, fetchCtx, handler)
 	}
 
-	return c.readNextMessage(ctx, handler)
+	return c.readNextMessage(ctx, fetchCtx, handler)
 }
 
-func (c *Consumer) fetchNextMessage(ctx context.Context, handler Handler) error {
-	var msg kafka.Message
-	var err error
-
-	msg, err = c.reader.FetchMessage(ctx)
+func (c *Consumer) fetchNextMessage(ctx, fetchCtx context.Context, handler Handler) error {
+	msg, generation, err := c.gatedFetch(fetchCtx, c.reader.FetchMessage)
 	if err != nil {
-		if errors.Is(err, io.EOF) {
+		if errors.Is(err, io.EOF) || c.stoppedFetching(err) {
 			return nil
 		}
 		return errors.Errorf("unable to fetch message: %w", err)
 	}
+	defer c.gate.done(1)
+
+	if due, err := c.waitUntilDue(ctx, c.stopCh, msg); !due {
+		return err
+	}
 
-	if err = c.clientHandler.dispatch(ctx, msg, handler); err != nil {
+	if err = c.clientHandler.dispatch(ctx, msg, generation, handler); err != nil {
 		return errors.Errorf("unable to handle message: %w", err)
 	}
 
 	if err = c.reader.CommitMessages(ctx, msg); err != nil {
-		return errors.Errorf("unable to commit message: %w", err)
+		return errors.Errorf("unable to commit message: %w", c.commitFailed([]kafka.Message{msg}, err))
 	}
 
 	return nil
 }
 
-func (c *Consumer) readNextMessage(ctx context.Context, handler Handler) error {
-	var msg kafka.Message
-	var err error
-
-	msg, err = c.reader.ReadMessage(ctx)
+func (c *Consumer) readNextMessage(ctx, fetchCtx context.Context, handler Handler) error {
+	msg, generation, err := c.gatedFetch(fetchCtx, c.reader.ReadMessage)
 	if err != nil {
-		if errors.Is(err, io.EOF) {
+		if errors.Is(err, io.EOF) || c.stoppedFetching(err) {
 			return nil
 		}
 		return errors.Errorf("unable to read message: %w", err)
 	}
+	defer c.gate.done(1)
+
+	// The message has already been committed, so it must be handled even if the
+	// consumer is stopped while waiting.
+	if _, err = c.waitUntilDue(ctx, nil, msg); err != nil {
+		return err
+	}
 
-	if err = c.clientHandler.dispatch(ctx, msg, handler); err != nil {
+	if err = c.clientHandler.dispatch(ctx, msg, generation, handler); err != nil {
 		return errors.Errorf("unable to handle message: %w", err)
 	}
 
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -30,7 +31,14 @@ type GroupConfig struct {
 	Count   int
 	Brokers []string
 	Topic   string
-	GroupID string
+	// Topics are consumed in addition to Topic.
+	Topics []string
+	// TopicPattern consumes every topic on the brokers matching the pattern, in
+	// addition to Topic and Topics. The topics are looked up when each consumer
+	// first fetches, so topics created later are not consumed until the group is
+	// restarted.
+	TopicPattern *regexp.Regexp
+	GroupID      string
 
 	MinBytes      int           // Default: 1MB
 	MaxBytes      int           // Default: 10MB
@@ -39,16 +47,21 @@ type GroupConfig struct {
 }
 
 // Group groups consumers together to concurrently consume and handle messages
-// from a Kafka topic. Many groups with the same group ID are safe to use, which
-// is particularly useful for groups across separate instances.
+// from one or more Kafka topics (see GroupConfig.Topics). Many groups with the
+// same group ID are safe to use, which is particularly useful for groups across
+// separate instances. Use a Router to handle messages from each topic differently.
 //
-// It is worth noting that publishing failed messages to a dead letter queue is
-// not supported and instead would need to be included in your handler implementation.
+// Failed messages can be published to a dead letter topic instead of stopping the
+// consumer by using the WithDeadLetterTopic option.
 type Group struct {
-	ID      string
-	config  GroupConfig
-	opts    []Option
-	stopChs []chan struct{}
+	ID     string
+	config GroupConfig
+	topics []string // consumed instead of config.Topic if set, see NewRetryGroup
+	opts   []Option
+
+	mu        sync.Mutex
+	consumers []*Consumer
+	paused    bool
 }
 
 // NewGroup returns a new Group configured with the provided dialer and config.
@@ -67,13 +80,33 @@ func NewGroup(config GroupConfig, opts ...Option) *Group {
 // Run concurrently consumes and handles messages from the topic across all
 // consumers in the group. The method call returns an error channel that is used
 // to receive any consumer errors. The run process is only stopped if the context
-// is canceled, the consumer has been closed, or all consumers in the group have
+// is canceled, the group has been stopped, or all consumers in the group have
 // errored.
 func (g *Group) Run(ctx context.Context, handler Handler) <-chan error {
+	return g.run(func(c *Consumer) error {
+		return c.Run(ctx, handler)
+	})
+}
+
+// RunBatch concurrently consumes and handles batches of messages from the topic
+// across all consumers in the group. See Consumer.RunBatch for how batches are
+// formed and committed, and Run for how errors are reported.
+func (g *Group) RunBatch(ctx context.Context, handler BatchHandler) <-chan error {
+	return g.run(func(c *Consumer) error {
+		return c.RunBatch(ctx, handler)
+	})
+}
+
+func (g *Group) run(runConsumer func(c *Consumer) error) <-chan error {
+	topics := g.topics
+	if len(topics) == 0 {
+		topics = []string{g.config.Topic}
+	}
+
 	var wg sync.WaitGroup
-	errCh := make(chan error, g.config.Count)
+	errCh := make(chan error, g.config.Count*len(topics))
 
-	for i := range g.config.Count {
+	for i := range g.config.Count * len(topics) {
 		wg.Add(1)
 
 		// Consumers must be created and run in sequential order so that Kafka can
@@ -83,22 +116,32 @@ func (g *Group) Run(ctx context.Context, handler Handler) <-chan error {
 		cfg := Config{
 			ID:            fmt.Sprintf("%s-%d", g.ID, i),
 			Brokers:       g.config.Brokers,
-			Topic:         g.config.Topic,
+			Topic:         topics[i/g.config.Count],
 			MinBytes:      g.config.MinBytes,
 			MaxBytes:      g.config.MaxBytes,
 			MaxWait:       g.config.MaxWait,
 			QueueCapacity: g.config.QueueCapacity,
 			groupID:       g.config.GroupID,
 		}
+		if len(g.topics) == 0 {
+			cfg.groupTopics = g.config.Topics
+			cfg.topicPattern = g.config.TopicPattern
+		}
 		c := NewConsumer(cfg, g.opts...)
 
+		g.mu.Lock()
+		g.consumers = append(g.consumers, c)
+		if g.paused {
+			c.Pause()
+		}
+		g.mu.Unlock()
+
 		go func() {
 			defer wg.Done()
-			if err := c.Run(ctx, handler); err != nil {
+			if err := runConsumer(c); err != nil {
 				errCh <- errors.Errorf("consumer failed: %w", err)
 			}
 		}()
-		g.stopChs = append(g.stopChs, c.stopCh)
 	}
 
 	go func() {
@@ -109,12 +152,15 @@ func (g *Group) Run(ctx context.Context, handler Handler) <-chan error {
 	return errCh
 }
 
-// Stop stops the group. It waits for the current message (if any) in each
-// consumer to finish being handled before closing the reader streams, preventing
-// each consumer from reading any more messages.
+// Stop stops each consumer in the group from reading any more messages without
+// waiting, see Consumer.Stop. It is safe to call more than once. Use Shutdown to
+// wait for in-flight messages to be handled and to receive any errors.
 func (g *Group) Stop() {
-	for _, stopCh := range g.stopChs {
-		close(stopCh)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, c := range g.consumers {
+		_ = c.Stop()
 	}
 }
 
@@ -47,7 +47,7 @@ func TestNewGroup(t *testing.T) {
 
 			g := NewGroup(tt.config, wantOpts...)
 			require.NotNil(t, g)
-			assert.Empty(t, g.stopChs)
+			assert.Empty(t, g.consumers)
 			wantConfig := tt.config
 			wantConfig.Count = tt.wantNumConsumers
 			assert.Equal(t, wantConfig, g.config)
@@ -68,7 +68,7 @@ func TestGroup_Run(t *testing.T) {
 
 	reader := NewMockReader(gomock.NewController(t))
 	reader.EXPECT().Close().AnyTimes()
-	reader.EXPECT().ReadMessage(ctx).Return(randMsg(), nil).AnyTimes()
+	reader.EXPECT().ReadMessage(gomock.Any()).Return(randMsg(), nil).AnyTimes()
 
 	group := NewGroup(GroupConfig{Count: wantConsumers},
 		WithKafkaReader(func() Reader { return reader }),
@@ -144,6 +144,12 @@ func TestGroup_Run_readerError(t *testing.T) {
 			reader := NewMockReader(gomock.NewController(t))
 			tt.setupReader(reader)
 
+			var closeErr error
+			if tt.closeErr {
+				closeErr = errors.New("some close error")
+			}
+			reader.EXPECT().Close().Return(closeErr).Times(1)
+
 			group := &Group{
 				config: GroupConfig{
 					Count: wantConsumers,
@@ -162,6 +168,7 @@ func TestGroup_Run_readerError(t *testing.T) {
 			for err := range errCh {
 				require.ErrorIs(t, err, wantErr)
 				group.Stop()
+				group.Stop() // safe to call more than once
 				require.Contains(t, err.Error(), wantErr.Error())
 			}
 		})
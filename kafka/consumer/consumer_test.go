@@ -85,7 +85,7 @@ func TestConsumer_Run(t *testing.T) {
 
 	reader := NewMockReader(gomock.NewController(t))
 	reader.EXPECT().Close().Return(nil).Times(1)
-	reader.EXPECT().ReadMessage(ctx).DoAndReturn(func(_ context.Context) (kafka.Message, error) {
+	reader.EXPECT().ReadMessage(gomock.Any()).DoAndReturn(func(_ context.Context) (kafka.Message, error) {
 		currMsg = randMsg()
 		return currMsg, nil
 	}).Times(wantTimes)
@@ -189,7 +189,7 @@ func TestConsumer_Run_error(t *testing.T) {
 
 			reader := NewMockReader(gomock.NewController(t))
 			reader.EXPECT().Close().Return(nil).AnyTimes()
-			reader.EXPECT().ReadMessage(ctx).Return(randMsg(), nil).AnyTimes()
+			reader.EXPECT().ReadMessage(gomock.Any()).Return(randMsg(), nil).AnyTimes()
 
 			consumer := NewConsumer(Config{},
 				WithKafkaReader(func() Reader { return reader }),
@@ -218,6 +218,30 @@ func TestConsumer_Run_error(t *testing.T) {
 	}
 }
 
+func TestConsumer_Run_clientPermanentError(t *testing.T) {
+	reader := newQueueReader(randMsg())
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithHandlerBackOffRetry(func() backoff.BackOff {
+			return &testBackoff{maxAttempts: 5}
+		}),
+	)
+
+	// errors from client handlers are always retried, even if wrapped with
+	// backoff.Permanent
+	attempts := 0
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		attempts++
+		if attempts < 3 {
+			return backoff.Permanent(errors.New("some handler error"))
+		}
+		require.NoError(t, c.Stop())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
 func TestNonStopExponentialBackOff(t *testing.T) {
 	bo := NonStopExponentialBackOff()
 	assert.Equal(t, 500*time.Millisecond, bo.NextBackOff())
@@ -0,0 +1,342 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrSeekNotSupported is returned when seeking a consumer whose reader does not
+// implement Seeker.
+var ErrSeekNotSupported = errors.Errorf("consumer reader does not support seeking")
+
+// errFetchPaused is returned by gatedFetch if fetching was paused while a fetch
+// was in progress, in which case no message was fetched.
+var errFetchPaused = errors.Errorf("consumer fetch paused")
+
+// Seeker is implemented by readers that can move the position messages are
+// fetched from. Readers created by the consumer implement it, as do readers
+// from kafkatest.FakeBroker.
+type Seeker interface {
+	SeekToOffset(ctx context.Context, partition int, offset int64) error
+	SeekToTimestamp(ctx context.Context, t time.Time) error
+}
+
+// Pause stops the consumer fetching any more messages until Resume is called.
+// Messages already fetched are still handled, and the consumer stays in the
+// consumer group so its partitions are not re-assigned. It is safe to call at any
+// time, including before Run.
+func (c *Consumer) Pause() {
+	c.gate.setPaused(true)
+}
+
+// Resume resumes fetching messages after Pause.
+func (c *Consumer) Resume() {
+	c.gate.setPaused(false)
+}
+
+// SeekToOffset moves the consumer so that the next message fetched from the
+// partition is the one at the offset. Fetching is paused while seeking, and
+// in-flight messages are handled first so that their commits do not overwrite
+// the new position.
+//
+// For a consumer group the offset is committed for the group, and the reader
+// re-joins the group so that every member resumes from the committed offsets.
+func (c *Consumer) SeekToOffset(ctx context.Context, partition int, offset int64) error {
+	return c.seek(ctx, func(s Seeker) error {
+		return s.SeekToOffset(ctx, partition, offset)
+	})
+}
+
+// SeekToTimestamp moves the consumer so that the next message fetched from each
+// partition is the first one at or after t, such as to replay messages after a
+// bug fix. See SeekToOffset for how in-flight messages and consumer groups are
+// handled.
+func (c *Consumer) SeekToTimestamp(ctx context.Context, t time.Time) error {
+	return c.seek(ctx, func(s Seeker) error {
+		return s.SeekToTimestamp(ctx, t)
+	})
+}
+
+func (c *Consumer) seek(ctx context.Context, seek func(s Seeker) error) error {
+	if _, ok := c.reader.(Seeker); !ok {
+		return ErrSeekNotSupported
+	}
+
+	c.seekMu.Lock()
+	defer c.seekMu.Unlock()
+
+	c.gate.hold()
+	defer c.gate.release()
+
+	if err := c.gate.waitIdle(ctx); err != nil {
+		return errors.Errorf("unable to seek consumer: %w", err)
+	}
+
+	return c.seekReader(seek)
+}
+
+// seekReader seeks the reader. Fetching must be held and idle.
+func (c *Consumer) seekReader(seek func(s Seeker) error) error {
+	s, ok := c.reader.(Seeker)
+	if !ok {
+		return ErrSeekNotSupported
+	}
+
+	if err := seek(s); err != nil {
+		return errors.Errorf("unable to seek consumer: %w", err)
+	}
+
+	return nil
+}
+
+// gatedFetch waits until fetching is allowed (see Pause) and then fetches a
+// message, returning it with the consumer group generation it was fetched in. A
+// fetched message counts as in-flight until gate.done is called for it, which
+// must happen once it has been handled and committed.
+func (c *Consumer) gatedFetch(ctx context.Context, fetch func(context.Context) (kafka.Message, error)) (kafka.Message, int, error) {
+	fetchCtx, cancel, err := c.gate.wait(ctx)
+	if err != nil {
+		return kafka.Message{}, 0, err
+	}
+	defer cancel()
+
+	msg, err := fetch(fetchCtx)
+	if err != nil {
+		c.gate.done(1)
+		if fetchCtx.Err() != nil && ctx.Err() == nil {
+			return msg, 0, errFetchPaused
+		}
+		return msg, 0, err
+	}
+
+	c.health.fetched(msg)
+
+	// Readers report a new generation from within the fetch, so the current
+	// generation is the one the message was fetched in.
+	return msg, int(c.fetchGeneration.Load()), nil
+}
+
+// fetchGate controls whether a consumer may fetch messages, and tracks the
+// messages in-flight so that seeking can wait for them to be handled.
+type fetchGate struct {
+	mu     sync.Mutex
+	paused bool // set by Pause
+	holds  int  // seeks in progress
+	isOpen bool
+	opened chan struct{}      // closed while fetching is allowed
+	cancel context.CancelFunc // cancels the fetch in progress, if any
+
+	inflight int
+	idle     chan struct{} // closed while nothing is in-flight
+}
+
+func newFetchGate() *fetchGate {
+	g := &fetchGate{
+		isOpen: true,
+		opened: make(chan struct{}),
+		idle:   make(chan struct{}),
+	}
+	close(g.opened)
+	close(g.idle)
+	return g
+}
+
+func (g *fetchGate) setPaused(paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused = paused
+	g.update()
+}
+
+func (g *fetchGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+func (g *fetchGate) hold() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.holds++
+	g.update()
+}
+
+func (g *fetchGate) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.holds--
+	g.update()
+}
+
+// update opens or closes the gate. Closing the gate cancels any fetch in
+// progress. The lock must be held.
+func (g *fetchGate) update() {
+	open := !g.paused && g.holds == 0
+	if open == g.isOpen {
+		return
+	}
+
+	g.isOpen = open
+	if open {
+		close(g.opened)
+		return
+	}
+
+	g.opened = make(chan struct{})
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
+
+// wait blocks until the gate is open, then marks a fetch as in-flight and
+// returns a context for it that is canceled if the gate closes.
+func (g *fetchGate) wait(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	for {
+		g.mu.Lock()
+		if g.isOpen {
+			fetchCtx, cancel := context.WithCancel(ctx)
+			g.cancel = cancel
+			g.add()
+			g.mu.Unlock()
+			return fetchCtx, cancel, nil
+		}
+		opened := g.opened
+		g.mu.Unlock()
+
+		select {
+		case <-opened:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// add marks a fetch as in-flight. The lock must be held.
+func (g *fetchGate) add() {
+	if g.inflight == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.inflight++
+}
+
+// done marks n fetched messages as no longer in-flight.
+func (g *fetchGate) done(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if n <= 0 || g.inflight == 0 {
+		return
+	}
+	g.inflight = max(g.inflight-n, 0)
+	if g.inflight == 0 {
+		close(g.idle)
+	}
+}
+
+// reset marks nothing as in-flight, once the consumer is no longer running.
+func (g *fetchGate) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.inflight > 0 {
+		g.inflight = 0
+		close(g.idle)
+	}
+}
+
+// waitIdle blocks until nothing is in-flight.
+func (g *fetchGate) waitIdle(ctx context.Context) error {
+	g.mu.Lock()
+	idle := g.idle
+	g.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause pauses every consumer in the group, see Consumer.Pause. Consumers started
+// by the group while it is paused also start paused.
+func (g *Group) Pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.paused = true
+	for _, c := range g.consumers {
+		c.Pause()
+	}
+}
+
+// Resume resumes every consumer in the group after Pause.
+func (g *Group) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.paused = false
+	for _, c := range g.consumers {
+		c.Resume()
+	}
+}
+
+// SeekToOffset moves the group so that the next message fetched from the
+// partition is the one at the offset, see Consumer.SeekToOffset. Fetching is
+// paused for every consumer in the group until their in-flight messages have
+// been handled, then the group is moved using one consumer per topic.
+func (g *Group) SeekToOffset(ctx context.Context, partition int, offset int64) error {
+	return g.seek(ctx, func(s Seeker) error {
+		return s.SeekToOffset(ctx, partition, offset)
+	})
+}
+
+// SeekToTimestamp moves the group so that the next message fetched from each
+// partition is the first one at or after t. See SeekToOffset for how the group
+// is moved.
+func (g *Group) SeekToTimestamp(ctx context.Context, t time.Time) error {
+	return g.seek(ctx, func(s Seeker) error {
+		return s.SeekToTimestamp(ctx, t)
+	})
+}
+
+func (g *Group) seek(ctx context.Context, seek func(s Seeker) error) error {
+	g.mu.Lock()
+	consumers := append([]*Consumer{}, g.consumers...)
+	g.mu.Unlock()
+
+	for _, c := range consumers {
+		c.seekMu.Lock()
+		defer c.seekMu.Unlock()
+
+		c.gate.hold()
+		defer c.gate.release()
+	}
+
+	for _, c := range consumers {
+		if err := c.gate.waitIdle(ctx); err != nil {
+			return errors.Errorf("unable to seek group: %w", err)
+		}
+	}
+
+	// Seeking moves the whole group, so only one consumer per topic is needed.
+	seeked := make(map[string]bool)
+	for _, c := range consumers {
+		if seeked[c.conf.Topic] || !c.isRunning() {
+			continue
+		}
+		if err := c.seekReader(seek); err != nil {
+			return err
+		}
+		seeked[c.conf.Topic] = true
+	}
+
+	if len(seeked) == 0 {
+		return errors.Errorf("unable to seek group: no consumers are running")
+	}
+	return nil
+}
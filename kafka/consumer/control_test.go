@@ -0,0 +1,200 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+)
+
+func TestConsumer_PauseResume(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	writer := broker.Writer("some-topic")
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+		WithExplicitCommit(),
+	)
+
+	handled := newOffsetRecorder()
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Run(context.Background(), handled.handler) }()
+
+	require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("0")}))
+	require.Eventually(t, func() bool { return len(handled.offsets()) == 1 }, time.Second, time.Millisecond)
+
+	c.Pause()
+	c.Pause() // safe to call more than once
+	require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("1")}))
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, handled.offsets(), 1, "messages should not be fetched while paused")
+
+	c.Resume()
+	require.Eventually(t, func() bool { return len(handled.offsets()) == 2 }, time.Second, time.Millisecond)
+
+	require.NoError(t, c.Stop())
+	require.NoError(t, <-errCh)
+}
+
+func TestConsumer_Pause_stop(t *testing.T) {
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return newQueueReader(offsetMsgs(1)...) }),
+	)
+	c.Pause()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+			t.Error("messages should not be handled while paused")
+			return nil
+		})
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, c.Stop())
+	require.NoError(t, <-errCh)
+}
+
+func TestConsumer_Seek(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		concurrency int
+		seek        func(ctx context.Context, c *Consumer) error
+	}{
+		{
+			name: "offset",
+			seek: func(ctx context.Context, c *Consumer) error {
+				return c.SeekToOffset(ctx, 0, 2)
+			},
+		},
+		{
+			name: "timestamp",
+			seek: func(ctx context.Context, c *Consumer) error {
+				return c.SeekToTimestamp(ctx, start.Add(2*time.Minute))
+			},
+		},
+		{
+			name:        "concurrent",
+			concurrency: 2,
+			seek: func(ctx context.Context, c *Consumer) error {
+				return c.SeekToOffset(ctx, 0, 2)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := kafkatest.NewFakeBroker()
+			require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), timedMsgs(start, 5)...))
+
+			c := NewConsumer(Config{},
+				WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+				WithExplicitCommit(),
+				WithConcurrency(max(tt.concurrency, 1), OrderByPartition),
+			)
+
+			handled := newOffsetRecorder()
+			errCh := make(chan error, 1)
+			go func() { errCh <- c.Run(context.Background(), handled.handler) }()
+			require.Eventually(t, func() bool {
+				return broker.CommittedOffset("some-group", "some-topic", 0) == 5
+			}, time.Second, time.Millisecond)
+
+			require.NoError(t, tt.seek(context.Background(), c))
+			require.Eventually(t, func() bool { return len(handled.offsets()) == 8 }, time.Second, time.Millisecond)
+			assert.Equal(t, []int64{0, 1, 2, 3, 4, 2, 3, 4}, handled.offsets())
+
+			require.NoError(t, c.Stop())
+			require.NoError(t, <-errCh)
+		})
+	}
+}
+
+func TestConsumer_Seek_notSupported(t *testing.T) {
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return newQueueReader() }),
+	)
+
+	assert.ErrorIs(t, c.SeekToOffset(context.Background(), 0, 0), ErrSeekNotSupported)
+	assert.ErrorIs(t, c.SeekToTimestamp(context.Background(), time.Now()), ErrSeekNotSupported)
+}
+
+func TestGroup_PauseSeekResume(t *testing.T) {
+	const numPartitions = 2
+	start := time.Now().Add(-time.Hour)
+
+	broker := kafkatest.NewFakeBroker()
+	broker.CreateTopic("some-topic", numPartitions)
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), timedMsgs(start, 10)...))
+
+	group := NewGroup(GroupConfig{Count: 2, Topic: "some-topic", GroupID: "some-group"},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+		WithExplicitCommit(),
+	)
+
+	handled := newOffsetRecorder()
+	errCh := group.Run(context.Background(), handled.handler)
+	require.Eventually(t, func() bool { return len(handled.offsets()) == 10 }, time.Second, time.Millisecond)
+
+	group.Pause()
+	require.NoError(t, group.SeekToTimestamp(context.Background(), start))
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, handled.offsets(), 10, "messages should not be fetched while paused")
+
+	group.Resume()
+	require.Eventually(t, func() bool { return len(handled.offsets()) == 20 }, time.Second, time.Millisecond)
+
+	_, err := group.Shutdown(context.Background())
+	require.NoError(t, err)
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+}
+
+func TestGroup_Seek_notRunning(t *testing.T) {
+	group := NewGroup(GroupConfig{Topic: "some-topic", GroupID: "some-group"})
+	assert.Error(t, group.SeekToOffset(context.Background(), 0, 0))
+}
+
+// timedMsgs returns messages with times a minute apart from start.
+func timedMsgs(start time.Time, n int) []kafka.Message {
+	msgs := make([]kafka.Message, n)
+	for i := range msgs {
+		msgs[i] = kafka.Message{
+			Value: []byte(strconv.Itoa(i)),
+			Time:  start.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return msgs
+}
+
+// offsetRecorder records the offsets of handled messages.
+type offsetRecorder struct {
+	mu      sync.Mutex
+	handled []int64
+}
+
+func newOffsetRecorder() *offsetRecorder {
+	return &offsetRecorder{}
+}
+
+func (r *offsetRecorder) handler(_ context.Context, msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handled = append(r.handled, msg.Offset)
+	return nil
+}
+
+func (r *offsetRecorder) offsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64{}, r.handled...)
+}
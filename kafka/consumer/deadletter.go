@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+// Headers added to messages published to a dead letter topic, describing why
+// and where the original message failed.
+const (
+	DeadLetterErrorHeader             = "x-dead-letter-error"
+	DeadLetterAttemptsHeader          = "x-dead-letter-attempts"
+	DeadLetterGroupIDHeader           = "x-dead-letter-group-id"
+	DeadLetterConsumerIDHeader        = "x-dead-letter-consumer-id"
+	DeadLetterOriginalTopicHeader     = "x-dead-letter-original-topic"
+	DeadLetterOriginalPartitionHeader = "x-dead-letter-original-partition"
+	DeadLetterOriginalOffsetHeader    = "x-dead-letter-original-offset"
+)
+
+// deadLetterPublisher publishes messages to a dead letter topic.
+type deadLetterPublisher interface {
+	Publish(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type deadLetterQueue struct {
+	topic     string
+	opts      []producer.Option
+	publisher deadLetterPublisher
+}
+
+// newPublisher creates the dead letter producer using the same brokers and dialer
+// as the consumer. Any producer options passed to WithDeadLetterTopic are applied
+// afterwards so they take precedence.
+func (q *deadLetterQueue) newPublisher(conf kafka.ReaderConfig) {
+	opts := append([]producer.Option{producer.WithKafkaDialer(conf.Dialer)}, q.opts...)
+	q.publisher = producer.NewProducer(producer.Config{
+		Brokers: conf.Brokers,
+		Topic:   q.topic,
+	}, opts...)
+}
+
+func (q *deadLetterQueue) publish(ctx context.Context, msg kafka.Message, handlerErr error, metadata Metadata) error {
+	dlqMsg := kafka.Message{
+		Key:   msg.Key,
+		Value: msg.Value,
+		Time:  msg.Time,
+		Headers: append(append([]kafka.Header{}, msg.Headers...),
+			kafka.Header{Key: DeadLetterErrorHeader, Value: []byte(errorString(handlerErr))},
+			kafka.Header{Key: DeadLetterAttemptsHeader, Value: []byte(strconv.Itoa(metadata.Attempt))},
+			kafka.Header{Key: DeadLetterGroupIDHeader, Value: []byte(metadata.GroupID)},
+			kafka.Header{Key: DeadLetterConsumerIDHeader, Value: []byte(metadata.ConsumerID)},
+			kafka.Header{Key: DeadLetterOriginalTopicHeader, Value: []byte(msg.Topic)},
+			kafka.Header{Key: DeadLetterOriginalPartitionHeader, Value: []byte(strconv.Itoa(msg.Partition))},
+			kafka.Header{Key: DeadLetterOriginalOffsetHeader, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		),
+	}
+
+	if err := q.publisher.Publish(ctx, dlqMsg); err != nil {
+		return errors.Errorf("unable to publish message to dead letter topic %s: %w", q.topic, err)
+	}
+
+	return nil
+}
+
+func (q *deadLetterQueue) close() error {
+	if err := q.publisher.Close(); err != nil {
+		return errors.Errorf("unable to close dead letter producer: %w", err)
+	}
+
+	return nil
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
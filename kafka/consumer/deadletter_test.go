@@ -0,0 +1,125 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+func TestConsumer_Run_deadLetterTopic(t *testing.T) {
+	ctx := context.Background()
+	wantHandlerErr := errors.New("some poison message error")
+	wantMsg := randMsg()
+	wantMsg.Key = []byte("some-key")
+	wantMsg.Offset = 42
+	wantMsg.Headers = []kafka.Header{{Key: "some-header", Value: []byte("some-value")}}
+	nextMsg := randMsg()
+
+	reader := NewMockReader(gomock.NewController(t))
+	reader.EXPECT().Close().Return(nil).Times(1)
+	gomock.InOrder(
+		reader.EXPECT().FetchMessage(gomock.Any()).Return(wantMsg, nil).Times(1),
+		reader.EXPECT().CommitMessages(gomock.Any(), wantMsg).Return(nil).Times(1),
+		reader.EXPECT().FetchMessage(gomock.Any()).Return(nextMsg, nil).Times(1),
+		reader.EXPECT().CommitMessages(gomock.Any(), nextMsg).Return(nil).Times(1),
+	)
+
+	dlqWriter := &fakeWriter{}
+	consumer := NewConsumer(Config{ID: "some-consumer-id", groupID: "some-group-id"},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+		WithHandlerBackOffRetry(func() backoff.BackOff {
+			return &testBackoff{maxAttempts: 3}
+		}),
+		WithDeadLetterTopic("some-dlq-topic", producer.WithKafkaWriter(func() producer.Writer {
+			return dlqWriter
+		})),
+	)
+
+	handler := func(ctx context.Context, msg Message) error {
+		if msg.Offset == wantMsg.Offset {
+			return wantHandlerErr
+		}
+		require.NoError(t, consumer.Stop())
+		return nil
+	}
+
+	require.NoError(t, consumer.Run(ctx, handler))
+	require.Len(t, dlqWriter.msgs, 1)
+	assert.True(t, dlqWriter.closed)
+
+	got := dlqWriter.msgs[0]
+	assert.Equal(t, wantMsg.Key, got.Key)
+	assert.Equal(t, wantMsg.Value, got.Value)
+	assert.Empty(t, got.Topic)
+
+	headers := map[string]string{}
+	for _, h := range got.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	assert.Equal(t, map[string]string{
+		"some-header":                     "some-value",
+		DeadLetterErrorHeader:             wantHandlerErr.Error(),
+		DeadLetterAttemptsHeader:          "3",
+		DeadLetterGroupIDHeader:           "some-group-id",
+		DeadLetterConsumerIDHeader:        "some-consumer-id",
+		DeadLetterOriginalTopicHeader:     wantMsg.Topic,
+		DeadLetterOriginalPartitionHeader: strconv.Itoa(wantMsg.Partition),
+		DeadLetterOriginalOffsetHeader:    "42",
+	}, headers)
+}
+
+func TestConsumer_Run_deadLetterTopicError(t *testing.T) {
+	ctx := context.Background()
+	wantErr := errors.New("some dlq write error")
+
+	reader := NewMockReader(gomock.NewController(t))
+	reader.EXPECT().ReadMessage(gomock.Any()).Return(randMsg(), nil).Times(1)
+
+	consumer := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithDeadLetterTopic("some-dlq-topic", producer.WithKafkaWriter(func() producer.Writer {
+			return &fakeWriter{err: wantErr}
+		})),
+	)
+
+	err := consumer.Run(ctx, func(ctx context.Context, msg Message) error {
+		return errors.New("some handler error")
+	})
+	require.ErrorIs(t, err, wantErr)
+	assert.Contains(t, err.Error(), "unable to publish message to dead letter topic some-dlq-topic")
+}
+
+type fakeWriter struct {
+	mu     sync.Mutex
+	msgs   []kafka.Message
+	err    error
+	closed bool
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	return nil
+}
@@ -0,0 +1,98 @@
+package consumer
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/env"
+	"github.com/cultureamp/ca-go/secrets"
+)
+
+// NewGroupFromEnv returns a new Group configured from the Kafka environment
+// variables (see env.KafkaSettings). The first of the topics is the group Topic
+// and the rest are its Topics.
+//
+// If a SASL username is set, the dialer authenticates with SCRAM-SHA-512 using
+// the password stored in the secret named by env.KafkaSecretName, which is
+// retrieved with secrets.Get. TLS is used unless it is turned off.
+//
+// Options are applied after the dialer is set, so WithKafkaDialer can still be
+// used to replace it.
+func NewGroupFromEnv(ctx context.Context, opts ...Option) (*Group, error) {
+	settings := env.DefaultKafkaSettings
+
+	config, err := groupConfigFromEnv(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := dialerFromEnv(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	if dialer != nil {
+		opts = append([]Option{WithKafkaDialer(dialer)}, opts...)
+	}
+
+	return NewGroup(config, opts...), nil
+}
+
+func groupConfigFromEnv(settings env.KafkaSettings) (GroupConfig, error) {
+	config := GroupConfig{
+		Brokers: settings.KafkaBrokers(),
+		GroupID: settings.KafkaGroupID(),
+	}
+
+	if len(config.Brokers) == 0 {
+		return GroupConfig{}, errors.Errorf("unable to configure consumer group: %s is not set", env.KafkaBrokersEnv)
+	}
+	if config.GroupID == "" {
+		return GroupConfig{}, errors.Errorf("unable to configure consumer group: %s is not set", env.KafkaGroupIDEnv)
+	}
+
+	topics := settings.KafkaTopics()
+	if len(topics) == 0 {
+		return GroupConfig{}, errors.Errorf("unable to configure consumer group: %s is not set", env.KafkaTopicsEnv)
+	}
+	config.Topic = topics[0]
+	config.Topics = topics[1:]
+
+	return config, nil
+}
+
+// dialerFromEnv returns the dialer for the settings, or nil if the default dialer
+// can be used.
+func dialerFromEnv(ctx context.Context, settings env.KafkaSettings) (*kafka.Dialer, error) {
+	username := settings.KafkaSASLUsername()
+	if username == "" {
+		if !settings.IsKafkaTLSEnabled() {
+			return nil, nil
+		}
+		return &kafka.Dialer{
+			Timeout:   defaultDialerTimeout,
+			DualStack: true,
+			TLS:       &tls.Config{MinVersion: tls.VersionTLS12},
+		}, nil
+	}
+
+	if settings.KafkaSecretName() == "" {
+		return nil, errors.Errorf("unable to configure kafka dialer: %s is not set", env.KafkaSecretNameEnv)
+	}
+	password, err := secrets.Get(ctx, settings.KafkaSecretName())
+	if err != nil {
+		return nil, errors.Errorf("unable to get kafka password: %w", err)
+	}
+
+	dialer, err := DialerSCRAM512(username, password)
+	if err != nil {
+		return nil, errors.Errorf("unable to configure kafka dialer: %w", err)
+	}
+	if !settings.IsKafkaTLSEnabled() {
+		dialer.TLS = nil
+	}
+
+	return dialer, nil
+}
@@ -0,0 +1,137 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/env"
+	"github.com/cultureamp/ca-go/secrets"
+)
+
+func TestNewGroupFromEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   fakeKafkaSettings
+		secrets    fakeSecrets
+		wantConfig GroupConfig
+		wantSASL   bool
+		wantTLS    bool
+		wantErr    string
+	}{
+		{
+			name: "sasl",
+			settings: fakeKafkaSettings{
+				brokers:  []string{"some-broker:9096"},
+				topics:   []string{"some-topic", "other-topic"},
+				groupID:  "some-group",
+				username: "some-user",
+				secret:   "some-secret",
+				tls:      true,
+			},
+			secrets: fakeSecrets{"some-secret": "some-password"},
+			wantConfig: GroupConfig{
+				Count:   1,
+				Brokers: []string{"some-broker:9096"},
+				Topic:   "some-topic",
+				Topics:  []string{"other-topic"},
+				GroupID: "some-group",
+			},
+			wantSASL: true,
+			wantTLS:  true,
+		},
+		{
+			name: "plaintext",
+			settings: fakeKafkaSettings{
+				brokers: []string{"localhost:9092"},
+				topics:  []string{"some-topic"},
+				groupID: "some-group",
+			},
+			wantConfig: GroupConfig{
+				Count:   1,
+				Brokers: []string{"localhost:9092"},
+				Topic:   "some-topic",
+				Topics:  []string{},
+				GroupID: "some-group",
+			},
+		},
+		{
+			name:     "missing brokers",
+			settings: fakeKafkaSettings{topics: []string{"some-topic"}, groupID: "some-group"},
+			wantErr:  "KAFKA_BROKERS is not set",
+		},
+		{
+			name:     "missing topics",
+			settings: fakeKafkaSettings{brokers: []string{"localhost:9092"}, groupID: "some-group"},
+			wantErr:  "KAFKA_TOPICS is not set",
+		},
+		{
+			name: "missing secret",
+			settings: fakeKafkaSettings{
+				brokers:  []string{"localhost:9092"},
+				topics:   []string{"some-topic"},
+				groupID:  "some-group",
+				username: "some-user",
+				secret:   "some-secret",
+			},
+			secrets: fakeSecrets{},
+			wantErr: "unable to get kafka password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldSettings := env.DefaultKafkaSettings
+			oldSecrets := secrets.DefaultAWSSecretsManager
+			defer func() {
+				env.DefaultKafkaSettings = oldSettings
+				secrets.DefaultAWSSecretsManager = oldSecrets
+			}()
+			env.DefaultKafkaSettings = tt.settings
+			secrets.DefaultAWSSecretsManager = tt.secrets
+
+			g, err := NewGroupFromEnv(context.Background())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantConfig, g.config)
+
+			c := NewConsumer(Config{Brokers: g.config.Brokers, Topic: g.config.Topic}, g.opts...)
+			defer c.Stop()
+			assert.Equal(t, tt.wantSASL, c.conf.Dialer.SASLMechanism != nil)
+			assert.Equal(t, tt.wantTLS, c.conf.Dialer.TLS != nil)
+		})
+	}
+}
+
+type fakeKafkaSettings struct {
+	brokers  []string
+	topics   []string
+	groupID  string
+	username string
+	secret   string
+	tls      bool
+}
+
+func (s fakeKafkaSettings) KafkaBrokers() []string    { return s.brokers }
+func (s fakeKafkaSettings) KafkaTopics() []string     { return s.topics }
+func (s fakeKafkaSettings) KafkaGroupID() string      { return s.groupID }
+func (s fakeKafkaSettings) KafkaSASLUsername() string { return s.username }
+func (s fakeKafkaSettings) KafkaSecretName() string   { return s.secret }
+func (s fakeKafkaSettings) IsKafkaTLSEnabled() bool   { return s.tls }
+
+// fakeSecrets returns secrets by name.
+type fakeSecrets map[string]string
+
+func (s fakeSecrets) Get(_ context.Context, secretKey string) (string, error) {
+	secret, ok := s[secretKey]
+	if !ok {
+		return "", errors.New("secret not found")
+	}
+	return secret, nil
+}
@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/cultureamp/ca-go/kafka/consumer"
 )
@@ -48,11 +49,22 @@ func main() {
 			}
 		case <-sigterm:
 			signal.Stop(sigterm)
-			consumerGroup.Stop()
+			shutdown(consumerGroup)
 		}
 	}
 }
 
+func shutdown(g *consumer.Group) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	status, err := g.Shutdown(ctx)
+	if err != nil {
+		log.Println(err)
+	}
+	log.Printf("consumer group %s shut down, drained: %t\n", status.GroupID, status.Drained())
+}
+
 func handle(_ context.Context, msg consumer.Message) error {
 	log.Printf("message at consumer: %s topic:%v partition:%v offset:%v	%s = %s\n",
 		msg.Metadata.ConsumerID, msg.Topic, msg.Partition, msg.Offset, string(msg.Key), string(msg.Value),
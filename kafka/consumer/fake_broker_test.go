@@ -0,0 +1,118 @@
+package consumer
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+func TestGroup_Run_fakeBroker(t *testing.T) {
+	const numPartitions = 4
+	const numMsgs = 100
+
+	broker := kafkatest.NewFakeBroker()
+	broker.CreateTopic("some-topic", numPartitions)
+
+	p := producer.NewProducer(producer.Config{Topic: "some-topic"},
+		producer.WithKafkaWriter(func() producer.Writer { return broker.Writer("some-topic") }),
+	)
+	for i := range numMsgs {
+		require.NoError(t, p.Publish(context.Background(), kafka.Message{
+			Key:   []byte("key-" + strconv.Itoa(i%10)),
+			Value: []byte(strconv.Itoa(i)),
+		}))
+	}
+	require.NoError(t, p.Close())
+
+	group := NewGroup(GroupConfig{Count: 2, Topic: "some-topic", GroupID: "some-group"},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+		WithExplicitCommit(),
+	)
+
+	var mu sync.Mutex
+	consumers := map[string]int{}
+	lastOffsets := map[int]int64{}
+	errCh := group.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if last, ok := lastOffsets[msg.Partition]; ok {
+			assert.Greater(t, msg.Offset, last, "messages in a partition should be handled in order")
+		}
+		lastOffsets[msg.Partition] = msg.Offset
+		consumers[msg.Metadata.ConsumerID]++
+		return nil
+	})
+
+	require.Eventually(t, func() bool {
+		total := int64(0)
+		for partition := range numPartitions {
+			total += max(broker.CommittedOffset("some-group", "some-topic", partition), 0)
+		}
+		return total == numMsgs
+	}, 5*time.Second, time.Millisecond)
+
+	_, err := group.Shutdown(context.Background())
+	require.NoError(t, err)
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, consumers, 2, "partitions should be shared between the group consumers")
+}
+
+func TestConsumer_Run_fakeBrokerRebalance(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), offsetMsgs(3)...))
+
+	reader := broker.Reader("some-group", "some-topic")
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+	)
+
+	var handled []int64
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		handled = append(handled, msg.Offset)
+		if len(handled) == 1 {
+			// The message is redelivered as it was not committed before the rebalance.
+			broker.Rebalance("some-group")
+		}
+		if msg.Offset == 2 {
+			require.NoError(t, c.Stop())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int64{0, 0, 1, 2}, handled)
+	assert.Equal(t, int64(3), broker.CommittedOffset("some-group", "some-topic", 0))
+	assert.Equal(t, 2, reader.Generation())
+}
+
+func TestFakeBroker_readerClose(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	broker.CreateTopic("some-topic", 3)
+
+	r1 := broker.Reader("some-group", "some-topic")
+	r2 := broker.Reader("some-group", "some-topic")
+	assert.Equal(t, []int{0, 2}, r1.Assignment())
+	assert.Equal(t, []int{1}, r2.Assignment())
+
+	// Closing a reader leaves the group, so the remaining reader is assigned every partition.
+	require.NoError(t, r1.Close())
+	assert.Equal(t, []int{0, 1, 2}, r2.Assignment())
+
+	_, err := r1.FetchMessage(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,439 @@
+package consumer
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+const groupRebalanceTimeout = 30 * time.Second // the kafka-go default
+
+// groupReader reads the topics of a consumer group using a kafka-go consumer
+// group directly, rather than a kafka-go reader, which has no way of reporting
+// partitions being assigned and revoked. Each generation of the group reads its
+// assigned partitions with a kafka-go reader per partition.
+//
+// The assigned function is called from FetchMessage before the first message of
+// a generation is returned. The revoked function is called once the generation
+// ends, after which any message from it that has not been fetched is dropped, and
+// the group waits for the fetched messages to be committed before re-joining.
+type groupReader struct {
+	conf      kafka.ReaderConfig
+	group     *kafka.ConsumerGroup
+	newReader func(conf kafka.ReaderConfig) partitionReader
+	assigned  func(ctx context.Context, generation int, partitions map[string][]int)
+	revoked   func(ctx context.Context, generation int, partitions map[string][]int)
+
+	msgs      chan groupMessage
+	cancel    context.CancelFunc
+	closed    chan struct{}
+	done      chan struct{} // closed once run returns
+	closeOnce sync.Once
+
+	callbackMu sync.Mutex // held while calling assigned or revoked
+	mu         sync.Mutex
+	current    *groupGeneration // the generation messages are fetched from, nil between generations
+	last       *groupGeneration // the generation messages are committed to
+	joined     *groupGeneration // the generation last joined, committed to until messages are fetched
+	joinedCh   chan struct{}    // closed once the group is first joined
+	readers    map[partitionReader]struct{}
+}
+
+// partitionReader reads a partition assigned to a groupReader, and is
+// implemented by *kafka.Reader and the Data Dog traced reader.
+type partitionReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	SetOffset(offset int64) error
+	Stats() kafka.ReaderStats
+	Close() error
+}
+
+// groupGeneration tracks the messages fetched and committed in a generation.
+type groupGeneration struct {
+	*kafka.Generation
+	partitions map[string][]int
+	notified   bool // whether assigned has been called for the generation
+
+	mu        sync.Mutex
+	fetched   map[topicPartition]int64 // the offset after the last message fetched
+	committed map[topicPartition]int64
+	changed   chan struct{} // closed and replaced whenever an offset is committed
+}
+
+// groupMessage is a message fetched from a generation, or if assigned is set, the
+// start of a generation.
+type groupMessage struct {
+	gen      *groupGeneration
+	msg      kafka.Message
+	assigned bool
+}
+
+// newGroupReader returns a new groupReader joining the group, reading each
+// assigned partition with a reader from newReader. Like kafka.NewReader, it
+// panics if the config is invalid.
+func newGroupReader(
+	conf kafka.ReaderConfig,
+	newReader func(conf kafka.ReaderConfig) partitionReader,
+	assigned, revoked func(ctx context.Context, generation int, partitions map[string][]int),
+) *groupReader {
+	topics := conf.GroupTopics
+	if len(topics) == 0 {
+		topics = []string{conf.Topic}
+	}
+	if conf.RebalanceTimeout == 0 {
+		conf.RebalanceTimeout = groupRebalanceTimeout
+	}
+
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:                     conf.GroupID,
+		Brokers:                conf.Brokers,
+		Dialer:                 conf.Dialer,
+		Topics:                 topics,
+		GroupBalancers:         conf.GroupBalancers,
+		HeartbeatInterval:      conf.HeartbeatInterval,
+		PartitionWatchInterval: conf.PartitionWatchInterval,
+		WatchPartitionChanges:  conf.WatchPartitionChanges,
+		SessionTimeout:         conf.SessionTimeout,
+		RebalanceTimeout:       conf.RebalanceTimeout,
+		JoinGroupBackoff:       conf.JoinGroupBackoff,
+		RetentionTime:          conf.RetentionTime,
+		StartOffset:            conf.StartOffset,
+		Logger:                 conf.Logger,
+		ErrorLogger:            conf.ErrorLogger,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &groupReader{
+		conf:      conf,
+		group:     group,
+		newReader: newReader,
+		assigned:  assigned,
+		revoked:   revoked,
+		msgs:      make(chan groupMessage, max(conf.QueueCapacity, 1)),
+		cancel:    cancel,
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+		readers:   make(map[partitionReader]struct{}),
+		joinedCh:  make(chan struct{}),
+	}
+	go r.run(ctx)
+
+	return r
+}
+
+// run starts reading each generation of the group until the reader is closed.
+func (r *groupReader) run(ctx context.Context) {
+	defer close(r.done)
+
+	for {
+		gen, err := r.group.Next(ctx)
+		if err != nil {
+			if errors.Is(err, kafka.ErrGroupClosed) || ctx.Err() != nil {
+				return
+			}
+			r.conf.ErrorLogger.Printf("unable to join consumer group %s: %v", r.conf.GroupID, err)
+			continue
+		}
+
+		g := &groupGeneration{
+			Generation: gen,
+			partitions: make(map[string][]int),
+			fetched:    make(map[topicPartition]int64),
+			committed:  make(map[topicPartition]int64),
+			changed:    make(chan struct{}),
+		}
+		for topic, assignments := range gen.Assignments {
+			for _, a := range assignments {
+				g.partitions[topic] = append(g.partitions[topic], a.ID)
+			}
+			sort.Ints(g.partitions[topic])
+		}
+
+		r.mu.Lock()
+		if r.joined == nil {
+			close(r.joinedCh)
+		}
+		r.joined = g
+		r.mu.Unlock()
+
+		// The generation ends as soon as any function started in it returns, so
+		// this waits for the end of the generation.
+		gen.Start(func(ctx context.Context) {
+			select {
+			case r.msgs <- groupMessage{gen: g, assigned: true}:
+				r.readPartitions(g)
+			case <-ctx.Done():
+			}
+			<-ctx.Done()
+			r.end(g)
+		})
+	}
+}
+
+// readPartitions starts reading each partition assigned in the generation. It is
+// called once the start of the generation is queued, so that it is fetched before
+// any message from the generation.
+func (r *groupReader) readPartitions(g *groupGeneration) {
+	for topic, assignments := range g.Assignments {
+		for _, a := range assignments {
+			g.Start(func(ctx context.Context) {
+				r.readPartition(ctx, g, topic, a)
+			})
+		}
+	}
+}
+
+func (r *groupReader) readPartition(ctx context.Context, g *groupGeneration, topic string, a kafka.PartitionAssignment) {
+	reader := r.newReader(kafka.ReaderConfig{
+		Brokers:        r.conf.Brokers,
+		Topic:          topic,
+		Partition:      a.ID,
+		Dialer:         r.conf.Dialer,
+		QueueCapacity:  r.conf.QueueCapacity,
+		MinBytes:       r.conf.MinBytes,
+		MaxBytes:       r.conf.MaxBytes,
+		MaxWait:        r.conf.MaxWait,
+		IsolationLevel: r.conf.IsolationLevel,
+		MaxAttempts:    r.conf.MaxAttempts,
+		Logger:         r.conf.Logger,
+		ErrorLogger:    r.conf.ErrorLogger,
+	})
+	r.addReader(reader)
+	defer r.removeReader(reader)
+
+	if err := reader.SetOffset(a.Offset); err != nil {
+		r.conf.ErrorLogger.Printf("unable to set offset of topic %s partition %d: %v", topic, a.ID, err)
+		return
+	}
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return // only returns an error once the generation ends
+		}
+
+		select {
+		case r.msgs <- groupMessage{gen: g, msg: msg}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *groupReader) addReader(reader partitionReader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readers[reader] = struct{}{}
+}
+
+func (r *groupReader) removeReader(reader partitionReader) {
+	r.mu.Lock()
+	delete(r.readers, reader)
+	r.mu.Unlock()
+
+	_ = reader.Close()
+}
+
+// PartitionStats returns the stats of the reader of each partition currently
+// assigned, see partitionStatsReader, ordered by topic and partition. Like the
+// kafka-go reader, counters are reset by each call.
+func (r *groupReader) PartitionStats() []kafka.ReaderStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]kafka.ReaderStats, 0, len(r.readers))
+	for reader := range r.readers {
+		stats = append(stats, reader.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Topic != stats[j].Topic {
+			return stats[i].Topic < stats[j].Topic
+		}
+		pi, _ := strconv.Atoi(stats[i].Partition)
+		pj, _ := strconv.Atoi(stats[j].Partition)
+		return pi < pj
+	})
+
+	return stats
+}
+
+// end reports the partitions of the generation as revoked, then waits for the
+// messages fetched from it to be committed.
+func (r *groupReader) end(g *groupGeneration) {
+	r.mu.Lock()
+	if r.current == g {
+		r.current = nil // drop any messages from the generation not yet fetched
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.conf.RebalanceTimeout)
+	defer cancel()
+
+	r.callbackMu.Lock()
+	notified := g.notified
+	if notified {
+		r.revoked(ctx, int(g.ID), g.partitions)
+	}
+	r.callbackMu.Unlock()
+
+	if notified {
+		g.waitUntilCommitted(ctx, r.closed)
+	}
+}
+
+// FetchMessage returns the next message from the partitions assigned to the
+// reader, calling assigned first if it is from a new generation.
+func (r *groupReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-r.closed:
+			return kafka.Message{}, io.EOF
+		case m := <-r.msgs:
+			if m.assigned {
+				r.start(ctx, m.gen)
+				continue
+			}
+			if r.fetched(m) {
+				return m.msg, nil
+			}
+		}
+	}
+}
+
+func (r *groupReader) start(ctx context.Context, g *groupGeneration) {
+	r.callbackMu.Lock()
+	defer r.callbackMu.Unlock()
+
+	r.mu.Lock()
+	r.current = g
+	r.last = g
+	r.mu.Unlock()
+
+	g.notified = true
+	r.assigned(ctx, int(g.ID), g.partitions)
+}
+
+// fetched records the message as fetched, returning false if it is from a
+// generation that has ended.
+func (r *groupReader) fetched(m groupMessage) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m.gen != r.current {
+		return false
+	}
+
+	m.gen.mu.Lock()
+	defer m.gen.mu.Unlock()
+	m.gen.fetched[topicPartition{topic: m.msg.Topic, partition: m.msg.Partition}] = m.msg.Offset + 1
+	return true
+}
+
+// ReadMessage fetches the next message and commits it straight away.
+func (r *groupReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	msg, err := r.FetchMessage(ctx)
+	if err != nil {
+		return msg, err
+	}
+	return msg, r.CommitMessages(ctx, msg)
+}
+
+// CommitMessages commits the offsets of the messages for the consumer group. If
+// the group has not been joined yet, it waits until it is.
+func (r *groupReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	select {
+	case <-r.joinedCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.closed:
+		return io.ErrClosedPipe
+	}
+
+	r.mu.Lock()
+	g := r.last
+	if g == nil {
+		g = r.joined
+	}
+	r.mu.Unlock()
+
+	offsets := make(map[string]map[int]int64)
+	for _, msg := range msgs {
+		if offsets[msg.Topic] == nil {
+			offsets[msg.Topic] = make(map[int]int64)
+		}
+		offsets[msg.Topic][msg.Partition] = max(offsets[msg.Topic][msg.Partition], msg.Offset+1)
+	}
+
+	if err := g.CommitOffsets(offsets); err != nil {
+		return err
+	}
+	g.commit(offsets)
+
+	return nil
+}
+
+// Close leaves the consumer group, once the partitions have been revoked.
+func (r *groupReader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		r.cancel()
+		err = r.group.Close()
+		<-r.done
+	})
+	return err
+}
+
+func (g *groupGeneration) commit(offsets map[string]map[int]int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			tp := topicPartition{topic: topic, partition: partition}
+			g.committed[tp] = max(g.committed[tp], offset)
+		}
+	}
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// waitUntilCommitted waits until every message fetched from the generation has
+// been committed, the context is done, or closed is closed.
+func (g *groupGeneration) waitUntilCommitted(ctx context.Context, closed <-chan struct{}) {
+	for {
+		g.mu.Lock()
+		pending := false
+		for tp, offset := range g.fetched {
+			if g.committed[tp] < offset {
+				pending = true
+				break
+			}
+		}
+		changed := g.changed
+		g.mu.Unlock()
+
+		if !pending {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			return
+		case <-changed:
+		}
+	}
+}
@@ -2,6 +2,7 @@ package consumer
 
 import (
 	"context"
+	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/go-errors/errors"
@@ -17,9 +18,133 @@ type messageHandler struct {
 	DataDogTracingEnabled bool
 	BackOffConstructor    HandlerRetryBackOffConstructor
 	clientNotify          NotifyError
+	deadLetter            *deadLetterQueue
+	retryTopics           *retryTopics
+	metrics               Metrics
+	health                *healthTracker
 }
 
-func (h *messageHandler) dispatch(ctx context.Context, msg kafka.Message, handler Handler) error {
+func (h *messageHandler) dispatch(ctx context.Context, msg kafka.Message, generation int, handler Handler) error {
+	ctx = contextWithRequestHeaders(ctx, msg.Headers)
+
+	if h.DataDogTracingEnabled {
+		spanCtx, err := kafkatrace.ExtractSpanContext(msg)
+		if err != nil {
+			return errors.Errorf("unable to extract data dog span context from kafka message: %w", err)
+		}
+		span := tracer.StartSpan("consumer.handle", tracer.ChildOf(spanCtx))
+		defer span.Finish()
+		ctx = tracer.ContextWithSpan(ctx, span)
+	}
+
+	tags := h.metricTags(msg.Topic)
+	attempts := 0
+	track := h.health.handling()
+	defer track(0)
+
+	err := h.retry(ctx,
+		func(attempt int) error {
+			attempts = attempt
+			track(attempt)
+			consumerMsg := Message{
+				Message:  msg,
+				Metadata: h.dispatchMetadata(msg, generation, attempt),
+			}
+
+			start := time.Now()
+			err := handler(ctx, consumerMsg)
+			h.metrics.HandlerAttempt(tags, attempt, time.Since(start), err)
+			if err != nil {
+				h.clientNotify(ctx, err, consumerMsg)
+			}
+			return err
+		},
+		func(err error, attempt int) error {
+			return h.giveUp(ctx, msg, err, h.dispatchMetadata(msg, generation, attempt))
+		},
+	)
+
+	if attempts > 0 {
+		h.metrics.MessageConsumed(tags, attempts, err)
+	}
+	return err
+}
+
+// dispatchBatch handles the messages, each fetched in the generation at the same
+// index of generations.
+func (h *messageHandler) dispatchBatch(ctx context.Context, msgs []kafka.Message, generations []int, handler BatchHandler) error {
+	if h.DataDogTracingEnabled {
+		span := tracer.StartSpan("consumer.handle_batch", tracer.Tag("batch_size", len(msgs)))
+		defer span.Finish()
+		ctx = tracer.ContextWithSpan(ctx, span)
+	}
+
+	attempts := 0
+	track := h.health.handling()
+	defer track(0)
+
+	err := h.retry(ctx,
+		func(attempt int) error {
+			attempts = attempt
+			track(attempt)
+			batch := make([]Message, len(msgs))
+			for i, msg := range msgs {
+				batch[i] = Message{
+					Message:  msg,
+					Metadata: h.dispatchMetadata(msg, generations[i], attempt),
+				}
+			}
+
+			start := time.Now()
+			err := handler(ctx, batch)
+			h.metrics.HandlerAttempt(h.metricTags(msgs[0].Topic), attempt, time.Since(start), err)
+			if err != nil {
+				for _, consumerMsg := range batch {
+					h.clientNotify(ctx, err, consumerMsg)
+				}
+			}
+			return err
+		},
+		func(err error, attempt int) error {
+			for i, msg := range msgs {
+				if giveUpErr := h.giveUp(ctx, msg, err, h.dispatchMetadata(msg, generations[i], attempt)); giveUpErr != nil {
+					return giveUpErr
+				}
+			}
+			return nil
+		},
+	)
+
+	if attempts > 0 {
+		for _, msg := range msgs {
+			h.metrics.MessageConsumed(h.metricTags(msg.Topic), attempts, err)
+		}
+	}
+	return err
+}
+
+// permanentError wraps the errors returned by this package that will never
+// succeed when retried, such as a message that can't be decoded, so that retry
+// gives up straight away. Errors returned by client handlers are always retried.
+type permanentError struct {
+	err error
+}
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// retry calls handle until it succeeds, the back off gives up, or it returns a
+// permanent error, in which case giveUp is called with the last handler error.
+func (h *messageHandler) retry(ctx context.Context, handle func(attempt int) error, giveUp func(err error, attempt int) error) error {
 	var err error
 	var backOff backoff.BackOff
 
@@ -33,16 +158,6 @@ func (h *messageHandler) dispatch(ctx context.Context, msg kafka.Message, handle
 	ticker := backoff.NewTicker(backOff)
 	defer ticker.Stop()
 
-	if h.DataDogTracingEnabled {
-		spanCtx, err := kafkatrace.ExtractSpanContext(msg)
-		if err != nil {
-			return errors.Errorf("unable to extract data dog span context from kafka message: %w", err)
-		}
-		span := tracer.StartSpan("consumer.handle", tracer.ChildOf(spanCtx))
-		defer span.Finish()
-		ctx = tracer.ContextWithSpan(ctx, span)
-	}
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -52,26 +167,65 @@ func (h *messageHandler) dispatch(ctx context.Context, msg kafka.Message, handle
 			return errors.Errorf("consumer handler error: %w", err)
 		case _, ok := <-ticker.C:
 			if !ok {
-				return err
+				return giveUp(err, attempt)
 			}
 		}
 
 		attempt++
 
-		consumerMsg := Message{
-			Message: msg,
-			Metadata: Metadata{
-				GroupID:    h.GroupID,
-				ConsumerID: h.ConsumerID,
-				Attempt:    attempt,
-			},
-		}
-
-		if err = handler(ctx, consumerMsg); err != nil {
-			h.clientNotify(ctx, err, consumerMsg)
+		if err = handle(attempt); err != nil {
+			// Permanent errors will never succeed, so there is no point retrying.
+			var permanentErr *permanentError
+			if errors.As(err, &permanentErr) {
+				return giveUp(err, attempt)
+			}
 			continue
 		}
 
 		return nil
 	}
 }
+
+// giveUp is called once the handler will no longer be retried for the message.
+func (h *messageHandler) giveUp(ctx context.Context, msg kafka.Message, err error, metadata Metadata) error {
+	if h.retryTopics != nil {
+		if tier, ok := h.retryTopics.next(msg); ok {
+			return h.retryTopics.publish(ctx, tier, msg, err)
+		}
+	}
+
+	if h.deadLetter != nil {
+		return h.deadLetter.publish(ctx, msg, err, metadata)
+	}
+
+	return err
+}
+
+func (h *messageHandler) metricTags(topic string) MetricTags {
+	return MetricTags{
+		Topic:      topic,
+		GroupID:    h.GroupID,
+		ConsumerID: h.ConsumerID,
+	}
+}
+
+func (h *messageHandler) dispatchMetadata(msg kafka.Message, generation, attempt int) Metadata {
+	return Metadata{
+		GroupID:     h.GroupID,
+		ConsumerID:  h.ConsumerID,
+		Attempt:     attempt,
+		SourceTopic: sourceTopic(msg),
+		Generation:  generation,
+	}
+}
+
+// sourceTopic returns the topic the message was first consumed from, which for
+// a message read from a retry topic is its original topic.
+func sourceTopic(msg kafka.Message) string {
+	for _, h := range msg.Headers {
+		if h.Key == RetryOriginalTopicHeader {
+			return string(h.Value)
+		}
+	}
+	return msg.Topic
+}
@@ -0,0 +1,280 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// consumerConnectionErrorWindow is how long a reader connection error stops a
+// consumer being ready, unless a message is fetched first.
+const consumerConnectionErrorWindow = time.Minute
+
+// Health reports the state of a consumer, see Consumer.Health.
+type Health struct {
+	ConsumerID string   `json:"consumerId"`
+	GroupID    string   `json:"groupId,omitempty"`
+	Topics     []string `json:"topics"`
+
+	// Healthy is false once Run has returned an error.
+	Healthy bool `json:"healthy"`
+	// Ready is true while the consumer is running and has not had a reader
+	// connection error in the last minute without fetching a message since.
+	Ready   bool `json:"ready"`
+	Running bool `json:"running"`
+	Paused  bool `json:"paused"`
+
+	// LastMessageAt is when a message was last fetched, or zero if none has been.
+	LastMessageAt time.Time `json:"lastMessageAt"`
+	// Attempt is the highest handler attempt of the messages being handled, or 0
+	// if none are. Above 1 means the handler is being retried with back off.
+	Attempt int `json:"attempt"`
+	// Lag is the number of messages behind the end of the partitions, as of the
+	// last message fetched from each partition.
+	Lag int64 `json:"lag"`
+
+	// ConnectionErrors is the number of reader connection errors since a message
+	// was last fetched. They are only reported for readers created by the
+	// consumer, which log them to the error logger rather than returning them.
+	ConnectionErrors      int       `json:"connectionErrors"`
+	LastConnectionError   string    `json:"lastConnectionError,omitempty"`
+	LastConnectionErrorAt time.Time `json:"lastConnectionErrorAt"`
+
+	// Error is the error Run returned, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// GroupHealth reports the state of each consumer in a group, see Group.Health.
+type GroupHealth struct {
+	GroupID string `json:"groupId"`
+	// Healthy is true if every consumer in the group is healthy.
+	Healthy bool `json:"healthy"`
+	// Ready is true once the group is running and every consumer is ready.
+	Ready   bool     `json:"ready"`
+	Members []Health `json:"members"`
+}
+
+// HealthChecker is implemented by Consumer and Group, so that either can be
+// served by HealthHandler.
+type HealthChecker interface {
+	healthCheck() (healthy bool, ready bool, report any)
+}
+
+// Health returns the current state of the consumer. It is safe to call at any
+// time, including while the consumer is running.
+func (c *Consumer) Health() Health {
+	topics := c.conf.GroupTopics
+	if len(topics) == 0 {
+		topics = []string{c.conf.Topic}
+	}
+
+	h := Health{
+		ConsumerID: c.id,
+		GroupID:    c.conf.GroupID,
+		Topics:     topics,
+		Running:    c.isRunning(),
+		Paused:     c.gate.isPaused(),
+	}
+	c.health.report(&h)
+
+	h.Healthy = h.Error == ""
+	h.Ready = h.Running && (h.ConnectionErrors == 0 || time.Since(h.LastConnectionErrorAt) > consumerConnectionErrorWindow)
+
+	return h
+}
+
+func (c *Consumer) healthCheck() (bool, bool, any) {
+	h := c.Health()
+	return h.Healthy, h.Ready, h
+}
+
+// Health returns the current state of every consumer in the group. Consumers are
+// only created once the group is run, so a group that is not running has no
+// members and is not ready.
+func (g *Group) Health() GroupHealth {
+	g.mu.Lock()
+	consumers := append([]*Consumer{}, g.consumers...)
+	g.mu.Unlock()
+
+	h := GroupHealth{
+		GroupID: g.config.GroupID,
+		Healthy: true,
+		Ready:   len(consumers) > 0,
+		Members: make([]Health, len(consumers)),
+	}
+	for i, c := range consumers {
+		h.Members[i] = c.Health()
+		h.Healthy = h.Healthy && h.Members[i].Healthy
+		h.Ready = h.Ready && h.Members[i].Ready
+	}
+
+	return h
+}
+
+func (g *Group) healthCheck() (bool, bool, any) {
+	h := g.Health()
+	return h.Healthy, h.Ready, h
+}
+
+// HealthHandler returns an http.Handler serving the health of the consumers and
+// groups as JSON. Requests to a path ending in /ready respond with 503 Service
+// Unavailable unless every one is ready, and requests to any other path, such as
+// /health, respond with it unless every one is healthy.
+//
+//	mux.Handle("/health", consumer.HealthHandler(group, retryGroup))
+//	mux.Handle("/ready", consumer.HealthHandler(group, retryGroup))
+func HealthHandler(checkers ...HealthChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := struct {
+			Healthy bool  `json:"healthy"`
+			Ready   bool  `json:"ready"`
+			Checks  []any `json:"checks"`
+		}{Healthy: true, Ready: true, Checks: make([]any, len(checkers))}
+
+		for i, checker := range checkers {
+			healthy, ready, report := checker.healthCheck()
+			resp.Healthy = resp.Healthy && healthy
+			resp.Ready = resp.Ready && ready
+			resp.Checks[i] = report
+		}
+
+		ok := resp.Healthy
+		if path.Base(r.URL.Path) == "ready" {
+			ok = resp.Ready
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if ok {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// healthTracker records the state of a consumer reported by Consumer.Health.
+// Its methods are safe to call on a nil tracker, which records nothing.
+type healthTracker struct {
+	mu            sync.Mutex
+	lastMessageAt time.Time
+	lag           map[topicPartition]int64
+	attempts      map[int]int // by handling ID
+	nextID        int
+
+	connectionErrors      int
+	lastConnectionError   string
+	lastConnectionErrorAt time.Time
+
+	err error
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{
+		lag:      make(map[topicPartition]int64),
+		attempts: make(map[int]int),
+	}
+}
+
+// fetched records a message being fetched.
+func (t *healthTracker) fetched(msg kafka.Message) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastMessageAt = time.Now()
+	t.connectionErrors = 0
+	if msg.HighWaterMark > 0 {
+		t.lag[topicPartition{topic: msg.Topic, partition: msg.Partition}] = max(msg.HighWaterMark-msg.Offset-1, 0)
+	}
+}
+
+// handling records a message starting to be handled. The returned func records
+// each handler attempt, and must be called with 0 once the message is handled.
+func (t *healthTracker) handling() func(attempt int) {
+	if t == nil {
+		return func(int) {}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := t.nextID
+	t.nextID++
+
+	return func(attempt int) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if attempt == 0 {
+			delete(t.attempts, id)
+			return
+		}
+		t.attempts[id] = attempt
+	}
+}
+
+// errorLogger wraps the reader error logger to record connection errors.
+func (t *healthTracker) errorLogger(logger kafka.Logger) kafka.Logger {
+	return kafka.LoggerFunc(func(msg string, args ...interface{}) {
+		t.mu.Lock()
+		t.connectionErrors++
+		t.lastConnectionError = fmt.Sprintf(msg, args...)
+		t.lastConnectionErrorAt = time.Now()
+		t.mu.Unlock()
+
+		logger.Printf(msg, args...)
+	})
+}
+
+// running records the consumer starting to run.
+func (t *healthTracker) running() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lag = make(map[topicPartition]int64)
+	t.err = nil
+}
+
+// stopped records the error the consumer stopped running with, if any.
+func (t *healthTracker) stopped(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.attempts = make(map[int]int)
+	t.err = err
+}
+
+func (t *healthTracker) report(h *Health) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h.LastMessageAt = t.lastMessageAt
+	for _, attempt := range t.attempts {
+		h.Attempt = max(h.Attempt, attempt)
+	}
+	for _, lag := range t.lag {
+		h.Lag += lag
+	}
+	h.ConnectionErrors = t.connectionErrors
+	h.LastConnectionError = t.lastConnectionError
+	h.LastConnectionErrorAt = t.lastConnectionErrorAt
+	if t.err != nil {
+		h.Error = t.err.Error()
+	}
+}
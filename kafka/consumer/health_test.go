@@ -0,0 +1,178 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+)
+
+func TestConsumer_Health(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), offsetMsgs(5)...))
+
+	c := NewConsumer(Config{ID: "some-consumer", Topic: "some-topic"},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+		WithExplicitCommit(),
+		WithHandlerBackOffRetry(func() backoff.BackOff { return backoff.NewConstantBackOff(time.Millisecond) }),
+	)
+
+	h := c.Health()
+	assert.Equal(t, Health{ConsumerID: "some-consumer", Topics: []string{"some-topic"}, Healthy: true}, h)
+	assert.False(t, h.Ready, "a consumer is not ready until it is running")
+
+	retrying := make(chan struct{})
+	release := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+			if msg.Offset != 0 {
+				return nil
+			}
+			if msg.Attempt == 1 {
+				return errors.New("some handler error")
+			}
+			close(retrying)
+			<-release
+			return nil
+		})
+	}()
+
+	<-retrying
+	h = c.Health()
+	assert.True(t, h.Running)
+	assert.True(t, h.Ready)
+	assert.Equal(t, 2, h.Attempt)
+	assert.Equal(t, int64(4), h.Lag)
+	assert.WithinDuration(t, time.Now(), h.LastMessageAt, time.Second)
+
+	close(release)
+	require.Eventually(t, func() bool { return c.Health().Lag == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, c.Health().Attempt)
+
+	c.Pause()
+	assert.True(t, c.Health().Paused)
+
+	require.NoError(t, c.Stop())
+	require.NoError(t, <-errCh)
+	h = c.Health()
+	assert.False(t, h.Running)
+	assert.False(t, h.Ready)
+	assert.True(t, h.Healthy)
+}
+
+func TestConsumer_Health_error(t *testing.T) {
+	reader := NewMockReader(gomock.NewController(t))
+	reader.EXPECT().ReadMessage(gomock.Any()).Return(kafka.Message{}, errors.New("some reader error"))
+	reader.EXPECT().Close()
+
+	c := NewConsumer(Config{}, WithKafkaReader(func() Reader { return reader }))
+	require.Error(t, c.Run(context.Background(), func(ctx context.Context, msg Message) error { return nil }))
+
+	h := c.Health()
+	assert.False(t, h.Healthy)
+	assert.Contains(t, h.Error, "some reader error")
+	require.NoError(t, c.Stop())
+}
+
+func TestConsumer_Health_connectionError(t *testing.T) {
+	c := NewConsumer(Config{Brokers: []string{"localhost:9092"}, Topic: "some-topic"})
+	defer c.Stop()
+
+	c.conf.ErrorLogger.Printf("unable to connect to %s", "some-broker")
+
+	h := c.Health()
+	assert.Equal(t, 1, h.ConnectionErrors)
+	assert.Equal(t, "unable to connect to some-broker", h.LastConnectionError)
+	assert.WithinDuration(t, time.Now(), h.LastConnectionErrorAt, time.Second)
+}
+
+func TestGroup_Health(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	broker.CreateTopic("some-topic", 2)
+
+	group := NewGroup(GroupConfig{Count: 2, Topic: "some-topic", GroupID: "some-group"},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+	)
+
+	h := group.Health()
+	assert.True(t, h.Healthy)
+	assert.False(t, h.Ready, "a group is not ready until it is running")
+	assert.Empty(t, h.Members)
+
+	errCh := group.Run(context.Background(), func(ctx context.Context, msg Message) error { return nil })
+	require.Eventually(t, func() bool { return group.Health().Ready }, time.Second, time.Millisecond)
+	h = group.Health()
+	assert.Equal(t, "some-group", h.GroupID)
+	assert.Len(t, h.Members, 2)
+
+	_, err := group.Shutdown(context.Background())
+	require.NoError(t, err)
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+	assert.False(t, group.Health().Ready)
+}
+
+func TestHealthHandler(t *testing.T) {
+	running := NewConsumer(Config{ID: "some-consumer"},
+		WithKafkaReader(func() Reader { return newQueueReader() }),
+	)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- running.Run(context.Background(), func(ctx context.Context, msg Message) error { return nil })
+	}()
+	require.Eventually(t, func() bool { return running.Health().Ready }, time.Second, time.Millisecond)
+	defer func() {
+		require.NoError(t, running.Stop())
+		require.NoError(t, <-errCh)
+	}()
+
+	group := NewGroup(GroupConfig{Topic: "some-topic", GroupID: "some-group"})
+
+	tests := []struct {
+		name       string
+		checkers   []HealthChecker
+		path       string
+		wantStatus int
+	}{
+		{name: "health", checkers: []HealthChecker{running, group}, path: "/health", wantStatus: http.StatusOK},
+		{name: "not ready", checkers: []HealthChecker{running, group}, path: "/ready", wantStatus: http.StatusServiceUnavailable},
+		{name: "ready", checkers: []HealthChecker{running}, path: "/ready", wantStatus: http.StatusOK},
+		{name: "nested ready", checkers: []HealthChecker{running}, path: "/kafka/ready", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			HealthHandler(tt.checkers...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var resp struct {
+				Healthy bool              `json:"healthy"`
+				Ready   bool              `json:"ready"`
+				Checks  []json.RawMessage `json:"checks"`
+			}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.True(t, resp.Healthy)
+			assert.Len(t, resp.Checks, len(tt.checkers))
+
+			var h Health
+			require.NoError(t, json.Unmarshal(resp.Checks[0], &h))
+			assert.Equal(t, "some-consumer", h.ConsumerID)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/cultureamp/ca-go/sentry"
+)
+
+const idempotencyTTL = 24 * time.Hour
+
+// IdempotencyStore records which messages have been processed, so they can be
+// skipped when Kafka redelivers them after a rebalance or crash.
+type IdempotencyStore interface {
+	// Seen returns true if the key has been marked as processed and has not yet
+	// expired.
+	Seen(ctx context.Context, key string) (bool, error)
+	// MarkProcessed records the key as processed until the ttl has passed.
+	MarkProcessed(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// IdempotencyKey returns the key a message is deduplicated on. Messages with an
+// empty key are always handled.
+type IdempotencyKey func(msg Message) string
+
+// IdempotencyKeyFromOffset deduplicates messages on their topic, partition and
+// offset, so only redeliveries of the exact same message are skipped. This is
+// the default.
+func IdempotencyKeyFromOffset() IdempotencyKey {
+	return func(msg Message) string {
+		return msg.Topic + "/" + strconv.Itoa(msg.Partition) + "/" + strconv.FormatInt(msg.Offset, 10)
+	}
+}
+
+// IdempotencyKeyFromMessageKey deduplicates messages on their topic and message
+// key. Only use this if each message has a unique key, such as an event ID.
+func IdempotencyKeyFromMessageKey() IdempotencyKey {
+	return func(msg Message) string {
+		if len(msg.Key) == 0 {
+			return ""
+		}
+		return msg.Topic + "/" + string(msg.Key)
+	}
+}
+
+// IdempotencyKeyFromHeader deduplicates messages on the value of the header,
+// such as an event ID header set by the producer.
+func IdempotencyKeyFromHeader(header string) IdempotencyKey {
+	return func(msg Message) string {
+		for _, h := range msg.Headers {
+			if h.Key == header {
+				return string(h.Value)
+			}
+		}
+		return ""
+	}
+}
+
+type idempotency struct {
+	store       IdempotencyStore
+	key         IdempotencyKey
+	ttl         time.Duration
+	notifyError NotifyError
+}
+
+// IdempotencyOption configures IdempotencyMiddleware.
+type IdempotencyOption func(i *idempotency)
+
+// WithIdempotencyKey sets the key messages are deduplicated on.
+//
+// Default: IdempotencyKeyFromOffset.
+func WithIdempotencyKey(key IdempotencyKey) IdempotencyOption {
+	return func(i *idempotency) {
+		i.key = key
+	}
+}
+
+// WithIdempotencyTTL sets how long a processed message is remembered for. It
+// should be longer than a message could reasonably be redelivered after.
+//
+// Default: 24 hours.
+func WithIdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(i *idempotency) {
+		i.ttl = ttl
+	}
+}
+
+// WithIdempotencyNotifyError sets the function called when a message was handled
+// successfully but could not be marked as processed in the store.
+//
+// Default: the error is reported to Sentry using sentry.ReportError.
+func WithIdempotencyNotifyError(notify NotifyError) IdempotencyOption {
+	return func(i *idempotency) {
+		i.notifyError = notify
+	}
+}
+
+// IdempotencyMiddleware returns a handler middleware that skips messages which
+// have already been processed successfully, giving exactly-once style handling
+// on top of Kafka's at-least-once delivery. A message is marked as processed in
+// the store once the handler succeeds.
+//
+// Keys are scoped to the consumer group, so groups consuming the same topic can
+// share a store. The store is checked on every attempt of a message, as an
+// earlier attempt may have failed checking the store rather than handling the
+// message.
+//
+// If the message can't be marked as processed, the error is reported (see
+// WithIdempotencyNotifyError) rather than returned, as returning it would retry
+// the handler and process the message twice. The message may then be processed
+// again if it is redelivered.
+func IdempotencyMiddleware(store IdempotencyStore, opts ...IdempotencyOption) Middleware {
+	i := &idempotency{
+		store: store,
+		key:   IdempotencyKeyFromOffset(),
+		ttl:   idempotencyTTL,
+		notifyError: func(ctx context.Context, err error, _ Message) {
+			sentry.ReportError(ctx, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) error {
+			key := i.key(msg)
+			if key == "" {
+				return next(ctx, msg)
+			}
+			key = msg.Metadata.GroupID + "/" + key
+
+			seen, err := i.store.Seen(ctx, key)
+			if err != nil {
+				return errors.Errorf("unable to check idempotency key %s: %w", key, err)
+			}
+			if seen {
+				return nil // already processed, so this is a redelivery
+			}
+
+			if err := next(ctx, msg); err != nil {
+				return err
+			}
+
+			if err := i.store.MarkProcessed(ctx, key, i.ttl); err != nil {
+				// the message was handled, so don't retry it
+				i.notifyError(ctx, errors.Errorf("unable to mark idempotency key %s as processed: %w", key, err), msg)
+			}
+			return nil
+		}
+	}
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore. Processed keys are
+// not shared between instances or kept across restarts, so it is best suited to
+// tests and single instance consumers.
+type MemoryIdempotencyStore struct {
+	cache *cache.Cache
+}
+
+// NewMemoryIdempotencyStore returns a new empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		cache: cache.New(idempotencyTTL, time.Minute),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Seen(_ context.Context, key string) (bool, error) {
+	_, ok := s.cache.Get(key)
+	return ok, nil
+}
+
+func (s *MemoryIdempotencyStore) MarkProcessed(_ context.Context, key string, ttl time.Duration) error {
+	s.cache.Set(key, struct{}{}, ttl)
+	return nil
+}
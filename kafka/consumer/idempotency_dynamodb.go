@@ -0,0 +1,102 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/go-errors/errors"
+)
+
+const (
+	// DynamoDBIdempotencyKeyAttribute is the string partition key of the
+	// idempotency table.
+	DynamoDBIdempotencyKeyAttribute = "id"
+	// DynamoDBIdempotencyExpiresAttribute is the number attribute holding when a
+	// key expires, in seconds since the Unix epoch. Enable DynamoDB TTL on this
+	// attribute to delete expired keys.
+	DynamoDBIdempotencyExpiresAttribute = "expires_at"
+)
+
+// DynamoDBClient is the subset of the DynamoDB client used by
+// DynamoDBIdempotencyStore.
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBIdempotencyStore is an IdempotencyStore backed by a DynamoDB table, so
+// processed keys are shared between instances. The table must have a string
+// partition key named "id", and should have DynamoDB TTL enabled on the
+// "expires_at" attribute.
+type DynamoDBIdempotencyStore struct {
+	client DynamoDBClient
+	table  string
+}
+
+// NewDynamoDBIdempotencyStore creates a new DynamoDBIdempotencyStore for the
+// table in the given region.
+func NewDynamoDBIdempotencyStore(ctx context.Context, region string, table string) (*DynamoDBIdempotencyStore, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, errors.Errorf("unable to load aws config: %w", err)
+	}
+
+	return NewDynamoDBIdempotencyStoreWithClient(dynamodb.NewFromConfig(cfg), table), nil
+}
+
+// NewDynamoDBIdempotencyStoreWithClient creates a new DynamoDBIdempotencyStore for
+// the table with a custom client.
+func NewDynamoDBIdempotencyStoreWithClient(client DynamoDBClient, table string) *DynamoDBIdempotencyStore {
+	return &DynamoDBIdempotencyStore{
+		client: client,
+		table:  table,
+	}
+}
+
+func (s *DynamoDBIdempotencyStore) Seen(ctx context.Context, key string) (bool, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]types.AttributeValue{DynamoDBIdempotencyKeyAttribute: &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, errors.Errorf("unable to get idempotency item: %w", err)
+	}
+	if out.Item == nil {
+		return false, nil
+	}
+
+	// DynamoDB TTL deletes expired items eventually, so they may still be returned.
+	expires, ok := out.Item[DynamoDBIdempotencyExpiresAttribute].(*types.AttributeValueMemberN)
+	if !ok {
+		return true, nil
+	}
+	expiresAt, err := strconv.ParseInt(expires.Value, 10, 64)
+	if err != nil {
+		return false, errors.Errorf("unable to parse idempotency item expiry: %w", err)
+	}
+
+	return time.Now().Unix() < expiresAt, nil
+}
+
+func (s *DynamoDBIdempotencyStore) MarkProcessed(ctx context.Context, key string, ttl time.Duration) error {
+	expiresAt := time.Now().Add(ttl).Unix()
+
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			DynamoDBIdempotencyKeyAttribute:     &types.AttributeValueMemberS{Value: key},
+			DynamoDBIdempotencyExpiresAttribute: &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)},
+		},
+	})
+	if err != nil {
+		return errors.Errorf("unable to put idempotency item: %w", err)
+	}
+
+	return nil
+}
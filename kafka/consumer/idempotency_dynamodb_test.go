@@ -0,0 +1,77 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDynamoDBIdempotencyStore(t *testing.T) {
+	store, err := NewDynamoDBIdempotencyStore(context.Background(), "us-west-2", "some-table")
+	require.NoError(t, err)
+	assert.NotNil(t, store)
+}
+
+func TestDynamoDBIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeDynamoDB{items: map[string]map[string]types.AttributeValue{}}
+	store := NewDynamoDBIdempotencyStoreWithClient(client, "some-table")
+
+	seen, err := store.Seen(ctx, "some-key")
+	require.NoError(t, err)
+	assert.False(t, seen)
+
+	require.NoError(t, store.MarkProcessed(ctx, "some-key", time.Hour))
+	seen, err = store.Seen(ctx, "some-key")
+	require.NoError(t, err)
+	assert.True(t, seen)
+
+	item := client.items["some-key"]
+	expiresAt, err := strconv.ParseInt(item["expires_at"].(*types.AttributeValueMemberN).Value, 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), expiresAt, 5)
+
+	// Expired items not yet deleted by DynamoDB TTL are not seen.
+	item["expires_at"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)}
+	seen, err = store.Seen(ctx, "some-key")
+	require.NoError(t, err)
+	assert.False(t, seen)
+}
+
+func TestDynamoDBIdempotencyStore_error(t *testing.T) {
+	wantErr := errors.New("some dynamodb error")
+	store := NewDynamoDBIdempotencyStoreWithClient(&fakeDynamoDB{err: wantErr}, "some-table")
+
+	_, err := store.Seen(context.Background(), "some-key")
+	assert.ErrorIs(t, err, wantErr)
+	assert.ErrorIs(t, store.MarkProcessed(context.Background(), "some-key", time.Hour), wantErr)
+}
+
+type fakeDynamoDB struct {
+	items map[string]map[string]types.AttributeValue
+	err   error
+}
+
+func (c *fakeDynamoDB) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	key := params.Key["id"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: c.items[key]}, nil
+}
+
+func (c *fakeDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	key := params.Item["id"].(*types.AttributeValueMemberS).Value
+	c.items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
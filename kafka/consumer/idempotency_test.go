@@ -0,0 +1,245 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	msg := Message{
+		Message:  kafka.Message{Topic: "some-topic", Partition: 1, Offset: 42, Key: []byte("some-key")},
+		Metadata: Metadata{GroupID: "some-group", Attempt: 1},
+	}
+
+	tests := []struct {
+		name    string
+		opts    []IdempotencyOption
+		wantKey string
+	}{
+		{
+			name:    "offset key by default",
+			wantKey: "some-group/some-topic/1/42",
+		},
+		{
+			name:    "message key",
+			opts:    []IdempotencyOption{WithIdempotencyKey(IdempotencyKeyFromMessageKey())},
+			wantKey: "some-group/some-topic/some-key",
+		},
+		{
+			name:    "header key",
+			opts:    []IdempotencyOption{WithIdempotencyKey(IdempotencyKeyFromHeader("event-id"))},
+			wantKey: "some-group/some-event-id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryIdempotencyStore()
+			calls := 0
+			handler := IdempotencyMiddleware(store, tt.opts...)(func(ctx context.Context, msg Message) error {
+				calls++
+				return nil
+			})
+
+			msg := msg
+			msg.Headers = []kafka.Header{{Key: "event-id", Value: []byte("some-event-id")}}
+
+			require.NoError(t, handler(context.Background(), msg))
+			require.NoError(t, handler(context.Background(), msg))
+			assert.Equal(t, 1, calls, "redelivered message should be skipped")
+
+			seen, err := store.Seen(context.Background(), tt.wantKey)
+			require.NoError(t, err)
+			assert.True(t, seen)
+		})
+	}
+}
+
+func TestIdempotencyMiddleware_emptyKey(t *testing.T) {
+	calls := 0
+	handler := IdempotencyMiddleware(NewMemoryIdempotencyStore(),
+		WithIdempotencyKey(IdempotencyKeyFromHeader("event-id")),
+	)(func(ctx context.Context, msg Message) error {
+		calls++
+		return nil
+	})
+
+	msg := Message{Metadata: Metadata{Attempt: 1}}
+	require.NoError(t, handler(context.Background(), msg))
+	require.NoError(t, handler(context.Background(), msg))
+	assert.Equal(t, 2, calls, "messages without a key should always be handled")
+}
+
+func TestIdempotencyMiddleware_retries(t *testing.T) {
+	wantErr := errors.New("some handler error")
+	store := &countingStore{MemoryIdempotencyStore: NewMemoryIdempotencyStore()}
+	reader := newQueueReader(offsetMsgs(1)...)
+
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithHandlerBackOffRetry(func() backoff.BackOff {
+			return &testBackoff{maxAttempts: 5}
+		}),
+	)
+
+	attempts := 0
+	handler := IdempotencyMiddleware(store)(func(ctx context.Context, msg Message) error {
+		attempts++
+		if attempts < 3 {
+			return wantErr
+		}
+		require.NoError(t, c.Stop())
+		return nil
+	})
+	require.NoError(t, c.Run(context.Background(), handler))
+
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 3, store.seenCalls, "every attempt should check the store")
+}
+
+func TestIdempotencyMiddleware_storeError(t *testing.T) {
+	wantErr := errors.New("some store error")
+	handler := IdempotencyMiddleware(&countingStore{err: wantErr})(func(ctx context.Context, msg Message) error {
+		require.Fail(t, "handler should not be called")
+		return nil
+	})
+
+	err := handler(context.Background(), Message{Metadata: Metadata{Attempt: 1}})
+	assert.ErrorIs(t, err, wantErr)
+}
+
+func TestIdempotencyMiddleware_seenErrorRetried(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryIdempotencyStore: NewMemoryIdempotencyStore(), err: errors.New("some store error"), failures: 1}
+	reader := newQueueReader(offsetMsgs(1)...)
+
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+		WithHandlerBackOffRetry(func() backoff.BackOff {
+			return &testBackoff{maxAttempts: 5}
+		}),
+	)
+
+	// the message was already processed, e.g. before a rebalance
+	require.NoError(t, store.MarkProcessed(ctx, "/some-topic/0/0", time.Hour))
+
+	handler := IdempotencyMiddleware(store)(func(ctx context.Context, msg Message) error {
+		require.Fail(t, "an already processed message should not be handled")
+		return nil
+	})
+	go func() {
+		assert.Eventually(t, func() bool { return len(reader.committedOffsets()) == 1 }, time.Second, time.Millisecond)
+		_ = c.Stop()
+	}()
+	require.NoError(t, c.Run(ctx, handler))
+
+	assert.Equal(t, 2, store.seenCalls, "the retry should check the store again")
+}
+
+func TestIdempotencyMiddleware_markProcessedError(t *testing.T) {
+	wantErr := errors.New("some store error")
+	store := &failingMarkStore{MemoryIdempotencyStore: NewMemoryIdempotencyStore(), err: wantErr}
+	reader := newQueueReader(offsetMsgs(1)...)
+
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithHandlerBackOffRetry(func() backoff.BackOff {
+			return &testBackoff{maxAttempts: 5}
+		}),
+	)
+
+	var notified []error
+	calls := 0
+	handler := IdempotencyMiddleware(store,
+		WithIdempotencyNotifyError(func(ctx context.Context, err error, msg Message) {
+			notified = append(notified, err)
+		}),
+	)(func(ctx context.Context, msg Message) error {
+		calls++
+		require.NoError(t, c.Stop())
+		return nil
+	})
+	require.NoError(t, c.Run(context.Background(), handler))
+
+	assert.Equal(t, 1, calls, "handler should not be retried once it succeeds")
+	require.Len(t, notified, 1)
+	assert.ErrorIs(t, notified[0], wantErr)
+}
+
+func TestIdempotencyMiddleware_redelivery(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), offsetMsgs(3)...))
+
+	reader := broker.Reader("some-group", "some-topic")
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+	)
+
+	var handled []int64
+	handler := IdempotencyMiddleware(NewMemoryIdempotencyStore())(func(ctx context.Context, msg Message) error {
+		handled = append(handled, msg.Offset)
+		if msg.Offset == 0 {
+			// The message is redelivered as it was not committed before the rebalance.
+			broker.Rebalance("some-group")
+		}
+		if msg.Offset == 2 {
+			require.NoError(t, c.Stop())
+		}
+		return nil
+	})
+	require.NoError(t, c.Run(context.Background(), handler))
+
+	assert.Equal(t, []int64{0, 1, 2}, handled)
+}
+
+func TestMemoryIdempotencyStore_ttl(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+
+	require.NoError(t, store.MarkProcessed(ctx, "some-key", 10*time.Millisecond))
+	seen, err := store.Seen(ctx, "some-key")
+	require.NoError(t, err)
+	assert.True(t, seen)
+
+	time.Sleep(20 * time.Millisecond)
+	seen, err = store.Seen(ctx, "some-key")
+	require.NoError(t, err)
+	assert.False(t, seen)
+}
+
+// countingStore counts calls to Seen, failing with err for the first failures
+// calls, or every call if failures is 0.
+type countingStore struct {
+	*MemoryIdempotencyStore
+	err       error
+	failures  int
+	seenCalls int
+}
+
+func (s *countingStore) Seen(ctx context.Context, key string) (bool, error) {
+	s.seenCalls++
+	if s.err != nil && (s.failures == 0 || s.seenCalls <= s.failures) {
+		return false, s.err
+	}
+	return s.MemoryIdempotencyStore.Seen(ctx, key)
+}
+
+type failingMarkStore struct {
+	*MemoryIdempotencyStore
+	err error
+}
+
+func (s *failingMarkStore) MarkProcessed(context.Context, string, time.Duration) error {
+	return s.err
+}
@@ -0,0 +1,100 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const consumerStatsInterval = 10 * time.Second
+
+// MetricTags identifies the consumer a metric was measured for.
+type MetricTags struct {
+	Topic      string
+	GroupID    string
+	ConsumerID string
+}
+
+// Metrics receives measurements from a consumer. Implementations must be safe for
+// concurrent use, as the same Metrics is shared by every consumer in a group.
+type Metrics interface {
+	// HandlerAttempt is called after every call to the handler, with how long the
+	// handler took and the error it returned (if any). Batch handlers are measured
+	// once per batch.
+	HandlerAttempt(tags MetricTags, attempt int, duration time.Duration, err error)
+	// MessageConsumed is called once the consumer is done with a message, either
+	// because the handler succeeded or it was given up on, with the number of
+	// attempts made and the final error (if any).
+	MessageConsumed(tags MetricTags, attempts int, err error)
+	// CommitFailed is called when committing message offsets fails.
+	CommitFailed(tags MetricTags, err error)
+	// ReaderStats is called periodically while the consumer is running, once for
+	// each partition the consumer reads, with the reader stats of the partition.
+	// The stats include the consumer lag, and their Partition is set to the
+	// partition they are for.
+	ReaderStats(tags MetricTags, stats kafka.ReaderStats)
+}
+
+// statsReader is implemented by readers that report stats, such as *kafka.Reader.
+type statsReader interface {
+	Stats() kafka.ReaderStats
+}
+
+// partitionStatsReader is implemented by readers reading several partitions with
+// a reader each, such as groupReader, to report the stats of each partition.
+type partitionStatsReader interface {
+	PartitionStats() []kafka.ReaderStats
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) HandlerAttempt(MetricTags, int, time.Duration, error) {}
+func (noopMetrics) MessageConsumed(MetricTags, int, error)               {}
+func (noopMetrics) CommitFailed(MetricTags, error)                       {}
+func (noopMetrics) ReaderStats(MetricTags, kafka.ReaderStats)            {}
+
+// reportStats periodically reports the reader stats until the context is done.
+func (c *Consumer) reportStats(ctx context.Context) {
+	if _, ok := c.clientHandler.metrics.(noopMetrics); ok {
+		return
+	}
+	var partitionStats func() []kafka.ReaderStats
+	switch reader := c.reader.(type) {
+	case partitionStatsReader:
+		partitionStats = reader.PartitionStats
+	case statsReader:
+		partitionStats = func() []kafka.ReaderStats { return []kafka.ReaderStats{reader.Stats()} }
+	default:
+		return
+	}
+
+	ticker := time.NewTicker(c.statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, stats := range partitionStats() {
+				topic := stats.Topic
+				if topic == "" {
+					topic = c.conf.Topic
+				}
+				c.clientHandler.metrics.ReaderStats(c.clientHandler.metricTags(topic), stats)
+			}
+		}
+	}
+}
+
+// commitFailed reports the failed commit to the metrics and returns the error.
+func (c *Consumer) commitFailed(msgs []kafka.Message, err error) error {
+	topic := c.conf.Topic
+	if len(msgs) > 0 {
+		topic = msgs[0].Topic
+	}
+	c.clientHandler.metrics.CommitFailed(c.clientHandler.metricTags(topic), err)
+
+	return err
+}
@@ -0,0 +1,102 @@
+package consumer
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/env"
+)
+
+const (
+	metricHandlerDuration  = "kafka.consumer.handler.duration"
+	metricHandlerErrors    = "kafka.consumer.handler.errors"
+	metricMessagesConsumed = "kafka.consumer.messages.consumed"
+	metricMessageAttempts  = "kafka.consumer.message.attempts"
+	metricCommitFailures   = "kafka.consumer.commit.failures"
+	metricLag              = "kafka.consumer.lag"
+)
+
+// StatsDMetrics is a Metrics implementation that sends consumer metrics to a
+// DogStatsD agent. Every metric is tagged with the topic, consumer group and
+// consumer ID. Handler metrics are also tagged with whether the attempt was a
+// retry, and the lag with the partition.
+type StatsDMetrics struct {
+	client statsd.ClientInterface
+}
+
+// NewStatsDMetrics returns a new StatsDMetrics sending metrics to the DogStatsD
+// agent at the "DD_AGENT_HOST" and "DD_DOGSTATSD_PORT" environment variables.
+func NewStatsDMetrics(opts ...statsd.Option) (*StatsDMetrics, error) {
+	addr := net.JoinHostPort(env.DatadogAgentHost(), strconv.Itoa(env.DatadogStatsDPort()))
+	client, err := statsd.New(addr, opts...)
+	if err != nil {
+		return nil, errors.Errorf("unable to create statsd client: %w", err)
+	}
+
+	return NewStatsDMetricsWithClient(client), nil
+}
+
+// NewStatsDMetricsWithClient returns a new StatsDMetrics sending metrics with the
+// provided statsd client.
+func NewStatsDMetricsWithClient(client statsd.ClientInterface) *StatsDMetrics {
+	return &StatsDMetrics{client: client}
+}
+
+// Close flushes any buffered metrics and closes the statsd client.
+func (m *StatsDMetrics) Close() error {
+	return m.client.Close()
+}
+
+func (m *StatsDMetrics) HandlerAttempt(tags MetricTags, attempt int, duration time.Duration, err error) {
+	attemptTags := append(statsDTags(tags), retryTag(attempt))
+	_ = m.client.Timing(metricHandlerDuration, duration, append(attemptTags, statusTag(err)), 1)
+	if err != nil {
+		_ = m.client.Incr(metricHandlerErrors, attemptTags, 1)
+	}
+}
+
+func (m *StatsDMetrics) MessageConsumed(tags MetricTags, attempts int, err error) {
+	_ = m.client.Incr(metricMessagesConsumed, append(statsDTags(tags), statusTag(err)), 1)
+	_ = m.client.Histogram(metricMessageAttempts, float64(attempts), statsDTags(tags), 1)
+}
+
+func (m *StatsDMetrics) CommitFailed(tags MetricTags, _ error) {
+	_ = m.client.Incr(metricCommitFailures, statsDTags(tags), 1)
+}
+
+func (m *StatsDMetrics) ReaderStats(tags MetricTags, stats kafka.ReaderStats) {
+	lagTags := statsDTags(tags)
+	if stats.Partition != "" {
+		lagTags = append(lagTags, "partition:"+stats.Partition)
+	}
+	_ = m.client.Gauge(metricLag, float64(stats.Lag), lagTags, 1)
+}
+
+func statsDTags(tags MetricTags) []string {
+	return []string{
+		"topic:" + tags.Topic,
+		"consumer_group:" + tags.GroupID,
+		"consumer_id:" + tags.ConsumerID,
+	}
+}
+
+// retryTag tags whether the attempt was a retry, rather than the attempt itself,
+// as retries can be unbounded, see NonStopExponentialBackOff.
+func retryTag(attempt int) string {
+	if attempt > 1 {
+		return "retry:true"
+	}
+	return "retry:false"
+}
+
+func statusTag(err error) string {
+	if err != nil {
+		return "status:error"
+	}
+	return "status:success"
+}
@@ -0,0 +1,73 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStatsDMetrics(t *testing.T) {
+	m, err := NewStatsDMetrics()
+	require.NoError(t, err)
+	require.NoError(t, m.Close())
+}
+
+func TestStatsDMetrics(t *testing.T) {
+	client := &fakeStatsD{}
+	m := NewStatsDMetricsWithClient(client)
+	tags := MetricTags{Topic: "some-topic", GroupID: "some-group", ConsumerID: "some-consumer"}
+	wantTags := []string{"topic:some-topic", "consumer_group:some-group", "consumer_id:some-consumer"}
+	someErr := errors.New("some error")
+
+	m.HandlerAttempt(tags, 1, 5*time.Millisecond, someErr)
+	m.HandlerAttempt(tags, 2, 5*time.Millisecond, nil)
+	m.MessageConsumed(tags, 2, nil)
+	m.CommitFailed(tags, someErr)
+	m.ReaderStats(tags, kafka.ReaderStats{Partition: "3", Lag: 7})
+
+	assert.Equal(t, []statsDMetric{
+		{name: "kafka.consumer.handler.duration", value: 5, tags: append(wantTags, "retry:false", "status:error")},
+		{name: "kafka.consumer.handler.errors", value: 1, tags: append(wantTags, "retry:false")},
+		{name: "kafka.consumer.handler.duration", value: 5, tags: append(wantTags, "retry:true", "status:success")},
+		{name: "kafka.consumer.messages.consumed", value: 1, tags: append(wantTags, "status:success")},
+		{name: "kafka.consumer.message.attempts", value: 2, tags: wantTags},
+		{name: "kafka.consumer.commit.failures", value: 1, tags: wantTags},
+		{name: "kafka.consumer.lag", value: 7, tags: append(wantTags, "partition:3")},
+	}, client.metrics)
+}
+
+type statsDMetric struct {
+	name  string
+	value float64
+	tags  []string
+}
+
+type fakeStatsD struct {
+	statsd.NoOpClient
+	metrics []statsDMetric
+}
+
+func (c *fakeStatsD) Timing(name string, value time.Duration, tags []string, _ float64) error {
+	c.metrics = append(c.metrics, statsDMetric{name: name, value: float64(value.Milliseconds()), tags: tags})
+	return nil
+}
+
+func (c *fakeStatsD) Incr(name string, tags []string, _ float64) error {
+	c.metrics = append(c.metrics, statsDMetric{name: name, value: 1, tags: tags})
+	return nil
+}
+
+func (c *fakeStatsD) Histogram(name string, value float64, tags []string, _ float64) error {
+	c.metrics = append(c.metrics, statsDMetric{name: name, value: value, tags: tags})
+	return nil
+}
+
+func (c *fakeStatsD) Gauge(name string, value float64, tags []string, _ float64) error {
+	c.metrics = append(c.metrics, statsDMetric{name: name, value: value, tags: tags})
+	return nil
+}
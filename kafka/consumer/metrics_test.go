@@ -0,0 +1,230 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_Run_metrics(t *testing.T) {
+	wantErr := errors.New("some handler error")
+	reader := newQueueReader(offsetMsgs(2)...)
+	metrics := &recordingMetrics{}
+
+	c := NewConsumer(Config{ID: "some-consumer", groupID: "some-group"},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+		WithHandlerBackOffRetry(func() backoff.BackOff {
+			return &testBackoff{maxAttempts: 5}
+		}),
+		WithMetrics(metrics),
+	)
+
+	attempts := 0
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		if msg.Offset == 0 {
+			attempts++
+			if attempts < 3 {
+				return wantErr
+			}
+			return nil
+		}
+		require.NoError(t, c.Stop())
+		return nil
+	})
+	require.NoError(t, err)
+
+	wantTags := MetricTags{Topic: "some-topic", GroupID: "some-group", ConsumerID: "some-consumer"}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	require.Len(t, metrics.attempts, 4)
+	assert.Equal(t, wantTags, metrics.attempts[0].tags)
+	assert.ErrorIs(t, metrics.attempts[0].err, wantErr)
+	assert.ErrorIs(t, metrics.attempts[1].err, wantErr)
+	assert.NoError(t, metrics.attempts[2].err)
+	assert.Equal(t, 3, metrics.attempts[2].attempt)
+
+	require.Len(t, metrics.consumed, 2)
+	assert.Equal(t, recordedConsumed{tags: wantTags, attempts: 3}, metrics.consumed[0])
+	assert.Equal(t, recordedConsumed{tags: wantTags, attempts: 1}, metrics.consumed[1])
+	assert.Empty(t, metrics.commitFailures)
+}
+
+func TestConsumer_Run_metricsCommitFailed(t *testing.T) {
+	wantErr := errors.New("some commit error")
+	reader := &commitErrReader{queueReader: newQueueReader(offsetMsgs(1)...), err: wantErr}
+	metrics := &recordingMetrics{}
+
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+		WithMetrics(metrics),
+	)
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		return nil
+	})
+	require.ErrorIs(t, err, wantErr)
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	require.Len(t, metrics.commitFailures, 1)
+	assert.Equal(t, "some-topic", metrics.commitFailures[0].Topic)
+}
+
+func TestConsumer_Run_metricsReaderStats(t *testing.T) {
+	reader := &statsQueueReader{queueReader: newQueueReader(), stats: kafka.ReaderStats{Lag: 42}}
+	metrics := &recordingMetrics{}
+
+	c := NewConsumer(Config{Topic: "some-topic"},
+		WithKafkaReader(func() Reader { return reader }),
+		WithMetrics(metrics),
+	)
+	c.statsInterval = time.Millisecond
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+			return nil
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return len(metrics.lags) > 0
+	}, time.Second, time.Millisecond)
+
+	_, err := c.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	assert.Equal(t, int64(42), metrics.lags[0])
+}
+
+func TestConsumer_Run_metricsPartitionStats(t *testing.T) {
+	reader := &partitionStatsQueueReader{queueReader: newQueueReader(), stats: []kafka.ReaderStats{
+		{Topic: "some-topic", Partition: "0", Lag: 3},
+		{Topic: "other-topic", Partition: "1", Lag: 4},
+	}}
+	metrics := &recordingMetrics{}
+
+	c := NewConsumer(Config{Topic: "some-topic"},
+		WithKafkaReader(func() Reader { return reader }),
+		WithMetrics(metrics),
+	)
+	c.statsInterval = time.Millisecond
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+			return nil
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return len(metrics.stats) >= 2
+	}, time.Second, time.Millisecond)
+
+	_, err := c.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	assert.Equal(t, []int64{3, 4}, metrics.lags[:2], "the lag should be reported for each partition")
+	assert.Equal(t, "some-topic", metrics.stats[0].tags.Topic)
+	assert.Equal(t, "0", metrics.stats[0].stats.Partition)
+	assert.Equal(t, "other-topic", metrics.stats[1].tags.Topic)
+	assert.Equal(t, "1", metrics.stats[1].stats.Partition)
+}
+
+type recordedAttempt struct {
+	tags    MetricTags
+	attempt int
+	err     error
+}
+
+type recordedConsumed struct {
+	tags     MetricTags
+	attempts int
+	err      error
+}
+
+type recordedStats struct {
+	tags  MetricTags
+	stats kafka.ReaderStats
+}
+
+type recordingMetrics struct {
+	mu             sync.Mutex
+	attempts       []recordedAttempt
+	consumed       []recordedConsumed
+	commitFailures []MetricTags
+	lags           []int64
+	stats          []recordedStats
+}
+
+func (m *recordingMetrics) HandlerAttempt(tags MetricTags, attempt int, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = append(m.attempts, recordedAttempt{tags: tags, attempt: attempt, err: err})
+}
+
+func (m *recordingMetrics) MessageConsumed(tags MetricTags, attempts int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consumed = append(m.consumed, recordedConsumed{tags: tags, attempts: attempts, err: err})
+}
+
+func (m *recordingMetrics) CommitFailed(tags MetricTags, _ error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commitFailures = append(m.commitFailures, tags)
+}
+
+func (m *recordingMetrics) ReaderStats(tags MetricTags, stats kafka.ReaderStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lags = append(m.lags, stats.Lag)
+	m.stats = append(m.stats, recordedStats{tags: tags, stats: stats})
+}
+
+type statsQueueReader struct {
+	*queueReader
+	stats kafka.ReaderStats
+}
+
+func (r *statsQueueReader) Stats() kafka.ReaderStats {
+	return r.stats
+}
+
+type partitionStatsQueueReader struct {
+	*queueReader
+	stats []kafka.ReaderStats
+}
+
+func (r *partitionStatsQueueReader) PartitionStats() []kafka.ReaderStats {
+	return r.stats
+}
+
+type commitErrReader struct {
+	*queueReader
+	err error
+}
+
+func (r *commitErrReader) CommitMessages(context.Context, ...kafka.Message) error {
+	return r.err
+}
@@ -0,0 +1,135 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/kafka/producer"
+	"github.com/cultureamp/ca-go/log"
+	"github.com/cultureamp/ca-go/request"
+	"github.com/cultureamp/ca-go/sentry"
+)
+
+// Kafka message headers used to populate the handler context with the request
+// IDs and authenticated user. They are set by producers created with
+// producer.WithRequestHeaders.
+const (
+	RequestIDHeader     = producer.RequestIDHeader
+	CorrelationIDHeader = producer.CorrelationIDHeader
+	AccountIDHeader     = producer.AccountIDHeader
+	UserIDHeader        = producer.UserIDHeader
+	RealUserIDHeader    = producer.RealUserIDHeader
+)
+
+// Middleware wraps a Handler to add behaviour before and after it handles a
+// message. See WithMiddleware.
+type Middleware = func(Handler) Handler
+
+// chain wraps the handler in the middleware, with the first middleware being
+// the outermost.
+func chain(handler Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// RecoverMiddleware recovers from a panic in the handler, reports it to Sentry
+// using sentry.ReportError, and returns it as an error so that it is retried or
+// published to the dead letter topic like any other handler error.
+func RecoverMiddleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					panicErr, ok := r.(error)
+					if !ok {
+						panicErr = errors.New(fmt.Sprint(r))
+					}
+
+					err = errors.Errorf("consumer handler panic: %w", panicErr)
+					sentry.ReportError(ctx, err)
+				}
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// LoggingMiddleware logs every handler attempt with the message topic, partition,
+// offset and attempt. Successful attempts are logged at debug level, and failed
+// attempts at error level.
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			props := log.Add().
+				Str("topic", msg.Topic).
+				Int("partition", msg.Partition).
+				Int64("offset", msg.Offset).
+				Int("attempt", msg.Attempt).
+				Str("group_id", msg.GroupID).
+				Str("consumer_id", msg.ConsumerID).
+				Duration("duration", time.Since(start))
+			if ids, ok := request.UniqueIDsFromContext(ctx); ok {
+				props = props.
+					Str("request_id", ids.RequestID).
+					Str("correlation_id", ids.CorrelationID)
+			}
+
+			var entry *log.Property
+			if err != nil {
+				entry = logger.Error("kafka_message_handler_failed", err)
+			} else {
+				entry = logger.Debug("kafka_message_handled")
+			}
+			if user, ok := request.AuthenticatedUserFromContext(ctx); ok {
+				entry = entry.WithAuthenticatedUserTracing(&log.AuthPayload{
+					CustomerAccountID: user.CustomerAccountID,
+					UserID:            user.UserID,
+					RealUserID:        user.RealUserID,
+				})
+			}
+			entry.Properties(props).Send()
+
+			return err
+		}
+	}
+}
+
+// contextWithRequestHeaders populates the ctx with the request IDs and
+// authenticated user from the message headers, so they are available to
+// request.UniqueIDsFromContext and request.AuthenticatedUserFromContext as they
+// would be for an HTTP request. It is called by dispatch for every message.
+func contextWithRequestHeaders(ctx context.Context, msgHeaders []kafka.Header) context.Context {
+	headers := make(map[string]string, len(msgHeaders))
+	for _, h := range msgHeaders {
+		headers[h.Key] = string(h.Value)
+	}
+
+	ids := request.UniqueIDs{
+		RequestID:     headers[RequestIDHeader],
+		CorrelationID: headers[CorrelationIDHeader],
+	}
+	if ids.RequestID != "" || ids.CorrelationID != "" {
+		ctx = request.ContextWithUniqueIDs(ctx, ids)
+	}
+
+	user := request.AuthenticatedUser{
+		CustomerAccountID: headers[AccountIDHeader],
+		UserID:            headers[UserIDHeader],
+		RealUserID:        headers[RealUserIDHeader],
+	}
+	if user.CustomerAccountID != "" || user.UserID != "" {
+		ctx = request.ContextWithAuthenticatedUser(ctx, user)
+	}
+
+	return ctx
+}
@@ -0,0 +1,238 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	getsentry "github.com/getsentry/sentry-go"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+	"github.com/cultureamp/ca-go/kafka/producer"
+	"github.com/cultureamp/ca-go/log"
+	"github.com/cultureamp/ca-go/request"
+	"github.com/cultureamp/ca-go/sentry"
+)
+
+func TestConsumer_Run_middleware(t *testing.T) {
+	reader := newQueueReader(offsetMsgs(1)...)
+
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, msg Message) error {
+				calls = append(calls, name+" before")
+				err := next(ctx, msg)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+
+	var c *Consumer
+	c = NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithMiddleware(middleware("first"), middleware("second")),
+		WithMiddleware(middleware("third")),
+	)
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		calls = append(calls, "handler")
+		return c.Stop()
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"first before",
+		"second before",
+		"third before",
+		"handler",
+		"third after",
+		"second after",
+		"first after",
+	}, calls)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	transport := &sentryTransport{}
+	require.NoError(t, sentry.Init(
+		sentry.WithEnvironment("test"),
+		sentry.WithDSN("https://public@sentry.example.com/1"),
+		sentry.WithRelease("some-app", "1.0.0"),
+		sentry.WithTransport(transport),
+	))
+
+	reader := newQueueReader(offsetMsgs(1)...)
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithMiddleware(RecoverMiddleware()),
+	)
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		panic("some panic")
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "consumer handler panic: some panic")
+
+	events := transport.Events()
+	require.Len(t, events, 1)
+	exceptions := events[0].Exception
+	require.NotEmpty(t, exceptions)
+	assert.Equal(t, "consumer handler panic: some panic", exceptions[len(exceptions)-1].Value)
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	wantErr := errors.New("some handler error")
+	logger := newRecordingLogger()
+
+	handler := LoggingMiddleware(logger)(func(ctx context.Context, msg Message) error {
+		if msg.Offset == 1 {
+			return wantErr
+		}
+		return nil
+	})
+
+	require.NoError(t, handler(context.Background(), Message{Message: kafka.Message{Offset: 0}}))
+	require.ErrorIs(t, handler(context.Background(), Message{Message: kafka.Message{Offset: 1}}), wantErr)
+
+	assert.Equal(t, []string{"kafka_message_handled", "kafka_message_handler_failed"}, logger.events)
+}
+
+func TestContextWithRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  []kafka.Header
+		wantIDs  *request.UniqueIDs
+		wantUser *request.AuthenticatedUser
+	}{
+		{
+			name: "all headers",
+			headers: []kafka.Header{
+				{Key: RequestIDHeader, Value: []byte("some-request-id")},
+				{Key: CorrelationIDHeader, Value: []byte("some-correlation-id")},
+				{Key: AccountIDHeader, Value: []byte("some-account-id")},
+				{Key: UserIDHeader, Value: []byte("some-user-id")},
+				{Key: RealUserIDHeader, Value: []byte("some-real-user-id")},
+			},
+			wantIDs: &request.UniqueIDs{
+				RequestID:     "some-request-id",
+				CorrelationID: "some-correlation-id",
+			},
+			wantUser: &request.AuthenticatedUser{
+				CustomerAccountID: "some-account-id",
+				UserID:            "some-user-id",
+				RealUserID:        "some-real-user-id",
+			},
+		},
+		{
+			name: "request IDs only",
+			headers: []kafka.Header{
+				{Key: CorrelationIDHeader, Value: []byte("some-correlation-id")},
+			},
+			wantIDs: &request.UniqueIDs{CorrelationID: "some-correlation-id"},
+		},
+		{
+			name: "no headers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := contextWithRequestHeaders(context.Background(), tt.headers)
+
+			ids, ok := request.UniqueIDsFromContext(ctx)
+			if assert.Equal(t, tt.wantIDs != nil, ok) && ok {
+				assert.Equal(t, *tt.wantIDs, ids)
+			}
+			user, ok := request.AuthenticatedUserFromContext(ctx)
+			if assert.Equal(t, tt.wantUser != nil, ok) && ok {
+				assert.Equal(t, *tt.wantUser, user)
+			}
+		})
+	}
+}
+
+func TestConsumer_Run_requestContext(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	p := producer.NewProducer(producer.Config{Topic: "some-topic"},
+		producer.WithKafkaWriter(func() producer.Writer { return broker.Writer("some-topic") }),
+		producer.WithRequestHeaders(),
+	)
+
+	wantIDs := request.UniqueIDs{RequestID: "some-request-id", CorrelationID: "some-correlation-id"}
+	wantUser := request.AuthenticatedUser{
+		CustomerAccountID: "some-account-id",
+		UserID:            "some-user-id",
+		RealUserID:        "some-real-user-id",
+	}
+	ctx := request.ContextWithUniqueIDs(context.Background(), wantIDs)
+	ctx = request.ContextWithAuthenticatedUser(ctx, wantUser)
+	require.NoError(t, p.Publish(ctx, kafka.Message{Value: []byte("some-value")}))
+	require.NoError(t, p.Close())
+
+	var c *Consumer
+	c = NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+	)
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		ids, ok := request.UniqueIDsFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, wantIDs, ids)
+		user, ok := request.AuthenticatedUserFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, wantUser, user)
+		return c.Stop()
+	})
+	require.NoError(t, err)
+}
+
+type sentryTransport struct {
+	mu     sync.Mutex
+	events []*getsentry.Event
+}
+
+func (t *sentryTransport) Configure(getsentry.ClientOptions) {}
+
+func (t *sentryTransport) SendEvent(event *getsentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *sentryTransport) Flush(time.Duration) bool {
+	return true
+}
+
+func (t *sentryTransport) Events() []*getsentry.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.events
+}
+
+// recordingLogger records the events logged, and discards the output.
+type recordingLogger struct {
+	log.Logger
+	events []string
+}
+
+func newRecordingLogger() *recordingLogger {
+	config, _ := log.NewLoggerConfig()
+	config.Quiet = true
+	config.LogLevel = "DEBUG"
+	return &recordingLogger{Logger: log.NewLogger(config)}
+}
+
+func (l *recordingLogger) Debug(event string) *log.Property {
+	l.events = append(l.events, event)
+	return l.Logger.Debug(event)
+}
+
+func (l *recordingLogger) Error(event string, err error) *log.Property {
+	l.events = append(l.events, event)
+	return l.Logger.Error(event, err)
+}
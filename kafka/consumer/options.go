@@ -1,7 +1,11 @@
 package consumer
 
 import (
+	"time"
+
 	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/kafka/producer"
 )
 
 type Option func(consumer *Consumer)
@@ -23,6 +27,61 @@ func WithExplicitCommit() Option {
 	}
 }
 
+// WithConcurrency handles messages concurrently using a bounded pool of workers.
+// Messages are assigned to workers by their partition or key depending on the
+// ordering, so messages from the same partition (or with the same key) are still
+// handled in order while others are handled concurrently. The internal queue
+// capacity is shared between the workers.
+//
+// When used with WithExplicitCommit, the offset of a message is only committed
+// once it and every message before it in the same partition has been handled.
+//
+// A workers value of 1 or less handles messages one at a time, which is the
+// default.
+func WithConcurrency(workers int, ordering Ordering) Option {
+	return func(consumer *Consumer) {
+		consumer.concurrency = workers
+		consumer.ordering = ordering
+	}
+}
+
+// WithBatching sets the max number of messages in a batch, and the max time to
+// wait for a batch to fill after receiving its first message, when handling
+// messages with RunBatch.
+//
+// Default: 100 messages, 1 second.
+func WithBatching(maxSize int, maxLinger time.Duration) Option {
+	return func(consumer *Consumer) {
+		if maxSize > 0 {
+			consumer.batchSize = maxSize
+		}
+		if maxLinger > 0 {
+			consumer.batchLinger = maxLinger
+		}
+	}
+}
+
+// WithMiddleware wraps the handler passed to Run in the middleware, with the
+// first middleware being the outermost. Middleware is called for every handler
+// attempt, inside any data dog span, so it can add behaviour such as logging or
+// populating the context. Calling it more than once appends the middleware.
+//
+// See RecoverMiddleware, LoggingMiddleware and IdempotencyMiddleware.
+func WithMiddleware(middleware ...func(Handler) Handler) Option {
+	return func(consumer *Consumer) {
+		consumer.middleware = append(consumer.middleware, middleware...)
+	}
+}
+
+// WithMetrics reports consumer metrics, such as handler durations, attempts,
+// commit failures and consumer lag, to the provided Metrics. Use NewStatsDMetrics
+// to send them to DogStatsD.
+func WithMetrics(metrics Metrics) Option {
+	return func(consumer *Consumer) {
+		consumer.clientHandler.metrics = metrics
+	}
+}
+
 // WithGroupBalancers adds a priority-ordered list of client-side consumer group
 // balancing strategies that will be offered to the coordinator. The first strategy
 // that all group members support will be chosen by the leader.
@@ -43,6 +102,50 @@ func WithHandlerBackOffRetry(backOffConstructor HandlerRetryBackOffConstructor)
 	}
 }
 
+// WithDeadLetterTopic publishes messages to the dead letter topic once the handler
+// retry back off (see WithHandlerBackOffRetry) gives up, instead of returning the
+// handler error and stopping the consumer. The message offset is then committed
+// so that a single poison message does not block the partition.
+//
+// The original message key, value and headers are published along with headers
+// describing the failure: the handler error, number of attempts, group ID,
+// consumer ID and the original topic, partition and offset.
+//
+// The dead letter producer uses the same brokers and dialer as the consumer.
+// Producer options can be passed to override these, or to inject a mock writer
+// for testing with producer.WithKafkaWriter.
+func WithDeadLetterTopic(topic string, opts ...producer.Option) Option {
+	return func(consumer *Consumer) {
+		consumer.clientHandler.deadLetter = &deadLetterQueue{
+			topic: topic,
+			opts:  opts,
+		}
+	}
+}
+
+// WithRetryTopics publishes messages to the retry topics once the handler retry
+// back off (see WithHandlerBackOffRetry) gives up, instead of retrying in the
+// consumer and blocking the partition. A message failing on the main topic is
+// published to the first retry topic, and a message failing on a retry topic is
+// published to the next one. Messages that have been through every retry topic
+// are published to the dead letter topic if one is set, otherwise the handler
+// error is returned.
+//
+// Retry messages carry a RetryNotBeforeHeader set to the time the retry topic
+// delay passes. Use NewRetryGroup to consume them.
+//
+// The retry producers use the same brokers and dialer as the consumer. Producer
+// options can be passed to override these, or to inject a mock writer for
+// testing with producer.WithKafkaWriter.
+func WithRetryTopics(topics []RetryTopic, opts ...producer.Option) Option {
+	return func(consumer *Consumer) {
+		consumer.clientHandler.retryTopics = &retryTopics{
+			topics: topics,
+			opts:   opts,
+		}
+	}
+}
+
 // WithNotifyError adds the NotifyError function to the consumer for it to be invoked
 // on each consumer handler error.
 func WithNotifyError(notifier NotifyError) Option {
@@ -89,3 +192,31 @@ func WithQueueCapacity(queueCapacity int) Option {
 		consumer.conf.QueueCapacity = queueCapacity
 	}
 }
+
+// WithOnPartitionsAssigned calls fn each time the consumer group assigns
+// partitions to the consumer, before any message from them is handled. It is
+// called from the goroutine fetching messages, so fetching waits for it to
+// return.
+//
+// Only used by consumer group.
+func WithOnPartitionsAssigned(fn RebalanceFunc) Option {
+	return func(consumer *Consumer) {
+		consumer.onAssigned = fn
+	}
+}
+
+// WithOnPartitionsRevoked calls fn each time partitions are revoked from the
+// consumer when the consumer group is re-balanced, or the consumer leaves it.
+// Messages from the partitions that have not yet been handled can still be
+// committed until fn returns and the consumer finishes handling them, which it
+// waits for up to the group rebalance timeout, so fn can be used to flush
+// per-partition state or in-flight work before the partitions are assigned to
+// another consumer.
+//
+// fn may be called from a different goroutine to the handler. Only used by
+// consumer group.
+func WithOnPartitionsRevoked(fn RebalanceFunc) Option {
+	return func(consumer *Consumer) {
+		consumer.onRevoked = fn
+	}
+}
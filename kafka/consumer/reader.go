@@ -0,0 +1,321 @@
+package consumer
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetSetter is implemented by kafka-go readers, and is only available when
+// the reader is not part of a consumer group.
+type offsetSetter interface {
+	SetOffset(offset int64) error
+	SetOffsetAt(ctx context.Context, t time.Time) error
+}
+
+// kafkaReader wraps the kafka-go reader created by a consumer so that it can be
+// moved with Seeker. Seeking a consumer group commits the new offsets and then
+// re-creates the reader, so that it re-joins the group and every member resumes
+// from the committed offsets.
+//
+// If a topic pattern is set, the kafka-go reader is only created once the topics
+// matching it have been looked up when the reader is first used.
+type kafkaReader struct {
+	conf      kafka.ReaderConfig
+	pattern   *regexp.Regexp
+	newReader func(conf kafka.ReaderConfig) Reader
+
+	mu     sync.RWMutex
+	reader Reader // nil until the pattern topics are looked up
+	closed bool
+}
+
+func newKafkaReader(conf kafka.ReaderConfig, pattern *regexp.Regexp, newReader func(conf kafka.ReaderConfig) Reader) *kafkaReader {
+	r := &kafkaReader{
+		conf:      conf,
+		pattern:   pattern,
+		newReader: newReader,
+	}
+	if pattern == nil {
+		r.reader = newReader(conf)
+	}
+	return r
+}
+
+func (r *kafkaReader) current() Reader {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.reader
+}
+
+// get returns the current reader, creating it if needed.
+func (r *kafkaReader) get(ctx context.Context) (Reader, error) {
+	if reader := r.current(); reader != nil {
+		return reader, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reader != nil {
+		return r.reader, nil
+	}
+	if r.closed {
+		return nil, io.EOF
+	}
+
+	topics, err := topicsMatching(ctx, r.conf, r.pattern)
+	if err != nil {
+		return nil, err
+	}
+	r.conf.GroupTopics = append(r.conf.GroupTopics, topics...)
+	r.reader = r.newReader(r.conf)
+
+	return r.reader, nil
+}
+
+func (r *kafkaReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	reader, err := r.get(ctx)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return reader.ReadMessage(ctx)
+}
+
+func (r *kafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	reader, err := r.get(ctx)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return reader.FetchMessage(ctx)
+}
+
+func (r *kafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	reader, err := r.get(ctx)
+	if err != nil {
+		return err
+	}
+	return reader.CommitMessages(ctx, msgs...)
+}
+
+func (r *kafkaReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Close()
+}
+
+// PartitionStats returns the stats of the current reader, see
+// partitionStatsReader.
+func (r *kafkaReader) PartitionStats() []kafka.ReaderStats {
+	switch reader := r.current().(type) {
+	case partitionStatsReader:
+		return reader.PartitionStats()
+	case statsReader:
+		return []kafka.ReaderStats{reader.Stats()}
+	}
+	return nil
+}
+
+// topics returns the topics the reader consumes.
+func (r *kafkaReader) topics() []string {
+	if len(r.conf.GroupTopics) > 0 {
+		return r.conf.GroupTopics
+	}
+	return []string{r.conf.Topic}
+}
+
+func (r *kafkaReader) SeekToOffset(ctx context.Context, partition int, offset int64) error {
+	if r.conf.GroupID == "" {
+		if partition != r.conf.Partition {
+			return errors.Errorf("unable to seek partition %d: the reader only reads partition %d", partition, r.conf.Partition)
+		}
+		return r.setOffset(func(s offsetSetter) error {
+			return s.SetOffset(offset)
+		})
+	}
+
+	if _, err := r.get(ctx); err != nil {
+		return err
+	}
+
+	// The partition is moved in every topic consumed. Committing a message
+	// commits the offset after it.
+	var msgs []kafka.Message
+	for _, topic := range r.topics() {
+		msgs = append(msgs, kafka.Message{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    offset - 1,
+		})
+	}
+
+	return r.commitAndRejoin(ctx, msgs)
+}
+
+func (r *kafkaReader) SeekToTimestamp(ctx context.Context, t time.Time) error {
+	if r.conf.GroupID == "" {
+		return r.setOffset(func(s offsetSetter) error {
+			return s.SetOffsetAt(ctx, t)
+		})
+	}
+
+	if _, err := r.get(ctx); err != nil {
+		return err
+	}
+
+	var msgs []kafka.Message
+	for _, topic := range r.topics() {
+		topicMsgs, err := r.offsetsAt(ctx, topic, t)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, topicMsgs...)
+	}
+
+	return r.commitAndRejoin(ctx, msgs)
+}
+
+func (r *kafkaReader) setOffset(set func(s offsetSetter) error) error {
+	s, ok := r.current().(offsetSetter)
+	if !ok {
+		return ErrSeekNotSupported
+	}
+
+	if err := set(s); err != nil {
+		return errors.Errorf("unable to set reader offset: %w", err)
+	}
+
+	return nil
+}
+
+// offsetsAt returns a message per partition of the topic which, when committed,
+// moves the group to the first message at or after t.
+func (r *kafkaReader) offsetsAt(ctx context.Context, topic string, t time.Time) ([]kafka.Message, error) {
+	dialer, broker, err := readerBroker(r.conf)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions, err := dialer.LookupPartitions(ctx, "tcp", broker, topic)
+	if err != nil {
+		return nil, errors.Errorf("unable to look up partitions for topic %s: %w", topic, err)
+	}
+
+	msgs := make([]kafka.Message, 0, len(partitions))
+	for _, p := range partitions {
+		offset, err := offsetAt(ctx, dialer, broker, p, t)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, kafka.Message{
+			Topic:     topic,
+			Partition: p.ID,
+			Offset:    offset - 1, // committing a message commits the offset after it
+		})
+	}
+
+	return msgs, nil
+}
+
+// topicsMatching returns the topics on the brokers matching the pattern.
+func topicsMatching(ctx context.Context, conf kafka.ReaderConfig, pattern *regexp.Regexp) ([]string, error) {
+	dialer, broker, err := readerBroker(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return nil, errors.Errorf("unable to connect to broker %s: %w", broker, err)
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions()
+	if err != nil {
+		return nil, errors.Errorf("unable to list topics: %w", err)
+	}
+
+	var topics []string
+	seen := make(map[string]bool)
+	for _, p := range partitions {
+		if !seen[p.Topic] && pattern.MatchString(p.Topic) {
+			seen[p.Topic] = true
+			topics = append(topics, p.Topic)
+		}
+	}
+	sort.Strings(topics)
+
+	if len(topics) == 0 && len(conf.GroupTopics) == 0 {
+		return nil, errors.Errorf("unable to find topics: no topics match pattern %s", pattern)
+	}
+	return topics, nil
+}
+
+// readerBroker returns the dialer and first broker of the reader config.
+func readerBroker(conf kafka.ReaderConfig) (*kafka.Dialer, string, error) {
+	if len(conf.Brokers) == 0 {
+		return nil, "", errors.Errorf("unable to connect to kafka: no brokers in config")
+	}
+
+	dialer := conf.Dialer
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+	return dialer, conf.Brokers[0], nil
+}
+
+// offsetAt returns the offset of the first message in the partition at or after
+// t, or the end of the partition if there is none.
+func offsetAt(ctx context.Context, dialer *kafka.Dialer, broker string, p kafka.Partition, t time.Time) (int64, error) {
+	conn, err := dialer.DialLeader(ctx, "tcp", broker, p.Topic, p.ID)
+	if err != nil {
+		return 0, errors.Errorf("unable to connect to partition %d leader: %w", p.ID, err)
+	}
+	defer conn.Close()
+
+	offset, err := conn.ReadOffset(t)
+	if err != nil {
+		return 0, errors.Errorf("unable to read offset of partition %d: %w", p.ID, err)
+	}
+	if offset >= 0 {
+		return offset, nil
+	}
+
+	offset, err = conn.ReadLastOffset()
+	if err != nil {
+		return 0, errors.Errorf("unable to read last offset of partition %d: %w", p.ID, err)
+	}
+	return offset, nil
+}
+
+// commitAndRejoin commits the messages for the group, then re-creates the reader
+// so that it re-joins the group, which re-balances it.
+func (r *kafkaReader) commitAndRejoin(ctx context.Context, msgs []kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return io.ErrClosedPipe
+	}
+
+	if err := r.reader.CommitMessages(ctx, msgs...); err != nil {
+		return errors.Errorf("unable to commit offsets: %w", err)
+	}
+	if err := r.reader.Close(); err != nil {
+		return errors.Errorf("unable to close reader: %w", err)
+	}
+	r.reader = r.newReader(r.conf)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaReader_SeekToOffset(t *testing.T) {
+	conf := kafka.ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "some-topic"}
+	r := newKafkaReader(conf, nil, func(conf kafka.ReaderConfig) Reader { return kafka.NewReader(conf) })
+	defer r.Close()
+
+	require.NoError(t, r.SeekToOffset(context.Background(), 0, 5))
+	assert.Equal(t, int64(5), r.current().(*kafka.Reader).Offset())
+	assert.Error(t, r.SeekToOffset(context.Background(), 1, 5), "only the configured partition can be seeked")
+}
+
+func TestKafkaReader_SeekToOffset_group(t *testing.T) {
+	conf := kafka.ReaderConfig{Topic: "some-topic", GroupID: "some-group"}
+
+	var readers []*queueReader
+	r := newKafkaReader(conf, nil, func(conf kafka.ReaderConfig) Reader {
+		reader := newQueueReader()
+		readers = append(readers, reader)
+		return reader
+	})
+
+	require.NoError(t, r.SeekToOffset(context.Background(), 0, 5))
+
+	require.Len(t, readers, 2, "the reader should be re-created to re-join the group")
+	assert.Equal(t, []int64{4}, readers[0].committedOffsets(), "committing offset 4 moves the group to offset 5")
+	assert.True(t, isClosed(readers[0]))
+	assert.Same(t, readers[1], r.current())
+
+	require.NoError(t, r.Close())
+	assert.Error(t, r.SeekToOffset(context.Background(), 0, 5))
+}
+
+func TestKafkaReader_PartitionStats(t *testing.T) {
+	conf := kafka.ReaderConfig{Topic: "some-topic"}
+
+	single := newKafkaReader(conf, nil, func(kafka.ReaderConfig) Reader {
+		return &statsQueueReader{queueReader: newQueueReader(), stats: kafka.ReaderStats{Partition: "0", Lag: 1}}
+	})
+	assert.Equal(t, []kafka.ReaderStats{{Partition: "0", Lag: 1}}, single.PartitionStats())
+
+	stats := []kafka.ReaderStats{{Partition: "0", Lag: 1}, {Partition: "1", Lag: 2}}
+	group := newKafkaReader(conf, nil, func(kafka.ReaderConfig) Reader {
+		return &partitionStatsQueueReader{queueReader: newQueueReader(), stats: stats}
+	})
+	assert.Equal(t, stats, group.PartitionStats())
+
+	none := newKafkaReader(conf, nil, func(kafka.ReaderConfig) Reader { return newQueueReader() })
+	assert.Empty(t, none.PartitionStats())
+}
@@ -0,0 +1,60 @@
+package consumer
+
+import (
+	"context"
+)
+
+// Rebalance describes the partitions assigned to or revoked from a consumer when
+// its consumer group is re-balanced.
+type Rebalance struct {
+	ConsumerID string
+	// Generation is the consumer group generation the partitions are assigned
+	// in, which is incremented every time the group is re-balanced. Messages
+	// fetched in the generation have the same Metadata.Generation.
+	Generation int
+	// Partitions are the partition IDs per topic.
+	Partitions map[string][]int
+}
+
+// RebalanceFunc is called when partitions are assigned to or revoked from a
+// consumer, see WithOnPartitionsAssigned and WithOnPartitionsRevoked.
+type RebalanceFunc func(ctx context.Context, rebalance Rebalance)
+
+// rebalanceReader is implemented by readers reporting consumer group
+// re-balances. The assigned function must be called from FetchMessage, before
+// the first message of the generation is returned, so that the consumer knows
+// the generation of every message it fetches.
+type rebalanceReader interface {
+	OnRebalance(assigned, revoked func(ctx context.Context, generation int, partitions map[string][]int))
+}
+
+// Generation returns the consumer group generation the consumer was last
+// assigned partitions in, or 0 if it has none assigned. A handler can compare it
+// with Metadata.Generation to detect a message fetched before a re-balance,
+// whose partition may have since been assigned to another consumer.
+func (c *Consumer) Generation() int {
+	return int(c.generation.Load())
+}
+
+func (c *Consumer) partitionsAssigned(ctx context.Context, generation int, partitions map[string][]int) {
+	c.generation.Store(int64(generation))
+	c.fetchGeneration.Store(int64(generation))
+	if c.onAssigned != nil {
+		c.onAssigned(ctx, c.rebalance(generation, partitions))
+	}
+}
+
+func (c *Consumer) partitionsRevoked(ctx context.Context, generation int, partitions map[string][]int) {
+	c.generation.CompareAndSwap(int64(generation), 0)
+	if c.onRevoked != nil {
+		c.onRevoked(ctx, c.rebalance(generation, partitions))
+	}
+}
+
+func (c *Consumer) rebalance(generation int, partitions map[string][]int) Rebalance {
+	return Rebalance{
+		ConsumerID: c.id,
+		Generation: generation,
+		Partitions: partitions,
+	}
+}
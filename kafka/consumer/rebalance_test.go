@@ -0,0 +1,257 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kafkatrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/segmentio/kafka.go.v0"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+)
+
+// rebalanceRecorder records the rebalance callbacks.
+type rebalanceRecorder struct {
+	mu     sync.Mutex
+	events []string
+	last   map[string]Rebalance
+}
+
+func (r *rebalanceRecorder) record(event string) RebalanceFunc {
+	return func(ctx context.Context, rebalance Rebalance) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.events = append(r.events, event)
+		if r.last == nil {
+			r.last = make(map[string]Rebalance)
+		}
+		r.last[event+":"+rebalance.ConsumerID] = rebalance
+	}
+}
+
+func (r *rebalanceRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func TestConsumer_Run_rebalanceCallbacks(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	broker.CreateTopic("some-topic", 2)
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), offsetMsgs(4)...))
+
+	reader := broker.Reader("some-group", "some-topic")
+	recorder := &rebalanceRecorder{}
+	c := NewConsumer(Config{ID: "some-consumer"},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+		WithOnPartitionsAssigned(recorder.record("assigned")),
+		WithOnPartitionsRevoked(recorder.record("revoked")),
+	)
+	assert.Equal(t, 0, c.Generation())
+
+	var generations []int
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		generations = append(generations, msg.Generation)
+		assert.Equal(t, msg.Generation, c.Generation())
+		if len(generations) == 1 {
+			broker.Rebalance("some-group")
+		}
+		if len(generations) == 5 {
+			require.NoError(t, c.Stop())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// The first message is redelivered in the new generation as it was committed
+	// after the rebalance.
+	assert.Equal(t, []int{1, 2, 2, 2, 2}, generations)
+	assert.Equal(t, []string{"assigned", "revoked", "assigned", "revoked"}, recorder.recorded())
+	assert.Equal(t, Rebalance{
+		ConsumerID: "some-consumer",
+		Generation: 2,
+		Partitions: map[string][]int{"some-topic": {0, 1}},
+	}, recorder.last["revoked:some-consumer"])
+	assert.Equal(t, 0, c.Generation(), "the generation is reset once the partitions are revoked")
+}
+
+func TestConsumer_Run_generationWithoutCallbacks(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), offsetMsgs(1)...))
+
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+	)
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		assert.Equal(t, 1, msg.Generation)
+		assert.Equal(t, 1, c.Generation())
+		return c.Stop()
+	})
+	require.NoError(t, err)
+}
+
+func TestConsumer_Run_rebalanceCallbacksWithoutGroup(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), offsetMsgs(1)...))
+
+	recorder := &rebalanceRecorder{}
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return broker.Reader("", "some-topic") }),
+		WithOnPartitionsAssigned(recorder.record("assigned")),
+	)
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		assert.Equal(t, 0, msg.Generation)
+		return c.Stop()
+	})
+	require.NoError(t, err)
+	assert.Empty(t, recorder.recorded(), "partitions are only assigned to group members")
+}
+
+func TestGroup_Run_rebalanceCallbacks(t *testing.T) {
+	broker := kafkatest.NewFakeBroker()
+	broker.CreateTopic("some-topic", 2)
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), offsetMsgs(10)...))
+
+	recorder := &rebalanceRecorder{}
+	group := NewGroup(GroupConfig{Count: 2, Topic: "some-topic", GroupID: "some-group"},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }),
+		WithOnPartitionsAssigned(recorder.record("assigned")),
+		WithOnPartitionsRevoked(recorder.record("revoked")),
+	)
+
+	errCh := group.Run(context.Background(), func(ctx context.Context, msg Message) error { return nil })
+	require.Eventually(t, func() bool {
+		return broker.CommittedOffset("some-group", "some-topic", 0)+broker.CommittedOffset("some-group", "some-topic", 1) == 10
+	}, time.Second, time.Millisecond)
+
+	_, err := group.Shutdown(context.Background())
+	require.NoError(t, err)
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+
+	// Each consumer is assigned partitions, which are revoked on shutdown.
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, member := range group.Health().Members {
+		assigned, ok := recorder.last["assigned:"+member.ConsumerID]
+		require.True(t, ok, "partitions should be assigned to consumer %s", member.ConsumerID)
+		assert.Equal(t, assigned.Generation, recorder.last["revoked:"+member.ConsumerID].Generation)
+	}
+	assert.Len(t, recorder.last, 4)
+}
+
+func TestGroupReader_FetchMessage(t *testing.T) {
+	var revoked []int
+	r := &groupReader{
+		conf:     kafka.ReaderConfig{RebalanceTimeout: time.Second},
+		assigned: func(ctx context.Context, generation int, partitions map[string][]int) {},
+		revoked: func(ctx context.Context, generation int, partitions map[string][]int) {
+			revoked = append(revoked, generation)
+		},
+		msgs:   make(chan groupMessage, 10),
+		closed: make(chan struct{}),
+	}
+
+	gen1 := newTestGroupGeneration(1)
+	gen2 := newTestGroupGeneration(2)
+	r.msgs <- groupMessage{gen: gen1, assigned: true}
+	r.msgs <- groupMessage{gen: gen1, msg: kafka.Message{Topic: "some-topic", Offset: 0}}
+	r.msgs <- groupMessage{gen: gen1, msg: kafka.Message{Topic: "some-topic", Offset: 1}}
+	r.msgs <- groupMessage{gen: gen2, assigned: true}
+	r.msgs <- groupMessage{gen: gen2, msg: kafka.Message{Topic: "some-topic", Offset: 1}}
+
+	msg, err := r.FetchMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), msg.Offset)
+
+	// Ending the generation waits for the fetched message to be committed.
+	ended := make(chan struct{})
+	go func() {
+		r.end(gen1)
+		close(ended)
+	}()
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.current == nil
+	}, time.Second, time.Millisecond)
+	select {
+	case <-ended:
+		t.Fatal("the generation should not end until the fetched message is committed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	gen1.commit(map[string]map[int]int64{"some-topic": {0: 1}})
+	<-ended
+	assert.Equal(t, []int{1}, revoked)
+
+	// The message left from the ended generation is dropped.
+	msg, err = r.FetchMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), msg.Offset)
+	assert.Same(t, gen2, r.current)
+}
+
+func TestGroupReader_PartitionStats(t *testing.T) {
+	r := &groupReader{readers: make(map[partitionReader]struct{})}
+	first := &statsPartitionReader{stats: kafka.ReaderStats{Topic: "some-topic", Partition: "10", Lag: 10}}
+	second := &statsPartitionReader{stats: kafka.ReaderStats{Topic: "some-topic", Partition: "2", Lag: 5}}
+	other := &statsPartitionReader{stats: kafka.ReaderStats{Topic: "other-topic", Partition: "0", Lag: 1}}
+	r.addReader(first)
+	r.addReader(second)
+	r.addReader(other)
+
+	assert.Equal(t, []kafka.ReaderStats{other.stats, second.stats, first.stats}, r.PartitionStats())
+
+	// revoked partitions are no longer included
+	r.removeReader(second)
+	assert.True(t, second.closed)
+	assert.Equal(t, []kafka.ReaderStats{other.stats, first.stats}, r.PartitionStats())
+}
+
+func TestConsumer_newPartitionReader(t *testing.T) {
+	conf := kafka.ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "some-topic"}
+
+	withReader := WithKafkaReader(func() Reader { return newQueueReader() })
+
+	reader := NewConsumer(Config{}, withReader).newPartitionReader(conf)
+	defer reader.Close()
+	assert.IsType(t, &kafka.Reader{}, reader)
+
+	traced := NewConsumer(Config{}, withReader, WithDataDogTracing()).newPartitionReader(conf)
+	defer traced.Close()
+	assert.IsType(t, &kafkatrace.Reader{}, traced)
+}
+
+// statsPartitionReader is a partitionReader reporting fixed stats.
+type statsPartitionReader struct {
+	stats  kafka.ReaderStats
+	closed bool
+}
+
+func (r *statsPartitionReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *statsPartitionReader) SetOffset(int64) error    { return nil }
+func (r *statsPartitionReader) Stats() kafka.ReaderStats { return r.stats }
+func (r *statsPartitionReader) Close() error             { r.closed = true; return nil }
+
+func newTestGroupGeneration(id int32) *groupGeneration {
+	return &groupGeneration{
+		Generation: &kafka.Generation{ID: id},
+		partitions: map[string][]int{"some-topic": {0}},
+		fetched:    make(map[topicPartition]int64),
+		committed:  make(map[topicPartition]int64),
+		changed:    make(chan struct{}),
+	}
+}
@@ -0,0 +1,172 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+// Headers added to messages published to a retry topic. The original topic,
+// partition and offset are those of the message before its first retry.
+const (
+	RetryNotBeforeHeader         = "x-retry-not-before"
+	RetryCountHeader             = "x-retry-count"
+	RetryErrorHeader             = "x-retry-error"
+	RetryOriginalTopicHeader     = "x-retry-original-topic"
+	RetryOriginalPartitionHeader = "x-retry-original-partition"
+	RetryOriginalOffsetHeader    = "x-retry-original-offset"
+)
+
+// RetryTopic is a topic that failed messages are published to, to be handled
+// again by a retry group (see NewRetryGroup) once the delay has passed.
+type RetryTopic struct {
+	Topic string
+	Delay time.Duration
+}
+
+type retryTopics struct {
+	topics    []RetryTopic
+	opts      []producer.Option
+	publisher deadLetterPublisher
+}
+
+// newPublisher creates the retry producer using the same brokers and dialer as
+// the consumer. The producer has no topic, as each retry message sets its own.
+// Any producer options passed to WithRetryTopics are applied afterwards so they
+// take precedence.
+func (r *retryTopics) newPublisher(conf kafka.ReaderConfig) {
+	opts := append([]producer.Option{producer.WithKafkaDialer(conf.Dialer)}, r.opts...)
+	r.publisher = producer.NewProducer(producer.Config{
+		Brokers: conf.Brokers,
+	}, opts...)
+}
+
+// next returns the index of the retry topic the message should be published to
+// after failing, or false if it has already been through every retry topic.
+func (r *retryTopics) next(msg kafka.Message) (int, bool) {
+	for i, topic := range r.topics {
+		if topic.Topic == msg.Topic {
+			return i + 1, i+1 < len(r.topics)
+		}
+	}
+	return 0, len(r.topics) > 0
+}
+
+func (r *retryTopics) publish(ctx context.Context, tier int, msg kafka.Message, handlerErr error) error {
+	topic := r.topics[tier]
+
+	// Headers from a previous retry are replaced, apart from the original
+	// message details.
+	var headers []kafka.Header
+	original := map[string][]byte{
+		RetryOriginalTopicHeader:     []byte(msg.Topic),
+		RetryOriginalPartitionHeader: []byte(strconv.Itoa(msg.Partition)),
+		RetryOriginalOffsetHeader:    []byte(strconv.FormatInt(msg.Offset, 10)),
+	}
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case RetryOriginalTopicHeader, RetryOriginalPartitionHeader, RetryOriginalOffsetHeader:
+			original[h.Key] = h.Value
+		case RetryNotBeforeHeader, RetryCountHeader, RetryErrorHeader:
+		default:
+			headers = append(headers, h)
+		}
+	}
+
+	retryMsg := kafka.Message{
+		Topic: topic.Topic,
+		Key:   msg.Key,
+		Value: msg.Value,
+		Time:  msg.Time,
+		Headers: append(headers,
+			kafka.Header{Key: RetryNotBeforeHeader, Value: []byte(time.Now().Add(topic.Delay).UTC().Format(time.RFC3339Nano))},
+			kafka.Header{Key: RetryCountHeader, Value: []byte(strconv.Itoa(tier + 1))},
+			kafka.Header{Key: RetryErrorHeader, Value: []byte(errorString(handlerErr))},
+			kafka.Header{Key: RetryOriginalTopicHeader, Value: original[RetryOriginalTopicHeader]},
+			kafka.Header{Key: RetryOriginalPartitionHeader, Value: original[RetryOriginalPartitionHeader]},
+			kafka.Header{Key: RetryOriginalOffsetHeader, Value: original[RetryOriginalOffsetHeader]},
+		),
+	}
+
+	if err := r.publisher.Publish(ctx, retryMsg); err != nil {
+		return errors.Errorf("unable to publish message to retry topic %s: %w", topic.Topic, err)
+	}
+
+	return nil
+}
+
+func (r *retryTopics) close() error {
+	if err := r.publisher.Close(); err != nil {
+		return errors.Errorf("unable to close retry producer: %w", err)
+	}
+
+	return nil
+}
+
+// notBefore returns the latest time set by RetryNotBeforeHeader on the messages.
+// Invalid header values are ignored.
+func notBefore(msgs ...kafka.Message) time.Time {
+	var due time.Time
+	for _, msg := range msgs {
+		for _, h := range msg.Headers {
+			if h.Key != RetryNotBeforeHeader {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339Nano, string(h.Value)); err == nil && t.After(due) {
+				due = t
+			}
+		}
+	}
+
+	return due
+}
+
+// waitUntilDue blocks until the messages are due to be handled according to
+// their RetryNotBeforeHeader. It returns false without an error if stop is
+// closed first, in which case the messages must not be committed so that they
+// are redelivered. A nil stop channel is never closed, which must be used when
+// the messages have already been committed.
+func (c *Consumer) waitUntilDue(ctx context.Context, stop <-chan struct{}, msgs ...kafka.Message) (bool, error) {
+	wait := time.Until(notBefore(msgs...))
+	if wait <= 0 {
+		return true, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-stop:
+		return false, nil
+	case <-ctx.Done():
+		return false, errors.Errorf("unable to wait for retry message to be due: %w", ctx.Err())
+	}
+}
+
+// NewRetryGroup returns a Group that consumes the retry topics, handling each
+// message once the delay of its retry topic has passed. Messages that fail again
+// are published to the next retry topic, and once every retry topic has been
+// tried to the dead letter topic if one is set with WithDeadLetterTopic.
+//
+// GroupConfig.Count consumers are run for each retry topic, and GroupConfig.Topic
+// is ignored. The group is configured with WithRetryTopics and WithExplicitCommit
+// before the other options, so that messages waiting to be due are redelivered
+// if the group is stopped. Pass WithRetryTopics with the same topics to set
+// producer options.
+func NewRetryGroup(config GroupConfig, topics []RetryTopic, opts ...Option) *Group {
+	g := NewGroup(config, append([]Option{WithRetryTopics(topics), WithExplicitCommit()}, opts...)...)
+
+	g.topics = make([]string, len(topics))
+	for i, topic := range topics {
+		g.topics[i] = topic.Topic
+	}
+
+	return g
+}
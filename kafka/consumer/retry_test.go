@@ -0,0 +1,173 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+func TestConsumer_Run_retryTopics(t *testing.T) {
+	const retryDelay = 100 * time.Millisecond
+	wantErr := errors.New("some handler error")
+
+	// Topics are created up front, as creating a topic re-balances the group.
+	broker := kafkatest.NewFakeBroker()
+	for _, topic := range []string{"some-topic", "some-topic-retry-1", "some-topic-retry-2", "some-topic-dlq"} {
+		broker.CreateTopic(topic, 1)
+	}
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(),
+		kafka.Message{Key: []byte("fails"), Value: []byte("some-value")},
+		kafka.Message{Key: []byte("succeeds"), Value: []byte("some-value")},
+	))
+
+	topics := []RetryTopic{
+		{Topic: "some-topic-retry-1", Delay: retryDelay},
+		{Topic: "some-topic-retry-2", Delay: retryDelay},
+	}
+	opts := []Option{
+		WithRetryTopics(topics, producer.WithKafkaWriter(func() producer.Writer { return broker.Writer("") })),
+		WithDeadLetterTopic("some-topic-dlq", producer.WithKafkaWriter(func() producer.Writer { return broker.Writer("some-topic-dlq") })),
+	}
+
+	var mu sync.Mutex
+	var handled []Message
+	var handledAt []time.Time
+	handler := func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, msg)
+		handledAt = append(handledAt, time.Now())
+		if string(msg.Key) == "fails" {
+			return wantErr
+		}
+		return nil
+	}
+
+	// The main consumer publishes the failed message to the first retry topic
+	// without blocking the partition.
+	c := NewConsumer(Config{Topic: "some-topic"},
+		append(opts, WithKafkaReader(func() Reader { return broker.Reader("some-group", "some-topic") }), WithExplicitCommit())...,
+	)
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Run(context.Background(), handler) }()
+	require.Eventually(t, func() bool {
+		return broker.CommittedOffset("some-group", "some-topic", 0) == 2
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, c.Stop())
+	require.NoError(t, <-errCh)
+
+	retryMsgs := broker.Messages("some-topic-retry-1")
+	require.Len(t, retryMsgs, 1)
+	assert.Equal(t, "fails", string(retryMsgs[0].Key))
+	assert.Equal(t, "1", headerValue(retryMsgs[0], RetryCountHeader))
+	assert.Equal(t, wantErr.Error(), headerValue(retryMsgs[0], RetryErrorHeader))
+	assert.Equal(t, "some-topic", headerValue(retryMsgs[0], RetryOriginalTopicHeader))
+	assert.Equal(t, "0", headerValue(retryMsgs[0], RetryOriginalOffsetHeader))
+
+	// The retry group handles the message once each delay has passed, then
+	// publishes it to the dead letter topic after the last retry topic.
+	readers := []Reader{
+		broker.Reader("some-group", "some-topic-retry-1"),
+		broker.Reader("some-group", "some-topic-retry-2"),
+	}
+	next := 0
+	group := NewRetryGroup(GroupConfig{GroupID: "some-group"}, topics,
+		append(opts, WithKafkaReader(func() Reader {
+			r := readers[next]
+			next++
+			return r
+		}))...,
+	)
+	groupErrCh := group.Run(context.Background(), handler)
+	require.Eventually(t, func() bool {
+		return len(broker.Messages("some-topic-dlq")) == 1
+	}, 5*time.Second, time.Millisecond)
+	_, err := group.Shutdown(context.Background())
+	require.NoError(t, err)
+	for err := range groupErrCh {
+		require.NoError(t, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, handled, 4)
+	for i := 2; i < 4; i++ {
+		assert.Equal(t, "fails", string(handled[i].Key))
+		notBefore, err := time.Parse(time.RFC3339Nano, headerValue(handled[i].Message, RetryNotBeforeHeader))
+		require.NoError(t, err)
+		assert.False(t, handledAt[i].Before(notBefore), "retry messages should not be handled before they are due")
+	}
+
+	retryMsgs = broker.Messages("some-topic-retry-2")
+	require.Len(t, retryMsgs, 1)
+	assert.Equal(t, "2", headerValue(retryMsgs[0], RetryCountHeader))
+	assert.Equal(t, "some-topic", headerValue(retryMsgs[0], RetryOriginalTopicHeader))
+	assert.Len(t, retryMsgs[0].Headers, 6, "headers from the previous retry should be replaced")
+
+	dlqMsg := broker.Messages("some-topic-dlq")[0]
+	assert.Equal(t, "some-topic-retry-2", headerValue(dlqMsg, DeadLetterOriginalTopicHeader))
+	assert.Equal(t, "some-topic", headerValue(dlqMsg, RetryOriginalTopicHeader))
+}
+
+func TestConsumer_Run_retryTopicsWithoutDeadLetter(t *testing.T) {
+	wantErr := errors.New("some handler error")
+	msg := kafka.Message{Topic: "some-topic-retry", Offset: 0}
+
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return newQueueReader(msg) }),
+		WithRetryTopics([]RetryTopic{{Topic: "some-topic-retry"}},
+			producer.WithKafkaWriter(func() producer.Writer { return kafkatest.NewFakeBroker().Writer("") }),
+		),
+	)
+
+	err := c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		return wantErr
+	})
+	assert.ErrorIs(t, err, wantErr)
+}
+
+func TestConsumer_Run_retryNotDueStopped(t *testing.T) {
+	for _, concurrency := range []int{1, 2} {
+		msg := kafka.Message{
+			Topic:   "some-topic-retry",
+			Headers: []kafka.Header{{Key: RetryNotBeforeHeader, Value: []byte(time.Now().Add(time.Hour).Format(time.RFC3339Nano))}},
+		}
+		reader := newQueueReader(msg)
+		c := NewConsumer(Config{},
+			WithKafkaReader(func() Reader { return reader }),
+			WithExplicitCommit(),
+			WithConcurrency(concurrency, OrderByPartition),
+		)
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+				t.Error("the handler should not be called before the message is due")
+				return nil
+			})
+		}()
+
+		require.Eventually(t, func() bool { return len(reader.msgs) == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, c.Stop())
+		require.NoError(t, <-errCh)
+		assert.Empty(t, reader.committedOffsets(), "messages not yet due should be redelivered")
+	}
+}
+
+func headerValue(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
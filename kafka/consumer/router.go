@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/go-errors/errors"
+)
+
+// ErrNoRoute is returned by Router.Route when no handler matches the topic of
+// the message. It is not retried.
+var ErrNoRoute = errors.Errorf("no handler for topic")
+
+// Router routes messages consumed from multiple topics to a handler per topic.
+// Messages are routed by Metadata.SourceTopic, so messages read from a retry
+// topic go to the handler of the topic they were first consumed from.
+//
+//	router := consumer.NewRouter()
+//	router.Handle("orders", handleOrder)
+//	router.HandlePattern(regexp.MustCompile(`^invoices-`), handleInvoice)
+//	errCh := group.Run(ctx, router.Route)
+//
+// Handlers must be registered before the router is used.
+type Router struct {
+	topics   map[string]Handler
+	patterns []patternRoute
+	fallback Handler
+}
+
+type patternRoute struct {
+	pattern *regexp.Regexp
+	handler Handler
+}
+
+// NewRouter returns a new Router without any handlers.
+func NewRouter() *Router {
+	return &Router{
+		topics: make(map[string]Handler),
+	}
+}
+
+// Handle routes messages from the topic to the handler.
+func (r *Router) Handle(topic string, handler Handler) {
+	r.topics[topic] = handler
+}
+
+// HandlePattern routes messages from topics matching the pattern to the handler.
+// Topics registered with Handle take precedence, then patterns are tried in the
+// order they were registered.
+func (r *Router) HandlePattern(pattern *regexp.Regexp, handler Handler) {
+	r.patterns = append(r.patterns, patternRoute{pattern: pattern, handler: handler})
+}
+
+// HandleDefault routes messages from topics not matching any other route to the
+// handler.
+func (r *Router) HandleDefault(handler Handler) {
+	r.fallback = handler
+}
+
+// Route handles the message with the handler for its topic. It is a Handler, so
+// it can be passed to Consumer.Run or Group.Run.
+func (r *Router) Route(ctx context.Context, msg Message) error {
+	topic := msg.SourceTopic
+	if topic == "" {
+		topic = msg.Topic
+	}
+
+	handler := r.handler(topic)
+	if handler == nil {
+		return permanent(errors.Errorf("unable to route message from topic %s: %w", topic, ErrNoRoute))
+	}
+
+	return handler(ctx, msg)
+}
+
+func (r *Router) handler(topic string) Handler {
+	if handler, ok := r.topics[topic]; ok {
+		return handler
+	}
+
+	for _, route := range r.patterns {
+		if route.pattern.MatchString(topic) {
+			return route.handler
+		}
+	}
+
+	return r.fallback
+}
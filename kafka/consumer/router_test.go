@@ -0,0 +1,163 @@
+package consumer
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+)
+
+func TestRouter_Route(t *testing.T) {
+	var routed string
+	routeTo := func(name string) Handler {
+		return func(ctx context.Context, msg Message) error {
+			routed = name
+			return nil
+		}
+	}
+
+	router := NewRouter()
+	router.Handle("orders", routeTo("orders"))
+	router.Handle("orders-archive", routeTo("orders-archive"))
+	router.HandlePattern(regexp.MustCompile(`^orders-`), routeTo("orders-pattern"))
+	router.HandlePattern(regexp.MustCompile(`^invoices-`), routeTo("invoices-pattern"))
+
+	tests := []struct {
+		name        string
+		sourceTopic string
+		topic       string
+		want        string
+	}{
+		{name: "topic", sourceTopic: "orders", want: "orders"},
+		{name: "topic before pattern", sourceTopic: "orders-archive", want: "orders-archive"},
+		{name: "pattern", sourceTopic: "orders-eu", want: "orders-pattern"},
+		{name: "second pattern", sourceTopic: "invoices-eu", want: "invoices-pattern"},
+		{name: "retry topic", sourceTopic: "orders", topic: "orders-retry-1m", want: "orders"},
+		{name: "no source topic", topic: "orders", want: "orders"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routed = ""
+			msg := Message{
+				Message:  kafka.Message{Topic: tt.topic},
+				Metadata: Metadata{SourceTopic: tt.sourceTopic},
+			}
+			require.NoError(t, router.Route(context.Background(), msg))
+			assert.Equal(t, tt.want, routed)
+		})
+	}
+
+	t.Run("no route", func(t *testing.T) {
+		err := router.Route(context.Background(), Message{Metadata: Metadata{SourceTopic: "users"}})
+		assert.ErrorIs(t, err, ErrNoRoute)
+
+		var permanentErr *permanentError
+		assert.ErrorAs(t, err, &permanentErr, "missing routes should not be retried")
+	})
+
+	t.Run("default", func(t *testing.T) {
+		router.HandleDefault(routeTo("default"))
+		require.NoError(t, router.Route(context.Background(), Message{Metadata: Metadata{SourceTopic: "users"}}))
+		assert.Equal(t, "default", routed)
+	})
+}
+
+func TestMessageHandler_dispatchMetadata_sourceTopic(t *testing.T) {
+	h := &messageHandler{}
+
+	msg := kafka.Message{Topic: "some-topic"}
+	assert.Equal(t, "some-topic", h.dispatchMetadata(msg, 0, 1).SourceTopic)
+
+	msg = kafka.Message{
+		Topic:   "some-topic-retry-1",
+		Headers: []kafka.Header{{Key: RetryOriginalTopicHeader, Value: []byte("some-topic")}},
+	}
+	assert.Equal(t, "some-topic", h.dispatchMetadata(msg, 0, 1).SourceTopic, "retried messages come from the original topic")
+}
+
+func TestNewConsumer_groupTopics(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{
+			name:   "single topic",
+			config: Config{Topic: "some-topic", groupID: "some-group"},
+		},
+		{
+			name:   "multiple topics",
+			config: Config{Topic: "some-topic", groupTopics: []string{"other-topic", "some-topic", ""}, groupID: "some-group"},
+			want:   []string{"some-topic", "other-topic"},
+		},
+		{
+			name:   "topics without topic",
+			config: Config{groupTopics: []string{"some-topic", "other-topic"}, groupID: "some-group"},
+			want:   []string{"some-topic", "other-topic"},
+		},
+		{
+			name:   "one topic without topic",
+			config: Config{groupTopics: []string{"some-topic"}, groupID: "some-group"},
+			want:   []string{"some-topic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConsumer(tt.config, WithKafkaReader(func() Reader { return newQueueReader() }))
+			assert.Equal(t, tt.want, c.conf.GroupTopics)
+		})
+	}
+}
+
+func TestGroup_Run_topics(t *testing.T) {
+	topics := []string{"orders", "invoices-au", "invoices-us"}
+
+	broker := kafkatest.NewFakeBroker()
+	for _, topic := range topics {
+		broker.CreateTopic(topic, 2)
+		require.NoError(t, broker.Writer(topic).WriteMessages(context.Background(), offsetMsgs(4)...))
+	}
+
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	record := func(name string) Handler {
+		return func(ctx context.Context, msg Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled[name+":"+msg.SourceTopic]++
+			return nil
+		}
+	}
+
+	router := NewRouter()
+	router.Handle("orders", record("orders"))
+	router.HandlePattern(regexp.MustCompile(`^invoices-`), record("invoices"))
+
+	group := NewGroup(GroupConfig{Count: 2, Topic: "orders", Topics: []string{"invoices-au", "invoices-us"}, GroupID: "some-group"},
+		WithKafkaReader(func() Reader { return broker.Reader("some-group", topics...) }),
+		WithExplicitCommit(),
+	)
+	errCh := group.Run(context.Background(), router.Route)
+
+	want := map[string]int{"orders:orders": 4, "invoices:invoices-au": 4, "invoices:invoices-us": 4}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return assert.ObjectsAreEqual(want, handled)
+	}, time.Second, time.Millisecond)
+
+	_, err := group.Shutdown(context.Background())
+	require.NoError(t, err)
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,232 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-errors/errors"
+)
+
+// ShutdownStatus reports the final status of a consumer after Shutdown.
+type ShutdownStatus struct {
+	ConsumerID string
+	// Drained is true if every in-flight message finished being handled before
+	// the shutdown deadline. Messages that had not finished are not committed,
+	// so they will be redelivered.
+	Drained bool
+	// Err is any error that occurred while shutting down the consumer.
+	Err error
+}
+
+// GroupShutdownStatus reports the final status of each consumer in a group after
+// Shutdown.
+type GroupShutdownStatus struct {
+	GroupID   string
+	Consumers []ShutdownStatus
+}
+
+// Drained returns true if every consumer in the group was drained.
+func (s GroupShutdownStatus) Drained() bool {
+	for _, status := range s.Consumers {
+		if !status.Drained {
+			return false
+		}
+	}
+	return true
+}
+
+// Shutdown gracefully stops the consumer. It stops fetching messages, waits for
+// any in-flight messages to finish being handled and committed, then closes the
+// reader stream, which leaves the consumer group. This is intended for handling
+// a SIGTERM without messages being redelivered.
+//
+// If the context is done before the in-flight messages have been handled, the
+// context passed to their handlers is canceled and Shutdown waits for them to
+// return before closing the reader. Handlers should therefore respect context
+// cancellation.
+func (c *Consumer) Shutdown(ctx context.Context) (ShutdownStatus, error) {
+	c.conf.Logger.Printf(
+		"consumer(%s:%s): shutting down",
+		c.conf.Topic,
+		c.id,
+	)
+
+	c.signalStop()
+	status := ShutdownStatus{ConsumerID: c.id, Drained: true}
+
+	c.runMu.Lock()
+	done, cancelRun := c.runDone, c.cancelRun
+	c.runMu.Unlock()
+
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			status.Drained = false
+			status.Err = errors.Errorf("consumer did not drain before the shutdown deadline: %w", ctx.Err())
+			cancelRun()
+			<-done
+		}
+	}
+
+	if err := c.close(); err != nil {
+		status.Err = errors.Join(status.Err, err)
+	}
+
+	return status, status.Err
+}
+
+// Shutdown gracefully stops every consumer in the group concurrently, see
+// Consumer.Shutdown. The returned error joins the errors from each consumer.
+func (g *Group) Shutdown(ctx context.Context) (GroupShutdownStatus, error) {
+	g.mu.Lock()
+	consumers := append([]*Consumer{}, g.consumers...)
+	g.mu.Unlock()
+
+	status := GroupShutdownStatus{
+		GroupID:   g.ID,
+		Consumers: make([]ShutdownStatus, len(consumers)),
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status.Consumers[i], _ = c.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, s := range status.Consumers {
+		if s.Err != nil {
+			errs = append(errs, errors.Errorf("consumer %s: %w", s.ConsumerID, s.Err))
+		}
+	}
+
+	return status, errors.Join(errs...)
+}
+
+// begin marks the consumer as running. The returned context is passed to
+// handlers, and is only canceled early if a Shutdown deadline passes. The
+// returned func must be called with the error Run returns once the consumer is
+// no longer running.
+func (c *Consumer) begin(ctx context.Context) (context.Context, func(err error)) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	c.runMu.Lock()
+	c.runDone = done
+	c.cancelRun = cancel
+	c.runMu.Unlock()
+
+	c.health.running()
+	go c.reportStats(ctx)
+
+	return ctx, func(err error) {
+		cancel()
+		c.gate.reset()
+		c.health.stopped(err)
+
+		// Now nothing is in-flight the reader can be closed if the consumer was
+		// stopped while running.
+		if c.stopping() {
+			if err := c.close(); err != nil {
+				c.conf.ErrorLogger.Printf(
+					"consumer(%s:%s): %s",
+					c.conf.Topic,
+					c.id,
+					err.Error(),
+				)
+			}
+		}
+		close(done)
+	}
+}
+
+func (c *Consumer) isRunning() bool {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	if c.runDone == nil {
+		return false
+	}
+
+	select {
+	case <-c.runDone:
+		return false
+	default:
+		return true
+	}
+}
+
+// fetchContext returns the context used to fetch messages. It is also canceled
+// once the consumer is stopped, so that a blocked fetch returns straight away
+// without affecting in-flight handlers.
+func (c *Consumer) fetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-c.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// stoppedFetching returns true if a fetch error was caused by the consumer being
+// stopped or paused.
+func (c *Consumer) stoppedFetching(err error) bool {
+	return errors.Is(err, errFetchPaused) || (c.stopping() && errors.Is(err, context.Canceled))
+}
+
+func (c *Consumer) signalStop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+}
+
+func (c *Consumer) stopping() bool {
+	select {
+	case <-c.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes the reader stream and dead letter producer once, returning the
+// same error on every call.
+func (c *Consumer) close() error {
+	c.closeOnce.Do(func() {
+		if err := c.reader.Close(); err != nil {
+			c.closeErr = errors.Errorf("unable to close consumer reader: %w", err)
+			return
+		}
+
+		if c.clientHandler.deadLetter != nil {
+			if err := c.clientHandler.deadLetter.close(); err != nil {
+				c.closeErr = err
+				return
+			}
+		}
+
+		if c.clientHandler.retryTopics != nil {
+			if err := c.clientHandler.retryTopics.close(); err != nil {
+				c.closeErr = err
+				return
+			}
+		}
+
+		c.conf.Logger.Printf(
+			"consumer(%s:%s): consumer has stopped",
+			c.conf.Topic,
+			c.id,
+		)
+	})
+
+	return c.closeErr
+}
@@ -0,0 +1,195 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_Shutdown(t *testing.T) {
+	reader := newQueueReader(offsetMsgs(3)...)
+	c := NewConsumer(Config{ID: "some-consumer"},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+	)
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+			if msg.Offset == 1 {
+				close(handling)
+				<-release
+			}
+			return nil
+		})
+	}()
+
+	<-handling
+	statusCh := make(chan ShutdownStatus, 1)
+	go func() {
+		status, err := c.Shutdown(context.Background())
+		assert.NoError(t, err)
+		statusCh <- status
+	}()
+
+	// Shutdown waits for the in-flight message before closing the reader.
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, isClosed(reader), "reader should not be closed while a message is in-flight")
+	close(release)
+
+	status := <-statusCh
+	assert.Equal(t, ShutdownStatus{ConsumerID: "some-consumer", Drained: true}, status)
+	require.NoError(t, <-errCh)
+
+	assert.Equal(t, []int64{0, 1}, reader.committedOffsets(), "in-flight message should be committed and no more fetched")
+	assert.True(t, isClosed(reader))
+}
+
+func TestConsumer_Shutdown_deadline(t *testing.T) {
+	reader := newQueueReader(offsetMsgs(1)...)
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+	)
+
+	handling := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+			close(handling)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	<-handling
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	status, err := c.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, status.Drained)
+	assert.Equal(t, err, status.Err)
+
+	require.ErrorIs(t, <-errCh, context.Canceled)
+	assert.Empty(t, reader.committedOffsets(), "unfinished message should not be committed")
+	assert.True(t, isClosed(reader))
+}
+
+func TestConsumer_Shutdown_notRunning(t *testing.T) {
+	reader := newQueueReader()
+	c := NewConsumer(Config{}, WithKafkaReader(func() Reader { return reader }))
+
+	status, err := c.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.True(t, status.Drained)
+	assert.True(t, isClosed(reader))
+
+	// Stopping an already shut down consumer is a no-op.
+	require.NoError(t, c.Stop())
+}
+
+func TestConsumer_Shutdown_concurrent(t *testing.T) {
+	reader := newQueueReader(offsetMsgs(10)...)
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+		WithConcurrency(2, OrderByPartition),
+	)
+
+	started := make(chan struct{})
+	var once sync.Once
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(context.Background(), func(ctx context.Context, msg Message) error {
+			once.Do(func() { close(started) })
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+	}()
+
+	<-started
+	status, err := c.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.True(t, status.Drained)
+	require.NoError(t, <-errCh)
+
+	// Every fetched message is handled and committed before the reader is closed.
+	committed := reader.committedOffsets()
+	require.NotEmpty(t, committed)
+	assert.Equal(t, int64(len(committed)-1), committed[len(committed)-1])
+	assert.Len(t, reader.msgs, 10-len(committed))
+}
+
+func TestConsumer_Shutdown_batch(t *testing.T) {
+	reader := newQueueReader(offsetMsgs(3)...)
+	c := NewConsumer(Config{},
+		WithKafkaReader(func() Reader { return reader }),
+		WithBatching(10, time.Minute),
+	)
+
+	var gotSizes []int
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.RunBatch(context.Background(), func(ctx context.Context, msgs []Message) error {
+			gotSizes = append(gotSizes, len(msgs))
+			return nil
+		})
+	}()
+
+	// Wait for the messages to be fetched while the batch lingers.
+	require.Eventually(t, func() bool { return len(reader.msgs) == 0 }, time.Second, time.Millisecond)
+
+	status, err := c.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.True(t, status.Drained)
+	require.NoError(t, <-errCh)
+
+	assert.Equal(t, []int{3}, gotSizes, "partial batch should be handled on shutdown")
+	assert.Equal(t, []int64{0, 1, 2}, reader.committedOffsets())
+}
+
+func TestGroup_Shutdown(t *testing.T) {
+	reader := newQueueReader(offsetMsgs(10)...)
+	group := NewGroup(GroupConfig{Count: 3, GroupID: "some-group"},
+		WithKafkaReader(func() Reader { return reader }),
+		WithExplicitCommit(),
+	)
+
+	handled := new(safeCounter)
+	errCh := group.Run(context.Background(), func(ctx context.Context, msg Message) error {
+		handled.inc()
+		return nil
+	})
+	require.Eventually(t, func() bool { return handled.val() == 10 }, time.Second, time.Millisecond)
+
+	status, err := group.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, group.ID, status.GroupID)
+	assert.Len(t, status.Consumers, 3)
+	assert.True(t, status.Drained())
+
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+	assert.Len(t, reader.committedOffsets(), 10)
+	assert.True(t, isClosed(reader))
+
+	// Stopping an already shut down group is a no-op.
+	group.Stop()
+}
+
+func isClosed(r *queueReader) bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
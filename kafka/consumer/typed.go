@@ -0,0 +1,158 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-errors/errors"
+	"github.com/heetch/avro"
+)
+
+// SchemaRegistry retrieves the Avro schemas used to decode typed messages. It is
+// implemented by the decoder of a schema registry client, for example
+// avroregistry.Registry.Decoder(), or kafkatest.FakeRegistry.Decoder() in tests.
+type SchemaRegistry interface {
+	// DecodeSchemaID returns the schema ID header of the message and the bare
+	// message without schema information.
+	DecodeSchemaID(msg []byte) (int64, []byte)
+	// SchemaForID returns the schema for the given ID.
+	SchemaForID(ctx context.Context, id int64) (*avro.Type, error)
+}
+
+// TypedHandler specifies how a consumer should handle a received Kafka message
+// once its value has been decoded into the event type T.
+type TypedHandler[T any] func(ctx context.Context, event T, msg Message) error
+
+// TypedConsumer is a Consumer that decodes each message value from Avro into
+// the event type T before calling the handler.
+type TypedConsumer[T any] struct {
+	*Consumer
+	registry SchemaRegistry
+}
+
+// NewTypedConsumer returns a new TypedConsumer configured with the provided
+// config, decoding messages with schemas from the registry.
+func NewTypedConsumer[T any](config Config, registry SchemaRegistry, opts ...Option) *TypedConsumer[T] {
+	return &TypedConsumer[T]{
+		Consumer: NewConsumer(config, opts...),
+		registry: registry,
+	}
+}
+
+// Run consumes, decodes and handles messages from the topic. The method call
+// blocks until the context is canceled, the consumer is closed, or an error occurs.
+func (c *TypedConsumer[T]) Run(ctx context.Context, handler TypedHandler[T]) error {
+	return c.Consumer.Run(ctx, NewTypedHandler(c.registry, handler))
+}
+
+// NewTypedHandler returns a Handler that decodes each message value from Avro
+// into the event type T before calling the typed handler. It can be used to run
+// a Group with typed messages.
+//
+// Schemas are cached locally once retrieved from the registry. If the registry
+// cannot be reached the handler error is retried as normal, but messages that
+// cannot be decoded are never retried. Decode failures are reported through the
+// NotifyError function, and published to the dead letter topic if one is set
+// using WithDeadLetterTopic, otherwise the consumer stops with the error.
+func NewTypedHandler[T any](registry SchemaRegistry, handler TypedHandler[T]) Handler {
+	decoder := newTypedDecoder(registry)
+
+	return func(ctx context.Context, msg Message) error {
+		var event T
+		if err := decoder.decode(ctx, msg.Value, &event); err != nil {
+			return err
+		}
+
+		return handler(ctx, event, msg)
+	}
+}
+
+// schemaLookupError is returned when a schema could not be retrieved from the
+// registry, as opposed to a message that could not be decoded.
+type schemaLookupError struct {
+	err error
+}
+
+func (e *schemaLookupError) Error() string {
+	return e.err.Error()
+}
+
+func (e *schemaLookupError) Unwrap() error {
+	return e.err
+}
+
+// schemaCache caches schemas retrieved from the registry. Unlike the cache
+// within avro.SingleDecoder, lookup errors are not cached so they can be retried.
+type schemaCache struct {
+	registry SchemaRegistry
+	mu       sync.RWMutex
+	schemas  map[int64]*avro.Type
+}
+
+func (c *schemaCache) DecodeSchemaID(msg []byte) (int64, []byte) {
+	return c.registry.DecodeSchemaID(msg)
+}
+
+func (c *schemaCache) SchemaForID(ctx context.Context, id int64) (*avro.Type, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema, err := c.registry.SchemaForID(ctx, id)
+	if err != nil {
+		return nil, &schemaLookupError{err: err}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schemas[id] = schema
+	return schema, nil
+}
+
+type typedDecoder struct {
+	cache   *schemaCache
+	mu      sync.RWMutex
+	decoder *avro.SingleDecoder
+}
+
+func newTypedDecoder(registry SchemaRegistry) *typedDecoder {
+	cache := &schemaCache{
+		registry: registry,
+		schemas:  make(map[int64]*avro.Type),
+	}
+
+	return &typedDecoder{
+		cache:   cache,
+		decoder: avro.NewSingleDecoder(cache, nil),
+	}
+}
+
+func (d *typedDecoder) decode(ctx context.Context, data []byte, event any) error {
+	d.mu.RLock()
+	decoder := d.decoder
+	d.mu.RUnlock()
+
+	_, err := decoder.Unmarshal(ctx, data, event)
+	if err == nil {
+		return nil
+	}
+
+	var lookupErr *schemaLookupError
+	if errors.As(err, &lookupErr) {
+		// avro.SingleDecoder remembers failed schema lookups forever, so replace it
+		// to allow the lookup to be retried. Successfully retrieved schemas are
+		// kept in the schema cache.
+		d.mu.Lock()
+		if d.decoder == decoder {
+			d.decoder = avro.NewSingleDecoder(d.cache, nil)
+		}
+		d.mu.Unlock()
+
+		return errors.Errorf("unable to retrieve message schema: %w", err)
+	}
+
+	return permanent(errors.Errorf("unable to decode message: %w", err))
+}
@@ -0,0 +1,165 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/heetch/avro"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+type typedTestEvent struct {
+	ID    string
+	Count int
+}
+
+func TestTypedConsumer_Run(t *testing.T) {
+	ctx := context.Background()
+	registry := kafkatest.NewFakeRegistry()
+	wantEvents := []typedTestEvent{{ID: "one", Count: 1}, {ID: "two", Count: 2}, {ID: "three", Count: 3}}
+
+	reader := NewMockReader(gomock.NewController(t))
+	reader.EXPECT().Close().Return(nil).Times(1)
+	for _, e := range wantEvents {
+		reader.EXPECT().ReadMessage(gomock.Any()).Return(encodeTypedMsg(t, registry, e), nil).Times(1)
+	}
+
+	c := NewTypedConsumer[typedTestEvent](Config{}, registry.Decoder(),
+		WithKafkaReader(func() Reader { return reader }),
+	)
+
+	var gotEvents []typedTestEvent
+	err := c.Run(ctx, func(ctx context.Context, event typedTestEvent, msg Message) error {
+		assert.NotEmpty(t, msg.Value)
+		gotEvents = append(gotEvents, event)
+		if len(gotEvents) == len(wantEvents) {
+			require.NoError(t, c.Stop())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, wantEvents, gotEvents)
+	assert.Equal(t, 1, registry.Fetches(), "schema should be cached after the first fetch")
+}
+
+func TestTypedConsumer_Run_registryUnavailable(t *testing.T) {
+	ctx := context.Background()
+	registry := kafkatest.NewFakeRegistry()
+	wantEvent := typedTestEvent{ID: "one", Count: 1}
+	wantErr := errors.New("registry unavailable")
+
+	reader := NewMockReader(gomock.NewController(t))
+	reader.EXPECT().Close().Return(nil).Times(1)
+	reader.EXPECT().ReadMessage(gomock.Any()).Return(encodeTypedMsg(t, registry, wantEvent), nil).Times(1)
+
+	var notified []error
+	registry.SetError(wantErr)
+	c := NewTypedConsumer[typedTestEvent](Config{}, registry.Decoder(),
+		WithKafkaReader(func() Reader { return reader }),
+		WithHandlerBackOffRetry(func() backoff.BackOff {
+			return &testBackoff{maxAttempts: 5}
+		}),
+		WithNotifyError(func(ctx context.Context, err error, msg Message) {
+			notified = append(notified, err)
+			if msg.Attempt == 2 {
+				registry.SetError(nil)
+			}
+		}),
+	)
+
+	err := c.Run(ctx, func(ctx context.Context, event typedTestEvent, msg Message) error {
+		assert.Equal(t, wantEvent, event)
+		assert.Equal(t, 3, msg.Attempt)
+		require.NoError(t, c.Stop())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, notified, 2)
+	for _, err := range notified {
+		assert.ErrorIs(t, err, wantErr)
+	}
+}
+
+func TestTypedConsumer_Run_decodeError(t *testing.T) {
+	ctx := context.Background()
+	registry := kafkatest.NewFakeRegistry()
+	badMsg := randMsg()
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantDLQ   bool
+		wantError bool
+	}{
+		{
+			name:      "decode error stops the consumer",
+			wantError: true,
+		},
+		{
+			name:    "decode error is published to the dead letter topic",
+			wantDLQ: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewMockReader(gomock.NewController(t))
+			reader.EXPECT().Close().Return(nil).AnyTimes()
+			reader.EXPECT().ReadMessage(gomock.Any()).Return(badMsg, nil).Times(1)
+			if tt.wantDLQ {
+				reader.EXPECT().ReadMessage(gomock.Any()).Return(encodeTypedMsg(t, registry, typedTestEvent{}), nil).Times(1)
+			}
+
+			var notifications int
+			dlqWriter := &fakeWriter{}
+			opts := []Option{
+				WithKafkaReader(func() Reader { return reader }),
+				WithHandlerBackOffRetry(NonStopExponentialBackOff),
+				WithNotifyError(func(ctx context.Context, err error, msg Message) {
+					notifications++
+				}),
+			}
+			if tt.wantDLQ {
+				opts = append(opts, WithDeadLetterTopic("some-dlq-topic", producer.WithKafkaWriter(func() producer.Writer {
+					return dlqWriter
+				})))
+			}
+
+			c := NewTypedConsumer[typedTestEvent](Config{}, registry.Decoder(), opts...)
+			err := c.Run(ctx, func(ctx context.Context, event typedTestEvent, msg Message) error {
+				require.NoError(t, c.Stop())
+				return nil
+			})
+
+			assert.Equal(t, 1, notifications, "decode errors should not be retried")
+			if tt.wantError {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "unable to decode message")
+			} else {
+				require.NoError(t, err)
+			}
+			if tt.wantDLQ {
+				require.Len(t, dlqWriter.msgs, 1)
+				assert.Equal(t, badMsg.Value, dlqWriter.msgs[0].Value)
+			}
+		})
+	}
+}
+
+func encodeTypedMsg(t *testing.T, registry *kafkatest.FakeRegistry, event typedTestEvent) kafka.Message {
+	encoder := avro.NewSingleEncoder(registry.Encoder(), nil)
+	value, err := encoder.Marshal(context.Background(), event)
+	require.NoError(t, err)
+
+	msg := randMsg()
+	msg.Value = value
+	return msg
+}
@@ -0,0 +1,541 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// FakeBroker is an in-memory Kafka broker used to test producers and consumers
+// end-to-end in unit tests without running Kafka.
+//
+// Readers returned from the broker implement consumer.Reader, so they can be
+// injected with consumer.WithKafkaReader, and writers implement producer.Writer,
+// so they can be injected with producer.WithKafkaWriter. Readers in the same
+// consumer group share the topic partitions between them, and the group
+// committed offsets are kept by the broker.
+type FakeBroker struct {
+	mu       sync.Mutex
+	topics   map[string][][]kafka.Message // messages per partition
+	groups   map[string]*fakeGroup
+	balancer kafka.Hash
+	changed  chan struct{} // closed and replaced whenever a reader may be unblocked
+}
+
+type fakeGroup struct {
+	generation int
+	members    []*FakeReader // in join order
+	offsets    map[fakeTopicPartition]int64
+}
+
+type fakeTopicPartition struct {
+	topic     string
+	partition int
+}
+
+// NewFakeBroker returns a new FakeBroker without any topics.
+func NewFakeBroker() *FakeBroker {
+	return &FakeBroker{
+		topics:  make(map[string][][]kafka.Message),
+		groups:  make(map[string]*fakeGroup),
+		changed: make(chan struct{}),
+	}
+}
+
+// CreateTopic creates a topic with the number of partitions. Topics that are
+// written to before being created are created with a single partition.
+func (b *FakeBroker) CreateTopic(topic string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.topics[topic]; ok {
+		return
+	}
+	b.topics[topic] = make([][]kafka.Message, max(partitions, 1))
+	b.rebalanceTopic(topic)
+}
+
+// Messages returns every message written to the topic, ordered by partition and
+// then offset.
+func (b *FakeBroker) Messages(topic string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var msgs []kafka.Message
+	for _, partition := range b.topics[topic] {
+		msgs = append(msgs, partition...)
+	}
+	return msgs
+}
+
+// CommittedOffset returns the offset committed by the consumer group for the
+// topic partition, which is the offset of the next message to be read. It
+// returns -1 if the group has not committed an offset.
+func (b *FakeBroker) CommittedOffset(groupID, topic string, partition int) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, ok := b.groups[groupID]
+	if !ok {
+		return -1
+	}
+	offset, ok := g.offsets[fakeTopicPartition{topic: topic, partition: partition}]
+	if !ok {
+		return -1
+	}
+	return offset
+}
+
+// Rebalance simulates the consumer group being re-balanced, such as when a
+// member fails a heartbeat. Partitions are re-assigned across the readers in the
+// group and each reader resumes from the group committed offsets, so any message
+// that was fetched but not committed is delivered again.
+func (b *FakeBroker) Rebalance(groupID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if g, ok := b.groups[groupID]; ok {
+		b.rebalance(g)
+	}
+}
+
+// Writer returns a new writer that writes messages to the topic. If topic is
+// empty, each message must set its own topic instead. Messages are assigned a
+// partition by hashing their key, and messages without a key are assigned
+// partitions in a round robin.
+func (b *FakeBroker) Writer(topic string) *FakeWriter {
+	return &FakeWriter{broker: b, topic: topic}
+}
+
+// Reader returns a new reader for the topics that joins the consumer group,
+// which re-balances the group. If groupID is empty, the reader reads every
+// partition from the first offset, and committing messages is not supported.
+func (b *FakeBroker) Reader(groupID string, topics ...string) *FakeReader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r := &FakeReader{
+		broker:    b,
+		groupID:   groupID,
+		topics:    topics,
+		positions: make(map[fakeTopicPartition]int64),
+		closed:    make(chan struct{}),
+	}
+
+	if groupID == "" {
+		return r // reads every partition, see next
+	}
+
+	g, ok := b.groups[groupID]
+	if !ok {
+		g = &fakeGroup{offsets: make(map[fakeTopicPartition]int64)}
+		b.groups[groupID] = g
+	}
+	g.members = append(g.members, r)
+	b.rebalance(g)
+
+	return r
+}
+
+func (b *FakeBroker) write(topic string, msgs []kafka.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range msgs {
+		if topic != "" {
+			msg.Topic = topic
+		}
+		if msg.Topic == "" {
+			return errors.New("unable to write message: topic must be set on the writer or message")
+		}
+
+		partitions, ok := b.topics[msg.Topic]
+		if !ok {
+			partitions = make([][]kafka.Message, 1)
+			b.topics[msg.Topic] = partitions
+			b.rebalanceTopic(msg.Topic)
+		}
+
+		ids := make([]int, len(partitions))
+		for i := range ids {
+			ids[i] = i
+		}
+		msg.Partition = b.balancer.Balance(msg, ids...)
+		msg.Offset = int64(len(partitions[msg.Partition]))
+		if msg.Time.IsZero() {
+			msg.Time = time.Now()
+		}
+		partitions[msg.Partition] = append(partitions[msg.Partition], msg)
+	}
+
+	b.notify()
+	return nil
+}
+
+// rebalanceTopic re-balances every group with a member reading the topic, so
+// they are assigned any new partitions.
+func (b *FakeBroker) rebalanceTopic(topic string) {
+	for _, g := range b.groups {
+		for _, m := range g.members {
+			if m.reads(topic) {
+				b.rebalance(g)
+				break
+			}
+		}
+	}
+}
+
+// rebalance assigns the partitions of each topic in a round robin across the
+// group members reading the topic, and resets their positions to the committed
+// offsets.
+func (b *FakeBroker) rebalance(g *fakeGroup) {
+	g.generation++
+
+	var topics []string
+	members := make(map[string][]*FakeReader)
+	for _, m := range g.members {
+		m.assigned = nil
+		m.positions = make(map[fakeTopicPartition]int64)
+		m.generation = g.generation
+		for _, topic := range m.topics {
+			if _, ok := members[topic]; !ok {
+				topics = append(topics, topic)
+			}
+			members[topic] = append(members[topic], m)
+		}
+	}
+
+	for _, topic := range topics {
+		readers := members[topic]
+		for p := range b.topics[topic] {
+			tp := fakeTopicPartition{topic: topic, partition: p}
+			r := readers[p%len(readers)]
+			r.assigned = append(r.assigned, tp)
+			if offset, ok := g.offsets[tp]; ok {
+				r.positions[tp] = offset
+			}
+		}
+	}
+
+	b.notify()
+}
+
+// notify unblocks any readers waiting for a change. The lock must be held.
+func (b *FakeBroker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// FakeWriter writes messages to a FakeBroker. It implements producer.Writer.
+type FakeWriter struct {
+	broker *FakeBroker
+	topic  string
+}
+
+// WriteMessages writes the messages to the broker.
+func (w *FakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.broker.write(w.topic, msgs)
+}
+
+// Close is a no-op.
+func (w *FakeWriter) Close() error {
+	return nil
+}
+
+// FakeReader reads messages from the partitions of FakeBroker topics assigned to
+// it. It implements consumer.Reader.
+type FakeReader struct {
+	broker     *FakeBroker
+	groupID    string
+	topics     []string
+	generation int
+	assigned   []fakeTopicPartition
+	positions  map[fakeTopicPartition]int64 // next offset to fetch per assigned partition
+	cursor     int                          // next assigned partition to fetch from
+	closed     chan struct{}
+	isClosed   bool
+
+	onAssigned func(ctx context.Context, generation int, partitions map[string][]int)
+	onRevoked  func(ctx context.Context, generation int, partitions map[string][]int)
+	notified   fakeAssignment // the assignment last reported to onAssigned
+}
+
+type fakeAssignment struct {
+	generation int
+	partitions map[string][]int
+}
+
+// OnRebalance sets functions called when partitions are assigned to or revoked
+// from the reader. They are called from FetchMessage once the reader notices the
+// group has been re-balanced, before the next message is returned, and revoked
+// is also called when the reader is closed. It implements the reader interface used by the
+// consumer WithOnPartitionsAssigned and WithOnPartitionsRevoked options.
+func (r *FakeReader) OnRebalance(assigned, revoked func(ctx context.Context, generation int, partitions map[string][]int)) {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	r.onAssigned = assigned
+	r.onRevoked = revoked
+}
+
+// FetchMessage returns the next message from the assigned partitions, blocking
+// until one is available, the context is done, or the reader is closed. The
+// partitions are read from in a round robin.
+func (r *FakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	b := r.broker
+	for {
+		b.mu.Lock()
+		if r.isClosed {
+			b.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+		if revoked, assigned, ok := r.rebalanced(); ok {
+			b.mu.Unlock()
+			r.notify(ctx, revoked, assigned)
+			continue
+		}
+		if msg, ok := r.next(); ok {
+			b.mu.Unlock()
+			return msg, nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-r.closed:
+			return kafka.Message{}, io.EOF
+		case <-changed:
+		}
+	}
+}
+
+// rebalanced returns the assignment to revoke and the new assignment if the
+// group has been re-balanced since the assignment was last reported. The lock
+// must be held.
+func (r *FakeReader) rebalanced() (revoked, assigned fakeAssignment, ok bool) {
+	if r.onAssigned == nil || r.generation == r.notified.generation {
+		return fakeAssignment{}, fakeAssignment{}, false
+	}
+
+	revoked = r.notified
+	assigned = fakeAssignment{generation: r.generation, partitions: make(map[string][]int)}
+	for _, tp := range r.assigned {
+		assigned.partitions[tp.topic] = append(assigned.partitions[tp.topic], tp.partition)
+	}
+	for _, partitions := range assigned.partitions {
+		sort.Ints(partitions)
+	}
+	r.notified = assigned
+
+	return revoked, assigned, true
+}
+
+// notify reports the revoked assignment, if any, and then the new assignment.
+func (r *FakeReader) notify(ctx context.Context, revoked, assigned fakeAssignment) {
+	if revoked.generation != 0 {
+		r.onRevoked(ctx, revoked.generation, revoked.partitions)
+	}
+	r.onAssigned(ctx, assigned.generation, assigned.partitions)
+}
+
+// next returns the next message from the assigned partitions. The lock must be held.
+func (r *FakeReader) next() (kafka.Message, bool) {
+	if r.groupID == "" {
+		r.assigned = r.assigned[:0]
+		for _, topic := range r.topics {
+			for p := range r.broker.topics[topic] {
+				r.assigned = append(r.assigned, fakeTopicPartition{topic: topic, partition: p})
+			}
+		}
+	}
+
+	for range r.assigned {
+		tp := r.assigned[r.cursor%len(r.assigned)]
+		r.cursor++
+
+		partition := r.broker.topics[tp.topic][tp.partition]
+		offset := r.positions[tp]
+		if offset < int64(len(partition)) {
+			r.positions[tp] = offset + 1
+			msg := partition[offset]
+			msg.HighWaterMark = int64(len(partition))
+			return msg, true
+		}
+	}
+	return kafka.Message{}, false
+}
+
+// reads returns whether the reader reads the topic.
+func (r *FakeReader) reads(topic string) bool {
+	for _, t := range r.topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadMessage fetches the next message and commits it straight away.
+func (r *FakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	msg, err := r.FetchMessage(ctx)
+	if err != nil {
+		return msg, err
+	}
+	if r.groupID == "" {
+		return msg, nil
+	}
+	return msg, r.CommitMessages(ctx, msg)
+}
+
+// CommitMessages commits the offsets of the messages for the consumer group.
+func (r *FakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if r.groupID == "" {
+		return errors.New("unavailable when GroupID is not set")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b := r.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.groups[r.groupID]
+	for _, msg := range msgs {
+		g.offsets[fakeTopicPartition{topic: msg.Topic, partition: msg.Partition}] = msg.Offset + 1
+	}
+	return nil
+}
+
+// Close closes the reader, which leaves the consumer group and re-balances it.
+// Any further fetches return io.EOF.
+func (r *FakeReader) Close() error {
+	b := r.broker
+	b.mu.Lock()
+	if r.isClosed {
+		b.mu.Unlock()
+		return nil
+	}
+	r.isClosed = true
+	close(r.closed)
+	revoked := r.notified
+	r.notified = fakeAssignment{}
+	b.mu.Unlock()
+
+	// The partitions are revoked before leaving the group, so that they are not
+	// yet assigned to another reader.
+	if revoked.generation != 0 {
+		r.onRevoked(context.Background(), revoked.generation, revoked.partitions)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if g, ok := b.groups[r.groupID]; ok {
+		for i, m := range g.members {
+			if m == r {
+				g.members = append(g.members[:i], g.members[i+1:]...)
+				break
+			}
+		}
+		b.rebalance(g)
+	}
+	return nil
+}
+
+// SeekToOffset moves the reader to the offset of the partition of every topic it
+// reads. For a consumer
+// group the offset is committed for the group, which is then re-balanced so that
+// every member resumes from the committed offsets, as it would with Kafka. It
+// implements consumer.Seeker.
+func (r *FakeReader) SeekToOffset(ctx context.Context, partition int, offset int64) error {
+	return r.seek(ctx, func(partitions [][]kafka.Message) map[int]int64 {
+		return map[int]int64{partition: offset}
+	})
+}
+
+// SeekToTimestamp moves the reader to the first message in each partition with a
+// time at or after t, or to the end of partitions without one. See SeekToOffset
+// for how a consumer group is moved. It implements consumer.Seeker.
+func (r *FakeReader) SeekToTimestamp(ctx context.Context, t time.Time) error {
+	return r.seek(ctx, func(partitions [][]kafka.Message) map[int]int64 {
+		offsets := make(map[int]int64, len(partitions))
+		for p, msgs := range partitions {
+			i := sort.Search(len(msgs), func(i int) bool {
+				return !msgs[i].Time.Before(t)
+			})
+			offsets[p] = int64(i)
+		}
+		return offsets
+	})
+}
+
+func (r *FakeReader) seek(ctx context.Context, offsetsFor func(partitions [][]kafka.Message) map[int]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b := r.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if r.isClosed {
+		return io.ErrClosedPipe
+	}
+
+	offsets := make(map[fakeTopicPartition]int64)
+	for _, topic := range r.topics {
+		for p, offset := range offsetsFor(b.topics[topic]) {
+			offsets[fakeTopicPartition{topic: topic, partition: p}] = offset
+		}
+	}
+
+	if r.groupID == "" {
+		for tp, offset := range offsets {
+			r.positions[tp] = offset
+		}
+		b.notify()
+		return nil
+	}
+
+	g := b.groups[r.groupID]
+	for tp, offset := range offsets {
+		g.offsets[tp] = offset
+	}
+	b.rebalance(g)
+	return nil
+}
+
+// Assignment returns the partitions of the first topic read currently assigned
+// to the reader, in order.
+func (r *FakeReader) Assignment() []int {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	var assigned []int
+	for _, tp := range r.assigned {
+		if tp.topic == r.topics[0] {
+			assigned = append(assigned, tp.partition)
+		}
+	}
+	sort.Ints(assigned)
+	return assigned
+}
+
+// Generation returns the consumer group generation the reader last joined,
+// which is incremented every time the group is re-balanced.
+func (r *FakeReader) Generation() int {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+	return r.generation
+}
@@ -0,0 +1,242 @@
+package kafkatest
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeBroker_write(t *testing.T) {
+	broker := NewFakeBroker()
+	broker.CreateTopic("some-topic", 3)
+
+	w := broker.Writer("some-topic")
+	require.NoError(t, w.WriteMessages(context.Background(),
+		kafka.Message{Key: []byte("some-key"), Value: []byte("0")},
+		kafka.Message{Key: []byte("some-key"), Value: []byte("1")},
+		kafka.Message{Key: []byte("other-key"), Value: []byte("2")},
+	))
+
+	msgs := broker.Messages("some-topic")
+	require.Len(t, msgs, 3)
+	byValue := make(map[string]kafka.Message)
+	for _, msg := range msgs {
+		assert.Equal(t, "some-topic", msg.Topic)
+		assert.False(t, msg.Time.IsZero())
+		byValue[string(msg.Value)] = msg
+	}
+	assert.Equal(t, byValue["0"].Partition, byValue["1"].Partition, "messages with the same key should be in the same partition")
+	assert.Equal(t, int64(0), byValue["0"].Offset)
+	assert.Equal(t, int64(1), byValue["1"].Offset)
+
+	// topics are created with a single partition when first written to
+	require.NoError(t, broker.Writer("").WriteMessages(context.Background(), kafka.Message{Topic: "other-topic"}))
+	require.Len(t, broker.Messages("other-topic"), 1)
+	assert.Equal(t, 0, broker.Messages("other-topic")[0].Partition)
+
+	err := broker.Writer("").WriteMessages(context.Background(), kafka.Message{})
+	assert.ErrorContains(t, err, "topic must be set")
+}
+
+func TestFakeReader_CommitMessages(t *testing.T) {
+	broker := NewFakeBroker()
+	writeMessages(t, broker, "some-topic", 3)
+
+	r := broker.Reader("some-group", "some-topic")
+	assert.Equal(t, int64(-1), broker.CommittedOffset("some-group", "some-topic", 0))
+	assert.Equal(t, int64(-1), broker.CommittedOffset("other-group", "some-topic", 0))
+
+	msg := fetch(t, r)
+	assert.Equal(t, int64(0), msg.Offset)
+	assert.Equal(t, int64(3), msg.HighWaterMark)
+	assert.Equal(t, int64(-1), broker.CommittedOffset("some-group", "some-topic", 0), "fetching should not commit")
+
+	require.NoError(t, r.CommitMessages(context.Background(), msg))
+	assert.Equal(t, int64(1), broker.CommittedOffset("some-group", "some-topic", 0))
+
+	// ReadMessage commits straight away
+	msg, err := r.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), msg.Offset)
+	assert.Equal(t, int64(2), broker.CommittedOffset("some-group", "some-topic", 0))
+
+	// a new member of the group resumes from the committed offset
+	require.NoError(t, r.Close())
+	r = broker.Reader("some-group", "some-topic")
+	assert.Equal(t, int64(2), fetch(t, r).Offset)
+
+	// readers outside a group can't commit
+	err = broker.Reader("", "some-topic").CommitMessages(context.Background(), msg)
+	assert.Error(t, err)
+}
+
+func TestFakeReader_FetchMessage(t *testing.T) {
+	broker := NewFakeBroker()
+	r := broker.Reader("", "some-topic")
+
+	// blocks until a message is written
+	fetched := make(chan kafka.Message, 1)
+	go func() {
+		msg, err := r.FetchMessage(context.Background())
+		assert.NoError(t, err)
+		fetched <- msg
+	}()
+	writeMessages(t, broker, "some-topic", 1)
+	select {
+	case msg := <-fetched:
+		assert.Equal(t, "0", string(msg.Value))
+	case <-time.After(time.Second):
+		t.Fatal("the message should have been fetched")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := r.FetchMessage(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, r.Close())
+	_, err = r.FetchMessage(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestFakeBroker_Rebalance(t *testing.T) {
+	broker := NewFakeBroker()
+	broker.CreateTopic("some-topic", 4)
+
+	first := broker.Reader("some-group", "some-topic")
+	assert.Equal(t, []int{0, 1, 2, 3}, first.Assignment())
+	assert.Equal(t, 1, first.Generation())
+
+	// joining the group shares the partitions between its members
+	second := broker.Reader("some-group", "some-topic")
+	assert.Equal(t, []int{0, 2}, first.Assignment())
+	assert.Equal(t, []int{1, 3}, second.Assignment())
+	assert.Equal(t, 2, first.Generation())
+	assert.Equal(t, 2, second.Generation())
+
+	// leaving the group assigns its partitions to the remaining members
+	require.NoError(t, second.Close())
+	assert.Equal(t, []int{0, 1, 2, 3}, first.Assignment())
+	assert.Equal(t, 3, first.Generation())
+
+	broker.Rebalance("some-group")
+	assert.Equal(t, 4, first.Generation())
+	broker.Rebalance("other-group") // no-op
+}
+
+func TestFakeBroker_Rebalance_redelivery(t *testing.T) {
+	broker := NewFakeBroker()
+	writeMessages(t, broker, "some-topic", 3)
+
+	r := broker.Reader("some-group", "some-topic")
+	first := fetch(t, r)
+	require.NoError(t, r.CommitMessages(context.Background(), first))
+	assert.Equal(t, int64(1), fetch(t, r).Offset)
+
+	// the fetched message that wasn't committed is delivered again
+	broker.Rebalance("some-group")
+	assert.Equal(t, int64(1), fetch(t, r).Offset)
+	assert.Equal(t, int64(2), fetch(t, r).Offset)
+}
+
+func TestFakeReader_OnRebalance(t *testing.T) {
+	broker := NewFakeBroker()
+	broker.CreateTopic("some-topic", 2)
+	writeMessages(t, broker, "some-topic", 4)
+
+	var events []string
+	record := func(event string) func(context.Context, int, map[string][]int) {
+		return func(_ context.Context, generation int, partitions map[string][]int) {
+			events = append(events, event+":"+strconv.Itoa(generation)+":"+strconv.Itoa(len(partitions["some-topic"])))
+		}
+	}
+
+	r := broker.Reader("some-group", "some-topic")
+	r.OnRebalance(record("assigned"), record("revoked"))
+	assert.Empty(t, events, "the callbacks should only be called from FetchMessage")
+
+	fetch(t, r)
+	assert.Equal(t, []string{"assigned:1:2"}, events)
+
+	broker.Rebalance("some-group")
+	fetch(t, r)
+	assert.Equal(t, []string{"assigned:1:2", "revoked:1:2", "assigned:2:2"}, events)
+
+	require.NoError(t, r.Close())
+	assert.Equal(t, []string{"assigned:1:2", "revoked:1:2", "assigned:2:2", "revoked:2:2"}, events)
+}
+
+func TestFakeReader_SeekToOffset(t *testing.T) {
+	t.Run("group", func(t *testing.T) {
+		broker := NewFakeBroker()
+		writeMessages(t, broker, "some-topic", 5)
+
+		r := broker.Reader("some-group", "some-topic")
+		require.NoError(t, r.SeekToOffset(context.Background(), 0, 3))
+		assert.Equal(t, int64(3), broker.CommittedOffset("some-group", "some-topic", 0), "the offset should be committed for the group")
+		assert.Equal(t, 2, r.Generation(), "the group should be re-balanced")
+		assert.Equal(t, int64(3), fetch(t, r).Offset)
+	})
+
+	t.Run("no group", func(t *testing.T) {
+		broker := NewFakeBroker()
+		writeMessages(t, broker, "some-topic", 5)
+
+		r := broker.Reader("", "some-topic")
+		require.NoError(t, r.SeekToOffset(context.Background(), 0, 3))
+		assert.Equal(t, int64(3), fetch(t, r).Offset)
+		require.NoError(t, r.SeekToOffset(context.Background(), 0, 1))
+		assert.Equal(t, int64(1), fetch(t, r).Offset)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		r := NewFakeBroker().Reader("", "some-topic")
+		require.NoError(t, r.Close())
+		assert.ErrorIs(t, r.SeekToOffset(context.Background(), 0, 1), io.ErrClosedPipe)
+	})
+}
+
+func TestFakeReader_SeekToTimestamp(t *testing.T) {
+	broker := NewFakeBroker()
+	start := time.Date(2020, 11, 14, 11, 30, 0, 0, time.UTC)
+	var msgs []kafka.Message
+	for i := range 3 {
+		msgs = append(msgs, kafka.Message{Value: []byte(strconv.Itoa(i)), Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	require.NoError(t, broker.Writer("some-topic").WriteMessages(context.Background(), msgs...))
+
+	r := broker.Reader("some-group", "some-topic")
+	require.NoError(t, r.SeekToTimestamp(context.Background(), start.Add(30*time.Second)))
+	assert.Equal(t, int64(1), fetch(t, r).Offset)
+
+	// to the end of the partition if every message is older
+	require.NoError(t, r.SeekToTimestamp(context.Background(), start.Add(time.Hour)))
+	assert.Equal(t, int64(3), broker.CommittedOffset("some-group", "some-topic", 0))
+}
+
+func writeMessages(t *testing.T, broker *FakeBroker, topic string, n int) {
+	t.Helper()
+
+	msgs := make([]kafka.Message, n)
+	for i := range msgs {
+		msgs[i] = kafka.Message{Value: []byte(strconv.Itoa(i))}
+	}
+	require.NoError(t, broker.Writer(topic).WriteMessages(context.Background(), msgs...))
+}
+
+func fetch(t *testing.T, r *FakeReader) kafka.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := r.FetchMessage(ctx)
+	require.NoError(t, err)
+	return msg
+}
@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/cultureamp/ca-go/kafka/consumer"
+)
+
+type Option func(relay *Relay)
+
+// WithBatchSize sets the maximum number of messages published at once.
+//
+// Default: 100.
+func WithBatchSize(size int) Option {
+	return func(relay *Relay) {
+		if size > 0 {
+			relay.batchSize = size
+		}
+	}
+}
+
+// WithPollInterval sets how long the relay waits before polling the outbox again
+// once it has published every unsent message.
+//
+// Default: 1s.
+func WithPollInterval(interval time.Duration) Option {
+	return func(relay *Relay) {
+		relay.pollInterval = interval
+	}
+}
+
+// WithMaxAttempts sets the number of times a message can fail to be published
+// before the relay gives up on it. The message is reported to the NotifyError
+// function and left unsent in the outbox, with its attempts and last_error, and
+// the messages after it are then relayed. A value of 0 retries forever, holding
+// back every later message until it is published.
+//
+// Default: 0.
+func WithMaxAttempts(attempts int) Option {
+	return func(relay *Relay) {
+		if attempts >= 0 {
+			relay.maxAttempts = attempts
+		}
+	}
+}
+
+// WithBackOff sets the back off used to retry failures. If the back off gives
+// up, Run returns the error.
+//
+// Default: consumer.NonStopExponentialBackOff, with intervals capped at 30s.
+func WithBackOff(backOff consumer.HandlerRetryBackOffConstructor) Option {
+	return func(relay *Relay) {
+		relay.backOffConstructor = backOff
+	}
+}
+
+// WithNotifyError adds the NotifyError function to the relay for it to be invoked
+// on each error before it is retried, and for each message given up on.
+//
+// Default: the error is reported to Sentry using sentry.ReportError.
+func WithNotifyError(notifier NotifyError) Option {
+	return func(relay *Relay) {
+		relay.clientNotify = notifier
+	}
+}
@@ -0,0 +1,189 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+const outboxTable = "kafka_outbox"
+
+// Dialect is the SQL dialect of the database holding the outbox table.
+type Dialect int
+
+const (
+	// Postgres uses $1 style placeholders and locks the rows being relayed with
+	// FOR UPDATE, so that several relays can run at once without publishing the
+	// same rows concurrently.
+	Postgres Dialect = iota
+	// SQLite uses ? placeholders. SQLite has no row locks, and the relay's
+	// transaction only takes a shared lock while reading, so only one relay may
+	// run against an SQLite database.
+	SQLite
+)
+
+// Execer executes a statement, and is implemented by *sql.Tx and *sql.DB.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Config is a configuration object used to create a new Outbox.
+type Config struct {
+	Table   string // Default: kafka_outbox
+	Dialect Dialect
+}
+
+// Outbox stores messages in a database table in the same transaction as the
+// changes they describe, so that they are only published if the transaction
+// commits, and are not lost if the process dies before publishing them. A Relay
+// publishes the stored messages to Kafka.
+type Outbox struct {
+	table   string
+	dialect Dialect
+}
+
+// New returns a new Outbox using the table in the config.
+func New(config Config) *Outbox {
+	if config.Table == "" {
+		config.Table = outboxTable
+	}
+
+	return &Outbox{
+		table:   config.Table,
+		dialect: config.Dialect,
+	}
+}
+
+// Schema returns the statements creating the outbox table and its index, for use
+// in database migrations.
+func (o *Outbox) Schema() string {
+	return strings.Join(o.schema(), ";\n") + ";\n"
+}
+
+// CreateTable creates the outbox table and its index if they do not exist.
+func (o *Outbox) CreateTable(ctx context.Context, db Execer) error {
+	for _, stmt := range o.schema() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return errors.Errorf("unable to create outbox table: %w", err)
+		}
+	}
+	return nil
+}
+
+func (o *Outbox) schema() []string {
+	id, bytes, timestamp := "BIGSERIAL PRIMARY KEY", "BYTEA", "TIMESTAMPTZ"
+	if o.dialect == SQLite {
+		id, bytes, timestamp = "INTEGER PRIMARY KEY AUTOINCREMENT", "BLOB", "TIMESTAMP"
+	}
+
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id %s,
+	topic TEXT NOT NULL,
+	msg_key %s,
+	msg_value %s,
+	headers TEXT NOT NULL,
+	created_at %s NOT NULL,
+	sent_at %s,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT
+)`, o.table, id, bytes, bytes, timestamp, timestamp),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_unsent ON %s (sent_at, id)`, o.table, o.table),
+	}
+}
+
+// Enqueue stores a message to be published to the topic by a Relay. Pass the
+// transaction making the changes the message describes, so that the message is
+// only published if it commits.
+func (o *Outbox) Enqueue(ctx context.Context, tx Execer, topic string, key, value []byte, headers []kafka.Header) error {
+	encoded, err := encodeHeaders(headers)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (topic, msg_key, msg_value, headers, created_at) VALUES (%s)",
+		o.table,
+		o.placeholders(1, 5),
+	)
+	if _, err := tx.ExecContext(ctx, query, topic, key, value, encoded, time.Now().UTC()); err != nil {
+		return errors.Errorf("unable to enqueue message: %w", err)
+	}
+
+	return nil
+}
+
+// Purge deletes messages that were sent before the time, returning the number
+// deleted.
+func (o *Outbox) Purge(ctx context.Context, db Execer, before time.Time) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE sent_at IS NOT NULL AND sent_at < %s", o.table, o.placeholder(1))
+	res, err := db.ExecContext(ctx, query, before.UTC())
+	if err != nil {
+		return 0, errors.Errorf("unable to purge sent messages: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Errorf("unable to purge sent messages: %w", err)
+	}
+	return n, nil
+}
+
+// placeholder returns the nth (1-based) query placeholder.
+func (o *Outbox) placeholder(n int) string {
+	if o.dialect == SQLite {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// placeholders returns count comma separated placeholders, starting from the
+// nth.
+func (o *Outbox) placeholders(n, count int) string {
+	p := make([]string, count)
+	for i := range p {
+		p[i] = o.placeholder(n + i)
+	}
+	return strings.Join(p, ", ")
+}
+
+// header is the JSON encoding of a kafka.Header.
+type header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+func encodeHeaders(headers []kafka.Header) (string, error) {
+	h := make([]header, len(headers))
+	for i, kh := range headers {
+		h[i] = header{Key: kh.Key, Value: kh.Value}
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		return "", errors.Errorf("unable to encode message headers: %w", err)
+	}
+	return string(b), nil
+}
+
+func decodeHeaders(encoded string) ([]kafka.Header, error) {
+	var h []header
+	if err := json.Unmarshal([]byte(encoded), &h); err != nil {
+		return nil, errors.Errorf("unable to decode message headers: %w", err)
+	}
+	if len(h) == 0 {
+		return nil, nil
+	}
+
+	headers := make([]kafka.Header, len(h))
+	for i, oh := range h {
+		headers[i] = kafka.Header{Key: oh.Key, Value: oh.Value}
+	}
+	return headers, nil
+}
@@ -0,0 +1,133 @@
+package outbox
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox_Schema(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		contains []string
+	}{
+		{
+			name:     "postgres",
+			config:   Config{Dialect: Postgres},
+			contains: []string{"CREATE TABLE IF NOT EXISTS kafka_outbox", "BIGSERIAL PRIMARY KEY", "BYTEA", "TIMESTAMPTZ"},
+		},
+		{
+			name:     "sqlite",
+			config:   Config{Dialect: SQLite},
+			contains: []string{"CREATE TABLE IF NOT EXISTS kafka_outbox", "INTEGER PRIMARY KEY AUTOINCREMENT", "BLOB"},
+		},
+		{
+			name:     "table",
+			config:   Config{Table: "some_outbox"},
+			contains: []string{"CREATE TABLE IF NOT EXISTS some_outbox", "CREATE INDEX IF NOT EXISTS some_outbox_unsent ON some_outbox"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := New(tt.config).Schema()
+			for _, s := range tt.contains {
+				assert.Contains(t, schema, s)
+			}
+		})
+	}
+}
+
+func TestOutbox_CreateTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS kafka_outbox")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX IF NOT EXISTS kafka_outbox_unsent")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, New(Config{Dialect: SQLite}).CreateTable(context.Background(), db))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutbox_Enqueue(t *testing.T) {
+	tests := []struct {
+		name      string
+		dialect   Dialect
+		wantQuery string
+	}{
+		{
+			name:      "postgres",
+			dialect:   Postgres,
+			wantQuery: "INSERT INTO kafka_outbox (topic, msg_key, msg_value, headers, created_at) VALUES ($1, $2, $3, $4, $5)",
+		},
+		{
+			name:      "sqlite",
+			dialect:   SQLite,
+			wantQuery: "INSERT INTO kafka_outbox (topic, msg_key, msg_value, headers, created_at) VALUES (?, ?, ?, ?, ?)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(tt.wantQuery).
+				WithArgs("some-topic", []byte("some-key"), []byte("some-value"), `[{"key":"some-header","value":"c29tZS12YWx1ZQ=="}]`, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			tx, err := db.Begin()
+			require.NoError(t, err)
+			err = New(Config{Dialect: tt.dialect}).Enqueue(context.Background(), tx, "some-topic",
+				[]byte("some-key"), []byte("some-value"),
+				[]kafka.Header{{Key: "some-header", Value: []byte("some-value")}},
+			)
+			require.NoError(t, err)
+			require.NoError(t, tx.Commit())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestOutbox_Purge(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	before := time.Now().Add(-time.Hour)
+	mock.ExpectExec("DELETE FROM kafka_outbox WHERE sent_at IS NOT NULL AND sent_at < $1").
+		WithArgs(before.UTC()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := New(Config{}).Purge(context.Background(), db, before)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHeaders(t *testing.T) {
+	headers := []kafka.Header{{Key: "some-header", Value: []byte("some-value")}, {Key: "empty"}}
+
+	encoded, err := encodeHeaders(headers)
+	require.NoError(t, err)
+	decoded, err := decodeHeaders(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, headers, decoded)
+
+	encoded, err = encodeHeaders(nil)
+	require.NoError(t, err)
+	decoded, err = decodeHeaders(encoded)
+	require.NoError(t, err)
+	assert.Nil(t, decoded)
+}
@@ -0,0 +1,282 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/go-errors/errors"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/kafka/consumer"
+	"github.com/cultureamp/ca-go/sentry"
+)
+
+const (
+	relayBatchSize          = 100
+	relayPollInterval       = time.Second
+	relayBackOffMaxInterval = 30 * time.Second
+)
+
+// Publisher publishes messages to Kafka, and is implemented by
+// *producer.Producer. The producer must be created without a topic, as each
+// message sets its own.
+type Publisher interface {
+	Publish(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// NotifyError is a notify-on-error function used to report relay errors before
+// they are retried.
+type NotifyError func(ctx context.Context, err error)
+
+// Relay publishes messages stored in an Outbox to Kafka, in id order, and marks
+// them sent. Messages are published at least once: if marking them sent fails
+// they are published again.
+type Relay struct {
+	db                 *sql.DB
+	outbox             *Outbox
+	publisher          Publisher
+	batchSize          int
+	pollInterval       time.Duration
+	maxAttempts        int
+	backOffConstructor consumer.HandlerRetryBackOffConstructor
+	clientNotify       NotifyError
+}
+
+// NewRelay returns a new Relay publishing the messages stored in the outbox
+// table of the database.
+func NewRelay(db *sql.DB, outbox *Outbox, publisher Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		db:                 db,
+		outbox:             outbox,
+		publisher:          publisher,
+		batchSize:          relayBatchSize,
+		pollInterval:       relayPollInterval,
+		backOffConstructor: relayBackOff,
+		clientNotify:       sentry.ReportError,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// relayBackOff is the default relay back off: consumer.NonStopExponentialBackOff
+// with intervals capped at 30s, so that the relay resumes soon after the database
+// or Kafka recovers.
+func relayBackOff() backoff.BackOff {
+	bo := consumer.NonStopExponentialBackOff()
+	if exp, ok := bo.(*backoff.ExponentialBackOff); ok {
+		exp.MaxInterval = relayBackOffMaxInterval
+	}
+	return bo
+}
+
+// Run polls the outbox and publishes any unsent messages until the context is
+// canceled. Failures are retried using the back off (see WithBackOff), and Run
+// only returns an error if the back off gives up.
+func (r *Relay) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+
+		var sent int
+		err := backoff.RetryNotify(
+			func() error {
+				var err error
+				sent, err = r.Relay(ctx)
+				return err
+			},
+			backoff.WithContext(r.backOffConstructor(), ctx),
+			func(err error, _ time.Duration) {
+				r.clientNotify(ctx, err)
+			},
+		)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Errorf("outbox relay error: %w", err)
+		}
+
+		// Keep going straight away while there may be a backlog.
+		if sent == r.batchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(r.pollInterval)
+		}
+	}
+}
+
+// Relay publishes the next batch of unsent messages once, returning the number
+// sent. It is called by Run, and is exported for tests and for services relaying
+// on their own schedule.
+//
+// If publishing the batch fails its messages are published one at a time, so
+// those before the failing message are still sent and only the failing message
+// has its attempt recorded. Once a message has failed the maximum number of
+// attempts (see WithMaxAttempts) it is reported and skipped.
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Errorf("unable to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // has no effect once committed
+
+	batch, err := r.unsent(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	sent, pubErr := r.publish(ctx, batch)
+	if sent > 0 {
+		if err := r.markSent(ctx, tx, batch[:sent]); err != nil {
+			return 0, err
+		}
+	}
+
+	var failed *unsentMessage
+	if pubErr != nil {
+		failed = &batch[sent]
+		pubErr = errors.Errorf("unable to publish message %d: %w", failed.id, pubErr)
+		if err := r.markFailed(ctx, tx, failed.id, pubErr); err != nil {
+			return 0, errors.Join(pubErr, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Join(pubErr, errors.Errorf("unable to commit transaction: %w", err))
+	}
+
+	if failed != nil && r.maxAttempts > 0 && failed.attempts+1 >= r.maxAttempts {
+		// The message is no longer relayed, so the messages after it can be.
+		r.clientNotify(ctx, errors.Errorf("giving up on message %d after %d attempts: %w", failed.id, failed.attempts+1, pubErr))
+		return sent, nil
+	}
+
+	return sent, pubErr
+}
+
+// publish publishes the batch, returning the number of messages published. If
+// publishing the batch fails, the messages are published one at a time until one
+// fails.
+func (r *Relay) publish(ctx context.Context, batch []unsentMessage) (int, error) {
+	msgs := make([]kafka.Message, len(batch))
+	for i, m := range batch {
+		msgs[i] = m.msg
+	}
+
+	err := r.publisher.Publish(ctx, msgs...)
+	if err == nil {
+		return len(msgs), nil
+	}
+	if len(msgs) == 1 {
+		return 0, err
+	}
+
+	for i, msg := range msgs {
+		if err := r.publisher.Publish(ctx, msg); err != nil {
+			return i, err
+		}
+	}
+	return len(msgs), nil
+}
+
+// unsentMessage is an unsent message read from the outbox.
+type unsentMessage struct {
+	id       int64
+	attempts int
+	msg      kafka.Message
+}
+
+// unsent returns the next batch of unsent messages in id order, skipping those
+// that have failed the maximum number of attempts, and locking them for the
+// transaction with Postgres.
+func (r *Relay) unsent(ctx context.Context, tx *sql.Tx) ([]unsentMessage, error) {
+	o := r.outbox
+	where := "sent_at IS NULL"
+	if r.maxAttempts > 0 {
+		where += fmt.Sprintf(" AND attempts < %d", r.maxAttempts)
+	}
+	query := fmt.Sprintf(
+		"SELECT id, attempts, topic, msg_key, msg_value, headers FROM %s WHERE %s ORDER BY id LIMIT %d",
+		o.table,
+		where,
+		r.batchSize,
+	)
+	if o.dialect == Postgres {
+		query += " FOR UPDATE"
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Errorf("unable to query unsent messages: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []unsentMessage
+	for rows.Next() {
+		var m unsentMessage
+		var headers string
+		if err := rows.Scan(&m.id, &m.attempts, &m.msg.Topic, &m.msg.Key, &m.msg.Value, &headers); err != nil {
+			return nil, errors.Errorf("unable to read unsent message: %w", err)
+		}
+		if m.msg.Headers, err = decodeHeaders(headers); err != nil {
+			return nil, errors.Errorf("unable to read unsent message %d: %w", m.id, err)
+		}
+
+		batch = append(batch, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Errorf("unable to query unsent messages: %w", err)
+	}
+
+	return batch, nil
+}
+
+func (r *Relay) markSent(ctx context.Context, tx *sql.Tx, batch []unsentMessage) error {
+	o := r.outbox
+	query := fmt.Sprintf(
+		"UPDATE %s SET sent_at = %s WHERE id IN (%s)",
+		o.table,
+		o.placeholder(1),
+		o.placeholders(2, len(batch)),
+	)
+
+	args := []any{time.Now().UTC()}
+	for _, m := range batch {
+		args = append(args, m.id)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return errors.Errorf("unable to mark messages sent: %w", err)
+	}
+	return nil
+}
+
+func (r *Relay) markFailed(ctx context.Context, tx *sql.Tx, id int64, pubErr error) error {
+	o := r.outbox
+	query := fmt.Sprintf(
+		"UPDATE %s SET attempts = attempts + 1, last_error = %s WHERE id = %s",
+		o.table,
+		o.placeholder(1),
+		o.placeholder(2),
+	)
+
+	if _, err := tx.ExecContext(ctx, query, pubErr.Error(), id); err != nil {
+		return errors.Errorf("unable to record failed message %d: %w", id, err)
+	}
+	return nil
+}
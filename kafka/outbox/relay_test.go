@@ -0,0 +1,236 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+const (
+	unsentQuery = "SELECT id, attempts, topic, msg_key, msg_value, headers FROM kafka_outbox WHERE sent_at IS NULL ORDER BY id LIMIT 100 FOR UPDATE"
+	sentQuery   = "UPDATE kafka_outbox SET sent_at = $1 WHERE id IN ($2, $3)"
+	failedQuery = "UPDATE kafka_outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2"
+)
+
+func unsentRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "attempts", "topic", "msg_key", "msg_value", "headers"}).
+		AddRow(int64(3), 0, "some-topic", []byte("some-key"), []byte("first"), `[{"key":"some-header","value":"c29tZS12YWx1ZQ=="}]`).
+		AddRow(int64(7), 2, "other-topic", []byte("some-key"), []byte("second"), `[]`)
+}
+
+func TestRelay_Relay(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(unsentQuery).WillReturnRows(unsentRows())
+	mock.ExpectExec(sentQuery).WithArgs(sqlmock.AnyArg(), int64(3), int64(7)).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	broker := kafkatest.NewFakeBroker()
+	p := producer.NewProducer(producer.Config{}, producer.WithKafkaWriter(func() producer.Writer { return broker.Writer("") }))
+
+	sent, err := NewRelay(db, New(Config{}), p).Relay(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	msgs := broker.Messages("some-topic")
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "first", string(msgs[0].Value))
+	assert.Equal(t, []kafka.Header{{Key: "some-header", Value: []byte("some-value")}}, msgs[0].Headers)
+	require.Len(t, broker.Messages("other-topic"), 1)
+}
+
+func TestRelay_Relay_empty(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, attempts, topic, msg_key, msg_value, headers FROM kafka_outbox WHERE sent_at IS NULL ORDER BY id LIMIT 10").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attempts", "topic", "msg_key", "msg_value", "headers"}))
+	mock.ExpectRollback()
+
+	publisher := &fakePublisher{}
+	sent, err := NewRelay(db, New(Config{Dialect: SQLite}), publisher, WithBatchSize(10)).Relay(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Empty(t, publisher.published())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_Relay_publishError(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(unsentQuery).WillReturnRows(unsentRows())
+	mock.ExpectExec(failedQuery).
+		WithArgs("unable to publish message 3: some publish error", int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// the batch fails, and then the first message on its own
+	publisher := &fakePublisher{errs: []error{errors.New("some publish error"), errors.New("some publish error")}}
+	sent, err := NewRelay(db, New(Config{}), publisher).Relay(context.Background())
+	assert.ErrorContains(t, err, "some publish error")
+	assert.Equal(t, 0, sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_Relay_partialPublishError(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(unsentQuery).WillReturnRows(unsentRows())
+	mock.ExpectExec("UPDATE kafka_outbox SET sent_at = $1 WHERE id IN ($2)").
+		WithArgs(sqlmock.AnyArg(), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(failedQuery).
+		WithArgs("unable to publish message 7: some publish error", int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// the batch fails, the first message is published on its own, and the second fails
+	publisher := &fakePublisher{errs: []error{errors.New("some publish error"), nil, errors.New("some publish error")}}
+	sent, err := NewRelay(db, New(Config{}), publisher).Relay(context.Background())
+	assert.ErrorContains(t, err, "some publish error")
+	assert.Equal(t, 1, sent)
+	require.Len(t, publisher.published(), 1)
+	assert.Equal(t, "first", string(publisher.published()[0].Value))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_Relay_maxAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, attempts, topic, msg_key, msg_value, headers FROM kafka_outbox WHERE sent_at IS NULL AND attempts < 3 ORDER BY id LIMIT 100 FOR UPDATE").
+		WillReturnRows(unsentRows())
+	mock.ExpectExec("UPDATE kafka_outbox SET sent_at = $1 WHERE id IN ($2)").
+		WithArgs(sqlmock.AnyArg(), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(failedQuery).WithArgs(sqlmock.AnyArg(), int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var notified []error
+	publisher := &fakePublisher{errs: []error{errors.New("some publish error"), nil, errors.New("some publish error")}}
+	relay := NewRelay(db, New(Config{}), publisher,
+		WithMaxAttempts(3),
+		WithNotifyError(func(ctx context.Context, err error) { notified = append(notified, err) }),
+	)
+
+	// The second message fails its third attempt, so it is given up on.
+	sent, err := relay.Relay(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	require.Len(t, notified, 1)
+	assert.ErrorContains(t, notified[0], "giving up on message 7 after 3 attempts: unable to publish message 7: some publish error")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelay_Run(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// The first publish fails and is retried.
+	mock.ExpectBegin()
+	mock.ExpectQuery(unsentQuery).WillReturnRows(unsentRows())
+	mock.ExpectExec(failedQuery).WithArgs(sqlmock.AnyArg(), int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(unsentQuery).WillReturnRows(unsentRows())
+	mock.ExpectExec(sentQuery).WithArgs(sqlmock.AnyArg(), int64(3), int64(7)).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	var notified []error
+	publisher := &fakePublisher{errs: []error{errors.New("some publish error"), errors.New("some publish error")}}
+	relay := NewRelay(db, New(Config{}), publisher,
+		WithPollInterval(time.Hour),
+		WithBackOff(func() backoff.BackOff { return backoff.NewConstantBackOff(time.Millisecond) }),
+		WithNotifyError(func(ctx context.Context, err error) { notified = append(notified, err) }),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- relay.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return len(publisher.published()) == 2 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-errCh)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, notified, 1)
+	assert.Equal(t, "first", string(publisher.published()[0].Value), "messages should be published in order")
+	assert.Equal(t, "second", string(publisher.published()[1].Value))
+}
+
+func TestRelay_Run_backOffGivesUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin().WillReturnError(errors.New("some database error"))
+
+	relay := NewRelay(db, New(Config{}), &fakePublisher{},
+		WithBackOff(func() backoff.BackOff { return &backoff.StopBackOff{} }),
+	)
+	assert.ErrorContains(t, relay.Run(context.Background()), "some database error")
+}
+
+func TestRelayBackOff(t *testing.T) {
+	bo := relayBackOff()
+	for i := 0; i < 100; i++ {
+		next := bo.NextBackOff()
+		require.NotEqual(t, backoff.Stop, next)
+		assert.LessOrEqual(t, next, relayBackOffMaxInterval+relayBackOffMaxInterval/2) // with randomization
+	}
+}
+
+// fakePublisher records published messages, failing with each of errs first. A
+// nil error publishes the messages.
+type fakePublisher struct {
+	mu   sync.Mutex
+	errs []error
+	msgs []kafka.Message
+}
+
+func (p *fakePublisher) Publish(_ context.Context, msgs ...kafka.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *fakePublisher) published() []kafka.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]kafka.Message{}, p.msgs...)
+}
@@ -0,0 +1,134 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cultureamp/ca-go/kafka/kafkatest"
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+func newSQLiteOutbox(t *testing.T) (*sql.DB, *Outbox) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "outbox.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	ob := New(Config{Dialect: SQLite})
+	require.NoError(t, ob.CreateTable(context.Background(), db))
+	return db, ob
+}
+
+func TestSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, ob := newSQLiteOutbox(t)
+
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, ob.Enqueue(ctx, tx, "some-topic", []byte("some-key"), []byte("first"), []kafka.Header{{Key: "some-header", Value: []byte("some-value")}}))
+	require.NoError(t, ob.Enqueue(ctx, tx, "some-topic", []byte("some-key"), []byte("second"), nil))
+	require.NoError(t, tx.Commit())
+
+	tx, err = db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, ob.Enqueue(ctx, tx, "some-topic", []byte("some-key"), []byte("rolled back"), nil))
+	require.NoError(t, tx.Rollback())
+
+	broker := kafkatest.NewFakeBroker()
+	p := producer.NewProducer(producer.Config{}, producer.WithKafkaWriter(func() producer.Writer { return broker.Writer("") }))
+	relay := NewRelay(db, ob, p)
+
+	sent, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+
+	msgs := broker.Messages("some-topic")
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "first", string(msgs[0].Value))
+	assert.Equal(t, "some-key", string(msgs[0].Key))
+	assert.Equal(t, []kafka.Header{{Key: "some-header", Value: []byte("some-value")}}, msgs[0].Headers)
+	assert.Equal(t, "second", string(msgs[1].Value))
+	assert.Empty(t, msgs[1].Headers)
+
+	// sent messages are not published again
+	sent, err = relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Len(t, broker.Messages("some-topic"), 2)
+
+	purged, err := ob.Purge(ctx, db, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+}
+
+func TestSQLite_publishError(t *testing.T) {
+	ctx := context.Background()
+	db, ob := newSQLiteOutbox(t)
+	require.NoError(t, ob.Enqueue(ctx, db, "some-topic", nil, []byte("first"), nil))
+
+	publisher := &fakePublisher{errs: []error{errors.New("some publish error")}}
+	relay := NewRelay(db, ob, publisher)
+
+	_, err := relay.Relay(ctx)
+	require.Error(t, err)
+
+	var attempts int
+	var lastError string
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT attempts, last_error FROM kafka_outbox").Scan(&attempts, &lastError))
+	assert.Equal(t, 1, attempts)
+	assert.Contains(t, lastError, "some publish error")
+
+	sent, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	require.Len(t, publisher.published(), 1)
+	assert.Equal(t, "first", string(publisher.published()[0].Value))
+}
+
+func TestSQLite_maxAttempts(t *testing.T) {
+	ctx := context.Background()
+	db, ob := newSQLiteOutbox(t)
+	require.NoError(t, ob.Enqueue(ctx, db, "some-topic", nil, []byte("first"), nil))
+	require.NoError(t, ob.Enqueue(ctx, db, "some-topic", nil, []byte("second"), nil))
+
+	// Each relay fails to publish the batch and then the first message on its own.
+	publishErr := errors.New("some publish error")
+	publisher := &fakePublisher{errs: []error{publishErr, publishErr, publishErr, publishErr}}
+	var notified []error
+	relay := NewRelay(db, ob, publisher,
+		WithMaxAttempts(2),
+		WithNotifyError(func(ctx context.Context, err error) { notified = append(notified, err) }),
+	)
+
+	_, err := relay.Relay(ctx)
+	require.ErrorIs(t, err, publishErr)
+	assert.Empty(t, notified)
+
+	// The first message is given up on after its second attempt...
+	sent, err := relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	require.Len(t, notified, 1)
+	assert.ErrorIs(t, notified[0], publishErr)
+
+	// ...so the second message is no longer held back.
+	sent, err = relay.Relay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	require.Len(t, publisher.published(), 1)
+	assert.Equal(t, "second", string(publisher.published()[0].Value))
+
+	var attempts int
+	var sentAt sql.NullTime
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT attempts, sent_at FROM kafka_outbox WHERE id = 1").Scan(&attempts, &sentAt))
+	assert.Equal(t, 2, attempts)
+	assert.False(t, sentAt.Valid, "the message given up on should be left unsent")
+}
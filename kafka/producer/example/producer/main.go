@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/kafka/producer"
+)
+
+var (
+	brokers string
+	topic   string
+	count   int
+)
+
+func main() {
+	parseFlags()
+
+	cfg := producer.Config{
+		Brokers: strings.Split(brokers, ","),
+		Topic:   topic,
+	}
+	p := producer.NewProducer(cfg,
+		producer.WithNotifyError(notify),
+	)
+	defer func() {
+		if err := p.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	ctx := context.Background()
+
+	log.Printf("producer started for topic %s\n", topic)
+	for i := range count {
+		msg := kafka.Message{
+			Key:   []byte(strconv.Itoa(i)),
+			Value: []byte(time.Now().String()),
+		}
+		if err := p.PublishAsync(ctx, msg); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func notify(_ context.Context, err error, msgs ...kafka.Message) {
+	log.Printf("failed to publish %d messages: %v\n", len(msgs), err)
+}
+
+func parseFlags() {
+	flag.StringVar(&brokers, "brokers", "", "Kafka bootstrap brokers to connect to, as a comma separated list")
+	flag.StringVar(&topic, "topic", "", "Kafka topic to publish to")
+	flag.IntVar(&count, "count", 10, "Number of messages to publish")
+	flag.Parse()
+
+	if brokers == "" {
+		panic("no Kafka bootstrap brokers defined, please set the -brokers flag")
+	}
+	if topic == "" {
+		panic("no topic given to publish to, please set the -topic flag")
+	}
+}
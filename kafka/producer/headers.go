@@ -0,0 +1,73 @@
+package producer
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cultureamp/ca-go/request"
+)
+
+// Kafka message headers used to propagate the request IDs and authenticated user
+// from the request context to consumers.
+const (
+	RequestIDHeader     = "x-request-id"
+	CorrelationIDHeader = "x-correlation-id"
+	AccountIDHeader     = "x-account-id"
+	UserIDHeader        = "x-user-id"
+	RealUserIDHeader    = "x-real-user-id"
+)
+
+// RequestHeaders returns message headers holding the request IDs and the
+// authenticated user from the context (see request.ContextWithUniqueIDs and
+// request.ContextWithAuthenticatedUser). Empty values are omitted.
+func RequestHeaders(ctx context.Context) []kafka.Header {
+	var headers []kafka.Header
+	add := func(key, value string) {
+		if value != "" {
+			headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+	}
+
+	if ids, ok := request.UniqueIDsFromContext(ctx); ok {
+		add(RequestIDHeader, ids.RequestID)
+		add(CorrelationIDHeader, ids.CorrelationID)
+	}
+	if user, ok := request.AuthenticatedUserFromContext(ctx); ok {
+		add(AccountIDHeader, user.CustomerAccountID)
+		add(UserIDHeader, user.UserID)
+		add(RealUserIDHeader, user.RealUserID)
+	}
+
+	return headers
+}
+
+// withRequestHeaders returns a copy of the messages with the request headers
+// from the context added. Headers already set on a message are kept as is.
+func withRequestHeaders(ctx context.Context, msgs []kafka.Message) []kafka.Message {
+	headers := RequestHeaders(ctx)
+	if len(headers) == 0 {
+		return msgs
+	}
+
+	out := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		msg.Headers = append([]kafka.Header{}, msg.Headers...)
+		for _, h := range headers {
+			if !hasHeader(msg.Headers, h.Key) {
+				msg.Headers = append(msg.Headers, h)
+			}
+		}
+		out[i] = msg
+	}
+	return out
+}
+
+func hasHeader(headers []kafka.Header, key string) bool {
+	for _, h := range headers {
+		if h.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package producer
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// NotifyError is a notify-on-error function used to report asynchronous publish errors.
+type NotifyError func(ctx context.Context, err error, msgs ...kafka.Message)
+
+type ClientLogger interface {
+	// Kafka-go Logger interface
+	Infof(fmt string, params ...interface{})
+	Errorf(fmt string, params ...interface{})
+}
@@ -0,0 +1,89 @@
+package producer
+
+import (
+	"github.com/segmentio/kafka-go"
+)
+
+type Option func(producer *Producer)
+
+// WithKafkaDialer configures the producer transport from the dialer, so the same
+// dialer used for consumers (e.g. from consumer.DialerSCRAM512) can be reused for
+// producers.
+func WithKafkaDialer(dialer *kafka.Dialer) Option {
+	return func(producer *Producer) {
+		producer.conf.Transport = &kafka.Transport{
+			Dial:     dialer.DialFunc,
+			ClientID: dialer.ClientID,
+			TLS:      dialer.TLS,
+			SASL:     dialer.SASLMechanism,
+		}
+	}
+}
+
+// WithBalancer sets the strategy used to assign messages to partitions.
+//
+// Default: Hash, which assigns messages with the same key to the same partition.
+func WithBalancer(balancer kafka.Balancer) Option {
+	return func(producer *Producer) {
+		producer.conf.Balancer = balancer
+	}
+}
+
+// WithRequiredAcks sets the number of acknowledgements required from the brokers
+// before a write is considered successful.
+//
+// Default: RequireAll.
+func WithRequiredAcks(acks kafka.RequiredAcks) Option {
+	return func(producer *Producer) {
+		producer.conf.RequiredAcks = acks
+	}
+}
+
+// WithNotifyError adds the NotifyError function to the producer for it to be invoked
+// on each asynchronous publish error.
+func WithNotifyError(notifier NotifyError) Option {
+	return func(producer *Producer) {
+		producer.clientNotify = notifier
+	}
+}
+
+// WithLogger specifies a logger used to report internal producer writer
+// changes.
+func WithLogger(logger ClientLogger) Option {
+	return func(producer *Producer) {
+		producer.conf.Logger = kafka.LoggerFunc(logger.Infof)
+		producer.conf.ErrorLogger = kafka.LoggerFunc(logger.Errorf)
+	}
+}
+
+// WithDataDogTracing adds Data Dog tracing to the producer.
+//
+// A span is started for each published message as a child of any span found in
+// the publish context, and the span context is injected into the message headers
+// so that consumers created using consumer.WithDataDogTracing continue the trace.
+func WithDataDogTracing() Option {
+	return func(producer *Producer) {
+		producer.dataDogTracingEnabled = true
+	}
+}
+
+// WithRequestHeaders adds the request IDs and authenticated user from the publish
+// context to the headers of each message (see RequestHeaders), so that consumers
+// handle the message with the same request context. Headers already set on a
+// message are not overwritten.
+func WithRequestHeaders() Option {
+	return func(producer *Producer) {
+		producer.requestHeaders = true
+	}
+}
+
+// WithKafkaWriter allows a custom writer to be injected into the Producer.
+// Using this will ignore any other writer specific options passed in.
+//
+// It is highly recommended to not use this option unless injecting a mock writer
+// implementation for testing.
+func WithKafkaWriter(writerFn func() Writer) Option {
+	return func(producer *Producer) {
+		producer.writer = writerFn()
+	}
+}
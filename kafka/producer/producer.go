@@ -0,0 +1,217 @@
+//go:generate go run github.com/golang/mock/mockgen@v1.6.0 -destination=mock_writer_test.go -package producer . Writer
+package producer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	kafkatrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/segmentio/kafka.go.v0"
+)
+
+const (
+	producerBatchSize     = 100
+	producerBatchBytes    = 1e6 // 1 MB
+	producerBatchTimeout  = 10 * time.Millisecond
+	producerWriteTimeout  = 10 * time.Second
+	producerQueueCapacity = 100
+)
+
+// ErrProducerClosed is returned when publishing to a Producer that has been closed.
+var ErrProducerClosed = errors.Errorf("producer is closed")
+
+// Writer writes messages to a Kafka topic.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Config is a configuration object used to create a new Producer.
+type Config struct {
+	ID      string // Default: UUID
+	Brokers []string
+	Topic   string
+
+	BatchSize     int           // Default: 100
+	BatchBytes    int64         // Default: 1MB
+	BatchTimeout  time.Duration // Default: 10ms
+	WriteTimeout  time.Duration // Default: 10s
+	QueueCapacity int           // Default: 100
+}
+
+// Producer provides a high level API for publishing messages to a Kafka topic.
+//
+// Messages are assigned to partitions by hashing their key, so messages sharing
+// a key are always written to the same partition and retain their order. Messages
+// without a key are distributed round-robin across all partitions.
+type Producer struct {
+	id                    string
+	conf                  *kafka.Writer
+	writer                Writer
+	dataDogTracingEnabled bool
+	requestHeaders        bool
+	clientNotify          NotifyError
+
+	mu       sync.RWMutex // protects closed and asyncCh against concurrent Close
+	closed   bool
+	asyncCh  chan asyncMessages
+	asyncWg  sync.WaitGroup
+	asyncRun sync.Once
+}
+
+type asyncMessages struct {
+	ctx  context.Context
+	msgs []kafka.Message
+}
+
+// NewProducer returns a new Producer configured with the provided config.
+func NewProducer(config Config, opts ...Option) *Producer {
+	if config.ID == "" {
+		config.ID = uuid.New().String()
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = producerBatchSize // 100
+	}
+	if config.BatchBytes == 0 {
+		config.BatchBytes = producerBatchBytes // 1 MB
+	}
+	if config.BatchTimeout == 0 {
+		config.BatchTimeout = producerBatchTimeout // 10ms
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = producerWriteTimeout // 10s
+	}
+	if config.QueueCapacity < 1 {
+		config.QueueCapacity = producerQueueCapacity // 100
+	}
+
+	p := &Producer{
+		id: config.ID,
+		conf: &kafka.Writer{
+			Addr:         kafka.TCP(config.Brokers...),
+			Topic:        config.Topic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    config.BatchSize,
+			BatchBytes:   config.BatchBytes,
+			BatchTimeout: config.BatchTimeout,
+			WriteTimeout: config.WriteTimeout,
+			RequiredAcks: kafka.RequireAll,
+			Logger:       kafka.LoggerFunc(func(string, ...interface{}) {}), // default to noop
+			ErrorLogger:  kafka.LoggerFunc(func(string, ...interface{}) {}), // default to noop
+		},
+		clientNotify: func(_ context.Context, _ error, _ ...kafka.Message) {}, // default to noop
+		asyncCh:      make(chan asyncMessages, config.QueueCapacity),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	// Set the writer unless one was injected via the WithKafkaWriter option.
+	if p.writer == nil {
+		if p.dataDogTracingEnabled {
+			p.writer = kafkatrace.WrapWriter(p.conf)
+		} else {
+			p.writer = p.conf
+		}
+	}
+
+	return p
+}
+
+// Publish synchronously writes the messages to the topic. The method call blocks
+// until all messages have been acknowledged by the brokers, the context is
+// canceled, or an error occurs.
+func (p *Producer) Publish(ctx context.Context, msgs ...kafka.Message) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	return p.write(ctx, msgs...)
+}
+
+// PublishAsync queues the messages to be written to the topic in the background
+// and returns without waiting for them to be acknowledged. Messages are written
+// in the order they are queued. Any write errors are reported via the NotifyError
+// function set with WithNotifyError.
+//
+// The context is only used for its values (such as the Data Dog span), so the
+// write is not abandoned when the context is canceled after this call returns.
+// An error is returned if the producer has been closed, or the context is canceled
+// while waiting for space in the queue.
+func (p *Producer) PublishAsync(ctx context.Context, msgs ...kafka.Message) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	p.asyncRun.Do(func() {
+		p.asyncWg.Add(1)
+		go p.runAsync()
+	})
+
+	select {
+	case p.asyncCh <- asyncMessages{ctx: context.WithoutCancel(ctx), msgs: msgs}:
+		return nil
+	case <-ctx.Done():
+		return errors.Errorf("unable to queue messages: %w", ctx.Err())
+	}
+}
+
+// Close flushes any messages queued with PublishAsync, waits for them to be
+// written and then closes the writer. Publishing after Close returns
+// ErrProducerClosed.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.asyncCh)
+	p.mu.Unlock()
+
+	p.asyncWg.Wait()
+
+	if err := p.writer.Close(); err != nil {
+		return errors.Errorf("unable to close producer writer: %w", err)
+	}
+
+	p.conf.Logger.Printf(
+		"producer(%s:%s): producer has closed",
+		p.conf.Topic,
+		p.id,
+	)
+	return nil
+}
+
+func (p *Producer) runAsync() {
+	defer p.asyncWg.Done()
+
+	for am := range p.asyncCh {
+		if err := p.write(am.ctx, am.msgs...); err != nil {
+			p.clientNotify(am.ctx, err, am.msgs...)
+		}
+	}
+}
+
+func (p *Producer) write(ctx context.Context, msgs ...kafka.Message) error {
+	if p.requestHeaders {
+		msgs = withRequestHeaders(ctx, msgs)
+	}
+
+	if err := p.writer.WriteMessages(ctx, msgs...); err != nil {
+		return errors.Errorf("unable to write messages: %w", err)
+	}
+
+	return nil
+}
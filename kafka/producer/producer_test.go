@@ -0,0 +1,245 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	kafkatrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/segmentio/kafka.go.v0"
+
+	"github.com/cultureamp/ca-go/request"
+)
+
+func TestNewProducer(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		wantGenID bool
+	}{
+		{
+			name: "new producer with id",
+			config: Config{
+				ID:      "some-id",
+				Brokers: []string{"some-address"},
+				Topic:   "some-topic",
+			},
+		},
+		{
+			name: "new producer without id generates one",
+			config: Config{
+				Brokers: []string{"some-address"},
+				Topic:   "some-topic",
+			},
+			wantGenID: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := &kafka.Dialer{ClientID: "some-client"}
+			wantBalancer := &kafka.RoundRobin{}
+
+			p := NewProducer(tt.config,
+				WithKafkaDialer(dialer),
+				WithBalancer(wantBalancer),
+				WithRequiredAcks(kafka.RequireOne),
+			)
+			require.NotNil(t, p)
+			assert.Equal(t, wantBalancer, p.conf.Balancer)
+			assert.Equal(t, kafka.RequireOne, p.conf.RequiredAcks)
+			assert.Equal(t, tt.config.Topic, p.conf.Topic)
+			assert.Equal(t, producerBatchSize, p.conf.BatchSize)
+			assert.Equal(t, producerBatchTimeout, p.conf.BatchTimeout)
+			require.IsType(t, &kafka.Transport{}, p.conf.Transport)
+			assert.Equal(t, "some-client", p.conf.Transport.(*kafka.Transport).ClientID)
+			assert.Implements(t, (*Writer)(nil), p.writer)
+
+			if tt.wantGenID {
+				assert.NotEmpty(t, p.id)
+			} else {
+				assert.Equal(t, tt.config.ID, p.id)
+			}
+		})
+	}
+}
+
+func TestNewProducer_defaultBalancer(t *testing.T) {
+	p := NewProducer(Config{Topic: "some-topic"})
+	assert.IsType(t, &kafka.Hash{}, p.conf.Balancer)
+	assert.Equal(t, kafka.RequireAll, p.conf.RequiredAcks)
+	assert.Same(t, p.conf, p.writer)
+}
+
+func TestNewProducer_dataDogTracing(t *testing.T) {
+	p := NewProducer(Config{Brokers: []string{"some-address"}, Topic: "some-topic"}, WithDataDogTracing())
+	assert.IsType(t, &kafkatrace.Writer{}, p.writer)
+}
+
+func TestProducer_Publish(t *testing.T) {
+	ctx := context.Background()
+	wantMsgs := []kafka.Message{randMsg(), randMsg()}
+
+	writer := NewMockWriter(gomock.NewController(t))
+	writer.EXPECT().WriteMessages(ctx, wantMsgs[0], wantMsgs[1]).Return(nil).Times(1)
+	writer.EXPECT().Close().Return(nil).Times(1)
+
+	p := NewProducer(Config{}, WithKafkaWriter(func() Writer { return writer }))
+	require.NoError(t, p.Publish(ctx, wantMsgs...))
+	require.NoError(t, p.Close())
+
+	err := p.Publish(ctx, randMsg())
+	assert.ErrorIs(t, err, ErrProducerClosed)
+}
+
+func TestProducer_Publish_error(t *testing.T) {
+	ctx := context.Background()
+	wantErr := errors.New("some write error")
+
+	writer := NewMockWriter(gomock.NewController(t))
+	writer.EXPECT().WriteMessages(ctx, gomock.Any()).Return(wantErr).Times(1)
+
+	p := NewProducer(Config{}, WithKafkaWriter(func() Writer { return writer }))
+	err := p.Publish(ctx, randMsg())
+	require.ErrorIs(t, err, wantErr)
+	assert.EqualError(t, err, fmt.Sprintf("unable to write messages: %s", wantErr))
+}
+
+func TestProducer_PublishAsync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wantNumMsgs := 50
+	wantErr := errors.New("some write error")
+
+	var mu sync.Mutex
+	var gotMsgs []kafka.Message
+	var gotErrs []error
+
+	writer := NewMockWriter(gomock.NewController(t))
+	writer.EXPECT().WriteMessages(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, msgs ...kafka.Message) error {
+			require.NoError(t, ctx.Err(), "async writes should not be canceled with the publish context")
+			mu.Lock()
+			defer mu.Unlock()
+			gotMsgs = append(gotMsgs, msgs...)
+			if len(gotMsgs)%10 == 0 {
+				return wantErr
+			}
+			return nil
+		}).Times(wantNumMsgs)
+	writer.EXPECT().Close().Return(nil).Times(1)
+
+	p := NewProducer(Config{QueueCapacity: 5},
+		WithKafkaWriter(func() Writer { return writer }),
+		WithNotifyError(func(_ context.Context, err error, msgs ...kafka.Message) {
+			assert.Len(t, msgs, 1)
+			gotErrs = append(gotErrs, err)
+		}),
+	)
+
+	var wantMsgs []kafka.Message
+	for range wantNumMsgs {
+		msg := randMsg()
+		wantMsgs = append(wantMsgs, msg)
+		require.NoError(t, p.PublishAsync(ctx, msg))
+	}
+	cancel()
+
+	require.NoError(t, p.Close())
+	assert.Equal(t, wantMsgs, gotMsgs, "messages should be written in the order they were queued")
+	assert.Len(t, gotErrs, wantNumMsgs/10)
+	for _, err := range gotErrs {
+		assert.ErrorIs(t, err, wantErr)
+	}
+
+	err := p.PublishAsync(context.Background(), randMsg())
+	assert.ErrorIs(t, err, ErrProducerClosed)
+}
+
+func TestProducer_Close_error(t *testing.T) {
+	wantErr := errors.New("some close error")
+
+	writer := NewMockWriter(gomock.NewController(t))
+	writer.EXPECT().Close().Return(wantErr).Times(1)
+
+	p := NewProducer(Config{}, WithKafkaWriter(func() Writer { return writer }))
+	require.ErrorIs(t, p.Close(), wantErr)
+	require.NoError(t, p.Close(), "closing twice should be a noop")
+}
+
+func TestProducer_Publish_dataDogTracing(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	defer span.Finish()
+
+	// The traced writer injects the span context into the headers of the passed
+	// in messages before writing, so they can be inspected even though the write
+	// itself fails due to the canceled context.
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	msgs := []kafka.Message{randMsg()}
+
+	p := NewProducer(Config{Brokers: []string{"localhost:9092"}, Topic: "some-topic"}, WithDataDogTracing())
+	require.Error(t, p.Publish(ctx, msgs...))
+
+	spanCtx, err := kafkatrace.ExtractSpanContext(msgs[0])
+	require.NoError(t, err, "span context should be injected into the message headers")
+	assert.NotZero(t, spanCtx.TraceID())
+	assert.Equal(t, span.Context().TraceID(), spanCtx.TraceID())
+}
+
+func TestProducer_Publish_requestHeaders(t *testing.T) {
+	ctx := request.ContextWithUniqueIDs(context.Background(), request.UniqueIDs{
+		RequestID:     "some-request-id",
+		CorrelationID: "some-correlation-id",
+	})
+	ctx = request.ContextWithAuthenticatedUser(ctx, request.AuthenticatedUser{
+		CustomerAccountID: "some-account-id",
+		UserID:            "some-user-id",
+		RealUserID:        "some-user-id",
+	})
+
+	msg := randMsg()
+	msg.Headers = []kafka.Header{{Key: CorrelationIDHeader, Value: []byte("existing-correlation-id")}}
+
+	var got []kafka.Message
+	writer := NewMockWriter(gomock.NewController(t))
+	writer.EXPECT().WriteMessages(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, msgs ...kafka.Message) error {
+		got = msgs
+		return nil
+	}).Times(1)
+
+	p := NewProducer(Config{}, WithKafkaWriter(func() Writer { return writer }), WithRequestHeaders())
+	require.NoError(t, p.Publish(ctx, msg))
+
+	require.Len(t, got, 1)
+	assert.Equal(t, []kafka.Header{
+		{Key: CorrelationIDHeader, Value: []byte("existing-correlation-id")},
+		{Key: RequestIDHeader, Value: []byte("some-request-id")},
+		{Key: AccountIDHeader, Value: []byte("some-account-id")},
+		{Key: UserIDHeader, Value: []byte("some-user-id")},
+		{Key: RealUserIDHeader, Value: []byte("some-user-id")},
+	}, got[0].Headers)
+	assert.Len(t, msg.Headers, 1, "the published message should not be modified")
+}
+
+func TestRequestHeaders_empty(t *testing.T) {
+	assert.Empty(t, RequestHeaders(context.Background()))
+}
+
+func randMsg() kafka.Message {
+	return kafka.Message{
+		Key:   []byte(uuid.New().String()),
+		Value: []byte(uuid.New().String()),
+	}
+}
@@ -213,6 +213,13 @@ func TestLoggerContexts(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, origLogger, l2) // l2 is NOT a new logger
 	assert.NotEqual(t, origCtx, ctx5)
+
+	// check ContextWithLogger replaces the logger in ctx2
+	child := origLogger.Child()
+	ctx6 := ContextWithLogger(ctx2, child)
+	_, l3, err := FromContext(ctx6)
+	assert.Nil(t, err)
+	assert.Equal(t, child, l3)
 }
 
 func ExampleLogger_Debug_withChild() {
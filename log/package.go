@@ -108,6 +108,12 @@ func FromContext(ctx context.Context) (context.Context, Logger, error) { //nolin
 	return ctx, l, nil
 }
 
+// ContextWithLogger returns a context with the logger attached, replacing any
+// logger already attached to the ctx, such as with a Child of it.
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, ctxLoggerKey{}, logger)
+}
+
 func mustHaveDefaultLogger() {
 	if DefaultLogger == nil {
 		setGlobalLogger()